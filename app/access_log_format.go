@@ -0,0 +1,304 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+)
+
+// accessLogEntry is everything which can be written about a request in the
+// access log.
+type accessLogEntry struct {
+	req                    *http.Request
+	vhost                  string
+	locationIdentification string
+	reqID                  types.RequestID
+	url                    url.URL
+	ts                     time.Time
+	duration               time.Duration
+	ttfb                   time.Duration // zero if nothing was written
+	status                 int
+	size                   uint64
+	info                   *types.AccessInfo
+}
+
+// accessLogFormatter appends an access log line for the entry to buf.
+type accessLogFormatter func(buf []byte, e *accessLogEntry) []byte
+
+// accessLogField is a value which can be written in the access log. The
+// value function appends nothing if the value is not known.
+type accessLogField struct {
+	name    string
+	numeric bool
+	value   func(buf []byte, e *accessLogEntry) []byte
+}
+
+var accessLogFields = []accessLogField{
+	{"time", false, func(buf []byte, e *accessLogEntry) []byte {
+		return e.ts.AppendFormat(buf, "2006-01-02T15:04:05.000Z07:00")
+	}},
+	{"remote_addr", false, func(buf []byte, e *accessLogEntry) []byte {
+		host, _, err := net.SplitHostPort(e.req.RemoteAddr)
+		if err != nil {
+			host = e.req.RemoteAddr
+		}
+		return append(buf, host...)
+	}},
+	{"host", false, func(buf []byte, e *accessLogEntry) []byte {
+		return append(buf, e.locationIdentification...)
+	}},
+	{"request_id", false, func(buf []byte, e *accessLogEntry) []byte {
+		return append(buf, e.reqID...)
+	}},
+	{"user", false, func(buf []byte, e *accessLogEntry) []byte {
+		if e.url.User != nil {
+			buf = append(buf, e.url.User.Username()...)
+		}
+		return buf
+	}},
+	{"method", false, func(buf []byte, e *accessLogEntry) []byte {
+		return append(buf, e.req.Method...)
+	}},
+	{"uri", false, func(buf []byte, e *accessLogEntry) []byte {
+		return append(buf, e.url.RequestURI()...)
+	}},
+	{"proto", false, func(buf []byte, e *accessLogEntry) []byte {
+		return append(buf, e.req.Proto...)
+	}},
+	{"status", true, func(buf []byte, e *accessLogEntry) []byte {
+		return strconv.AppendInt(buf, int64(e.status), 10)
+	}},
+	{"bytes", true, func(buf []byte, e *accessLogEntry) []byte {
+		return strconv.AppendUint(buf, e.size, 10)
+	}},
+	{"duration", true, func(buf []byte, e *accessLogEntry) []byte {
+		return strconv.AppendFloat(buf, e.duration.Seconds(), 'f', 6, 64)
+	}},
+	{"ttfb", true, func(buf []byte, e *accessLogEntry) []byte {
+		if e.ttfb == 0 {
+			return buf
+		}
+		return strconv.AppendFloat(buf, e.ttfb.Seconds(), 'f', 6, 64)
+	}},
+	{"cache_status", false, func(buf []byte, e *accessLogEntry) []byte {
+		return append(buf, e.info.CacheStatus()...)
+	}},
+	{"cache_bytes", true, func(buf []byte, e *accessLogEntry) []byte {
+		return strconv.AppendUint(buf, e.info.CacheBytes(), 10)
+	}},
+	{"upstream_addr", false, func(buf []byte, e *accessLogEntry) []byte {
+		return append(buf, strings.Join(e.info.UpstreamAddrs(), ", ")...)
+	}},
+	{"upstream_retries", true, func(buf []byte, e *accessLogEntry) []byte {
+		return strconv.AppendUint(buf, uint64(e.info.UpstreamRetries()), 10)
+	}},
+	{"range", false, func(buf []byte, e *accessLogEntry) []byte {
+		return append(buf, e.req.Header.Get("Range")...)
+	}},
+	{"referer", false, func(buf []byte, e *accessLogEntry) []byte {
+		return append(buf, e.req.Referer()...)
+	}},
+	{"user_agent", false, func(buf []byte, e *accessLogEntry) []byte {
+		return append(buf, e.req.UserAgent()...)
+	}},
+}
+
+func getAccessLogField(name string) (accessLogField, error) {
+	for _, field := range accessLogFields {
+		if field.name == name {
+			return field, nil
+		}
+	}
+	return accessLogField{}, fmt.Errorf("unknown access log field `%s`", name)
+}
+
+func getAccessLogFields(names []string) ([]accessLogField, error) {
+	if len(names) == 0 {
+		return accessLogFields, nil
+	}
+	var fields = make([]accessLogField, len(names))
+	for i, name := range names {
+		var err error
+		if fields[i], err = getAccessLogField(name); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// newAccessLogFormatter returns the formatter for the access log format.
+func newAccessLogFormatter(cfg config.AccessLogFormat) (accessLogFormatter, error) {
+	switch cfg.Format {
+	case "", config.AccessLogFormatCommon:
+		return formatCommon, nil
+	case config.AccessLogFormatJSON:
+		fields, err := getAccessLogFields(cfg.Fields)
+		if err != nil {
+			return nil, err
+		}
+		return jsonFormatter(fields), nil
+	case config.AccessLogFormatLogfmt:
+		fields, err := getAccessLogFields(cfg.Fields)
+		if err != nil {
+			return nil, err
+		}
+		return logfmtFormatter(fields), nil
+	case config.AccessLogFormatTemplate:
+		return templateFormatter(cfg.Template)
+	}
+	return nil, fmt.Errorf("unknown access log format `%s`", cfg.Format)
+}
+
+func formatCommon(buf []byte, e *accessLogEntry) []byte {
+	return append(buf, buildCommonLogLine(e.req, e.locationIdentification, e.reqID,
+		e.url, e.ts, e.status, e.size)...)
+}
+
+// jsonFormatter writes the fields as a JSON object. Unknown values are null.
+func jsonFormatter(fields []accessLogField) accessLogFormatter {
+	return func(buf []byte, e *accessLogEntry) []byte {
+		buf = append(buf, '{')
+		for i, field := range fields {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJSONString(buf, field.name)
+			buf = append(buf, ':')
+			var start = len(buf)
+			buf = field.value(buf, e)
+			switch {
+			case len(buf) == start:
+				buf = append(buf, "null"...)
+			case !field.numeric:
+				var value = string(buf[start:])
+				buf = appendJSONString(buf[:start], value)
+			}
+		}
+		return append(buf, '}')
+	}
+}
+
+// logfmtFormatter writes the fields as key=value pairs. Unknown values are "-"
+// and values with spaces, quotes or equal signs are quoted.
+func logfmtFormatter(fields []accessLogField) accessLogFormatter {
+	return func(buf []byte, e *accessLogEntry) []byte {
+		for i, field := range fields {
+			if i > 0 {
+				buf = append(buf, ' ')
+			}
+			buf = append(buf, field.name...)
+			buf = append(buf, '=')
+			var start = len(buf)
+			buf = field.value(buf, e)
+			if len(buf) == start {
+				buf = append(buf, '-')
+			} else if value := string(buf[start:]); strings.ContainsAny(value, " =\"\\") ||
+				strings.IndexFunc(value, isNotPrint) >= 0 {
+				buf = strconv.AppendQuote(buf[:start], value)
+			}
+		}
+		return buf
+	}
+}
+
+// templateFormatter writes the template with its $name or ${name} variables
+// replaced by the values of the fields. Unknown values are "-".
+func templateFormatter(tmpl string) (accessLogFormatter, error) {
+	type segment struct {
+		literal string
+		field   *accessLogField
+	}
+	var segments []segment
+	for len(tmpl) > 0 {
+		var i = strings.IndexByte(tmpl, '$')
+		if i < 0 {
+			segments = append(segments, segment{literal: tmpl})
+			break
+		}
+		if i > 0 {
+			segments = append(segments, segment{literal: tmpl[:i]})
+		}
+		tmpl = tmpl[i+1:]
+		var name string
+		if strings.HasPrefix(tmpl, "{") {
+			var end = strings.IndexByte(tmpl, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed variable in access log template")
+			}
+			name, tmpl = tmpl[1:end], tmpl[end+1:]
+		} else {
+			var end = strings.IndexFunc(tmpl, func(r rune) bool {
+				return !(r == '_' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+			})
+			if end < 0 {
+				end = len(tmpl)
+			}
+			name, tmpl = tmpl[:end], tmpl[end:]
+		}
+		if name == "" { // a lone $
+			segments = append(segments, segment{literal: "$"})
+			continue
+		}
+		field, err := getAccessLogField(name)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment{field: &field})
+	}
+
+	return func(buf []byte, e *accessLogEntry) []byte {
+		for _, s := range segments {
+			if s.field == nil {
+				buf = append(buf, s.literal...)
+				continue
+			}
+			var start = len(buf)
+			if buf = s.field.value(buf, e); len(buf) == start {
+				buf = append(buf, '-')
+			}
+		}
+		return buf
+	}, nil
+}
+
+func isNotPrint(r rune) bool {
+	return !strconv.IsPrint(r)
+}
+
+// appendJSONString appends s to buf as a quoted JSON string.
+func appendJSONString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	for width := 0; len(s) > 0; s = s[width:] {
+		r := rune(s[0])
+		width = 1
+		if r >= utf8.RuneSelf {
+			r, width = utf8.DecodeRuneInString(s)
+		}
+		switch {
+		case r == '"' || r == '\\':
+			buf = append(buf, '\\', byte(r))
+		case r == '\n':
+			buf = append(buf, `\n`...)
+		case r == '\r':
+			buf = append(buf, `\r`...)
+		case r == '\t':
+			buf = append(buf, `\t`...)
+		case r < ' ':
+			buf = append(buf, `\u00`...)
+			buf = append(buf, lowerhex[r>>4], lowerhex[r&0xF])
+		case r == utf8.RuneError && width == 1:
+			buf = append(buf, `\ufffd`...)
+		default:
+			buf = append(buf, s[:width]...)
+		}
+	}
+	return append(buf, '"')
+}
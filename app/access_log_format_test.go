@@ -0,0 +1,154 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+)
+
+func testAccessLogEntry(t *testing.T) *accessLogEntry {
+	req, err := http.NewRequest("GET", "http://example.com/path?a=b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = "127.0.0.1:12345"
+	req.Header.Set("Range", "bytes=0-99")
+	req.Header.Set("User-Agent", `quoted "agent"`)
+	var info = new(types.AccessInfo)
+	info.SetCacheStatus(types.CacheStatusPartial)
+	info.AddCacheBytes(60)
+	info.AddUpstreamAddr("10.0.0.1:80")
+	info.AddUpstreamAddr("10.0.0.2:80")
+	info.AddUpstreamAddr("10.0.0.1:80")
+	info.AddUpstreamRetry()
+	return &accessLogEntry{
+		req:                    req,
+		locationIdentification: "example.com",
+		reqID:                  types.RequestID("reqid"),
+		url:                    *req.URL,
+		ts:                     time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC),
+		duration:               1500 * time.Microsecond,
+		status:                 206,
+		size:                   100,
+		info:                   info,
+	}
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		format   config.AccessLogFormat
+		expected string
+	}{
+		{
+			format: config.AccessLogFormat{Format: "json", Fields: []string{
+				"time", "request_id", "uri", "status", "ttfb", "cache_status", "cache_bytes",
+				"upstream_addr", "range", "user_agent"}},
+			expected: `{"time":"2016-01-02T03:04:05.000Z","request_id":"reqid","uri":"/path?a=b",` +
+				`"status":206,"ttfb":null,"cache_status":"partial","cache_bytes":60,` +
+				`"upstream_addr":"10.0.0.1:80, 10.0.0.2:80","range":"bytes=0-99",` +
+				`"user_agent":"quoted \"agent\""}`,
+		},
+		{
+			format: config.AccessLogFormat{Format: "logfmt", Fields: []string{
+				"remote_addr", "method", "duration", "user", "upstream_addr", "upstream_retries",
+				"user_agent"}},
+			expected: `remote_addr=127.0.0.1 method=GET duration=0.001500 user=- ` +
+				`upstream_addr="10.0.0.1:80, 10.0.0.2:80" upstream_retries=1 user_agent="quoted \"agent\""`,
+		},
+		{
+			format: config.AccessLogFormat{Format: "template",
+				Template: `$remote_addr "$range" ${cache_status}/$cache_bytes $ttfb $`},
+			expected: `127.0.0.1 "bytes=0-99" partial/60 - $`,
+		},
+	}
+
+	var entry = testAccessLogEntry(t)
+	for _, test := range tests {
+		formatter, err := newAccessLogFormatter(test.format)
+		if err != nil {
+			t.Errorf("Unexpected error for %+v: %s", test.format, err)
+			continue
+		}
+		if got := string(formatter(nil, entry)); got != test.expected {
+			t.Errorf("Wrong %s line\nexpected: %s\n     got: %s", test.format.Format, test.expected, got)
+		}
+	}
+}
+
+func TestAccessLogFormatCommon(t *testing.T) {
+	t.Parallel()
+	formatter, err := newAccessLogFormatter(config.AccessLogFormat{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var line = string(formatter(nil, testAccessLogEntry(t)))
+	var prefix = `127.0.0.1 -> example.com reqid - - [02/Jan/2016:03:04:05 +0000] "GET /path?a=b HTTP/1.1" 206 100 `
+	// the line ends with the time since the request in nanoseconds
+	if !strings.HasPrefix(line, prefix) {
+		t.Errorf("Unexpected common log line %s", line)
+	} else if _, err := strconv.ParseUint(strings.TrimPrefix(line, prefix), 10, 64); err != nil {
+		t.Errorf("Unexpected end of the common log line %s", line)
+	}
+}
+
+func TestAccessLogFormatErrors(t *testing.T) {
+	t.Parallel()
+	for _, format := range []config.AccessLogFormat{
+		{Format: "xml"},
+		{Format: "json", Fields: []string{"status", "nope"}},
+		{Format: "template", Template: "$status $nope"},
+		{Format: "template", Template: "${status"},
+	} {
+		if _, err := newAccessLogFormatter(format); err == nil {
+			t.Errorf("Expected an error for %+v", format)
+		}
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	format, err := templateFormatter("$status $cache_status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log = &accessLog{
+		Writer:     &buf,
+		format:     format,
+		async:      true, // written synchronously in buf
+		sampleHits: 3,
+	}
+	var hit, miss, hitError = testAccessLogEntry(t), testAccessLogEntry(t), testAccessLogEntry(t)
+	hit.info, hitError.info = new(types.AccessInfo), new(types.AccessInfo)
+	hit.info.SetCacheStatus(types.CacheStatusHit)
+	hitError.info.SetCacheStatus(types.CacheStatusHit)
+	hitError.status = http.StatusNotFound
+	for i := 0; i < 6; i++ {
+		log.log(hit)
+		log.log(miss)
+		log.log(hitError)
+	}
+
+	var lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var counts = make(map[string]int)
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "404 "):
+			counts["error"]++
+		case strings.HasSuffix(line, " hit"):
+			counts["hit"]++
+		default:
+			counts["miss"]++
+		}
+	}
+	if counts["hit"] != 2 || counts["miss"] != 6 || counts["error"] != 6 {
+		t.Errorf("Unexpected logged lines %v:\n%s", counts, buf.String())
+	}
+}
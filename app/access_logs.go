@@ -3,29 +3,194 @@ package app
 import (
 	"fmt"
 	"io"
-	"os"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/logfile"
 )
 
 const accessLogFilePerm = 0600
 
+var (
+	asyncAccessLogsMutex sync.Mutex
+	// The current asynchronous writers of the buffered access logs by file.
+	// Reloads with the same buffering settings for a file reuse its writer.
+	asyncAccessLogs = make(map[string]*asyncAccessLog)
+	// All writers which are not closed yet, including the replaced ones.
+	openAsyncAccessLogs = make(map[*asyncAccessLog]struct{})
+	// The lines dropped by the closed writers.
+	closedAsyncAccessLogsDropped uint64
+)
+
 // open an access log with the appropriate permissions on the file
-// if it isn't open yet. Return the already open otherwise
-func (a accessLogs) openAccessLog(file string) (io.Writer, error) {
-	if accessLog, ok := a[file]; ok {
-		return accessLog, nil
-	}
-	accessLog, err := os.OpenFile(
-		file,
-		os.O_CREATE|os.O_WRONLY|os.O_APPEND,
-		accessLogFilePerm,
-	)
+// if it isn't open yet. Reuse the already open file otherwise.
+// The lines are written, rotated, buffered and sampled according to the
+// supplied settings.
+func (a *accessLogs) openAccessLog(settings config.AccessLogSettings) (*accessLog, error) {
+	var file = settings.AccessLog
+	if file == "" {
+		return nil, nil
+	}
+	f, ok := a.files[file]
+	if !ok {
+		var err error
+		if f, err = logfile.Open(file, accessLogFilePerm, settings.AccessLogRotation); err != nil {
+			return nil, fmt.Errorf("error opening access log `%s`- %s",
+				file, err)
+		}
+		a.files[file] = f
+	}
+	formatter, err := newAccessLogFormatter(settings.AccessLogFormat)
 	if err != nil {
-		return nil, fmt.Errorf("error opening access log `%s`- %s",
-			file, err)
+		return nil, fmt.Errorf("error in the format of access log `%s` - %s", file, err)
 	}
-	a[file] = accessLog
-	return accessLog, nil
+
+	var result = &accessLog{
+		Writer:     f,
+		format:     formatter,
+		sampleHits: settings.AccessLogSampleHits,
+	}
+	if settings.AccessLogBuffering.Size > 0 {
+		async, ok := a.async[file]
+		if !ok {
+			async = openAsyncAccessLog(file, f, settings.AccessLogBuffering)
+			a.async[file] = async
+		}
+		result.Writer, result.async = async, true
+	}
+	return result, nil
 }
 
-// helper type to facilitate not opening the same access_log twice
-type accessLogs map[string]io.Writer
+// asyncAccessLog is an asynchronous writer of an access log file which is
+// shared by the configurations using the file with the same buffering.
+type asyncAccessLog struct {
+	*logfile.AsyncWriter
+	file      string
+	buffering config.LogBuffering
+	refs      int // guarded by asyncAccessLogsMutex
+}
+
+// openAsyncAccessLog returns the asynchronous writer for the access log file.
+// The current one is reused if it has the same buffering settings and a new
+// one replaces it otherwise.
+func openAsyncAccessLog(file string, w io.Writer, cfg config.LogBuffering) *asyncAccessLog {
+	asyncAccessLogsMutex.Lock()
+	defer asyncAccessLogsMutex.Unlock()
+	if async, ok := asyncAccessLogs[file]; ok && async.buffering == cfg {
+		async.refs++
+		return async
+	}
+	var async = &asyncAccessLog{
+		AsyncWriter: logfile.NewAsyncWriter(w, cfg),
+		file:        file,
+		buffering:   cfg,
+		refs:        1,
+	}
+	asyncAccessLogs[file] = async
+	openAsyncAccessLogs[async] = struct{}{}
+	return async
+}
+
+// Close releases the writer for one of the configurations using it. When none
+// uses it anymore it is closed after writing all queued lines.
+func (a *asyncAccessLog) Close() error {
+	asyncAccessLogsMutex.Lock()
+	if a.refs--; a.refs > 0 {
+		asyncAccessLogsMutex.Unlock()
+		return nil
+	}
+	if asyncAccessLogs[a.file] == a {
+		delete(asyncAccessLogs, a.file)
+	}
+	asyncAccessLogsMutex.Unlock()
+
+	var err = a.AsyncWriter.Close()
+	asyncAccessLogsMutex.Lock()
+	defer asyncAccessLogsMutex.Unlock()
+	delete(openAsyncAccessLogs, a)
+	closedAsyncAccessLogsDropped += a.Dropped()
+	return err
+}
+
+// accessLogsDropped returns the number of access log lines which were dropped
+// because the queues of the buffered access logs were full.
+func accessLogsDropped() uint64 {
+	asyncAccessLogsMutex.Lock()
+	defer asyncAccessLogsMutex.Unlock()
+	var dropped = closedAsyncAccessLogsDropped
+	for async := range openAsyncAccessLogs {
+		dropped += async.Dropped()
+	}
+	return dropped
+}
+
+// accessLogs are the access log files of a configuration with their
+// asynchronous writers. Every file is opened only once for it.
+type accessLogs struct {
+	files map[string]*logfile.File
+	async map[string]*asyncAccessLog
+}
+
+func newAccessLogs() *accessLogs {
+	return &accessLogs{
+		files: make(map[string]*logfile.File),
+		async: make(map[string]*asyncAccessLog),
+	}
+}
+
+// closers returns the files and the asynchronous writers to be closed when
+// the configuration is replaced. The writers are after the files so that
+// they are closed first.
+func (a *accessLogs) closers() []io.Closer {
+	var result = make([]io.Closer, 0, len(a.files)+len(a.async))
+	for _, f := range a.files {
+		result = append(result, f)
+	}
+	for _, async := range a.async {
+		result = append(result, async)
+	}
+	return result
+}
+
+// accessLog is an access log file with the format of its lines.
+type accessLog struct {
+	io.Writer
+	format     accessLogFormatter
+	async      bool   // whether Writer is asynchronous
+	sampleHits uint64 // log 1 of that many successful cache hits
+	hits       uint64
+}
+
+// log writes a line for the entry in the access log unless it is sampled out.
+// Writing to a synchronous access log is done in a new goroutine.
+func (a *accessLog) log(e *accessLogEntry) {
+	if a.sampledOut(e) {
+		accessLogSampledOut.Inc(e.vhost)
+		return
+	}
+	if a.async {
+		a.write(e)
+	} else {
+		go a.write(e)
+	}
+}
+
+// sampledOut returns whether the entry should not be logged. Only successful
+// cache hits are sampled.
+func (a *accessLog) sampledOut(e *accessLogEntry) bool {
+	if a.sampleHits <= 1 || e.status >= http.StatusBadRequest ||
+		e.info.CacheStatus() != types.CacheStatusHit {
+		return false
+	}
+	return atomic.AddUint64(&a.hits, 1)%a.sampleHits != 1
+}
+
+// write writes a line for the entry in the access log.
+func (a *accessLog) write(e *accessLogEntry) {
+	buf := a.format(make([]byte, 0, 256), e)
+	buf = append(buf, '\n')
+	_, _ = a.Write(buf)
+}
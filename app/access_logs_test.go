@@ -0,0 +1,66 @@
+package app
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/testutils"
+)
+
+func TestAsyncAccessLogsOnReload(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+	var settings = config.AccessLogSettings{
+		AccessLog: filepath.Join(dir, "access.log"),
+		AccessLogBuffering: config.LogBuffering{
+			Size:          types.BytesSize(1024),
+			FlushInterval: 60000,
+		},
+	}
+	var open = func(settings config.AccessLogSettings) (*accessLogs, *accessLog) {
+		var logs = newAccessLogs()
+		accessLog, err := logs.openAccessLog(settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return logs, accessLog
+	}
+	var closeAll = func(logs *accessLogs) {
+		var closers = logs.closers()
+		for i := len(closers) - 1; i >= 0; i-- {
+			if err := closers[i].Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	first, firstLog := open(settings)
+	second, secondLog := open(settings)
+	if firstLog.Writer != secondLog.Writer {
+		t.Error("Expected the writer to be reused with the same buffering")
+	}
+	settings.AccessLogBuffering.QueueSize = 10
+	third, thirdLog := open(settings)
+	if thirdLog.Writer == secondLog.Writer {
+		t.Error("Expected a new writer for the changed buffering")
+	}
+
+	_, _ = firstLog.Write([]byte("first\n"))
+	_, _ = thirdLog.Write([]byte("third\n"))
+	closeAll(first)
+	if got, _ := ioutil.ReadFile(settings.AccessLog); len(got) != 0 {
+		t.Errorf("Expected the writer to be kept while it is used but %q was written", got)
+	}
+	closeAll(second)
+	if got, _ := ioutil.ReadFile(settings.AccessLog); string(got) != "first\n" {
+		t.Errorf("Expected the lines to be written when the writer is closed but got %q", got)
+	}
+	closeAll(third)
+	if got, _ := ioutil.ReadFile(settings.AccessLog); string(got) != "first\nthird\n" {
+		t.Errorf("Unexpected access log %q", got)
+	}
+}
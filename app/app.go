@@ -6,6 +6,7 @@ package app
 import (
 	"context"
 	"errors"
+	"io"
 	"net"
 	"net/http"
 	"os"
@@ -19,6 +20,7 @@ import (
 	"github.com/ironsmile/nedomi/config"
 	"github.com/ironsmile/nedomi/contexts"
 	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/logfile"
 	"github.com/ironsmile/nedomi/utils/netutils"
 )
 
@@ -36,9 +38,16 @@ type Application struct {
 	// Used to wait for the main serving goroutine to finish
 	finished chan struct{}
 
-	// HTTP Server which will use the above listener in order to server
-	// clients requests.
-	httpSrv *http.Server
+	// The listeners keyed by their addresses. It is nil until the
+	// application starts serving.
+	listeners map[string]*listener
+
+	// The certificates and settings for the TLS connections.
+	tlsSettings *tlsSettings
+
+	// Gets the client addresses of the requests from trusted proxies. It is
+	// nil if there are none.
+	realIP *realIP
 
 	// This is a map from Host names to virtual host pairs. The host names which will be
 	// matched against the Host heder are used as keys in this map.
@@ -52,6 +61,9 @@ type Application struct {
 	// that is resposible for this cache zone.
 	cacheZones map[string]*types.CacheZone
 
+	// The background tasks of the cache zones by ID.
+	zoneTasks map[string]*zoneTasks
+
 	// A map with all simple and advanced upstream transports
 	upstreams map[string]types.Upstream
 
@@ -69,6 +81,17 @@ type Application struct {
 	version types.AppVersion
 
 	conns *connections
+
+	// The loggers and the log files opened for the current configuration.
+	// They are closed when it is replaced.
+	openLogs []io.Closer
+
+	// The stats of the locations keyed by virtual host and location names.
+	// The stats of the locations which are still configured are kept
+	// between reloads.
+	locationStats map[string]*types.LocationStats
+	// The stats of the replaced configuration while reloading.
+	oldLocationStats map[string]*types.LocationStats
 }
 
 func (a *Application) copy() (app *Application) {
@@ -77,16 +100,21 @@ func (a *Application) copy() (app *Application) {
 		configGetter:         a.configGetter,
 		cfg:                  a.cfg,
 		finished:             a.finished,
-		httpSrv:              a.httpSrv,
+		listeners:            a.listeners,
+		tlsSettings:          a.tlsSettings,
+		realIP:               a.realIP,
 		virtualHosts:         a.virtualHosts,
 		notConfiguredHandler: a.notConfiguredHandler,
 		cacheZones:           a.cacheZones,
+		zoneTasks:            a.zoneTasks,
+		upstreams:            a.upstreams,
 		ctx:                  a.ctx,
 		ctxCancel:            a.ctxCancel,
 		stats:                a.stats,
 		started:              a.started,
 		version:              a.version,
 		conns:                a.conns,
+		locationStats:        a.locationStats,
 	}
 	app.SetLogger(a.GetLogger())
 	return
@@ -94,7 +122,11 @@ func (a *Application) copy() (app *Application) {
 
 // Stats returns application wide stats
 func (a *Application) Stats() types.AppStats {
-	return (types.AppStats)(*a.stats)
+	var stats = (types.AppStats)(*a.stats)
+	stats.OpenConnections = uint64(a.conns.Size())
+	stats.OpenStreams = uint64(a.conns.Streams())
+	stats.AccessLogDropped = accessLogsDropped()
+	return stats
 }
 
 // Run fires up the application. And Blocks until it ends
@@ -127,39 +159,33 @@ func (a *Application) Run() error {
 func (a *Application) doServing() {
 	defer func() { a.finished <- struct{}{} }()
 
-	a.httpSrv = &http.Server{
-		Addr:           a.cfg.HTTP.Listen,
-		Handler:        a,
-		ReadTimeout:    time.Duration(a.cfg.HTTP.ReadTimeout) * time.Second,
-		WriteTimeout:   time.Duration(a.cfg.HTTP.WriteTimeout) * time.Second,
-		MaxHeaderBytes: a.cfg.HTTP.MaxHeadersSize,
-		ConnState: func(input net.Conn, state http.ConnState) {
-			conn := input.(types.IncomingConn)
-			switch state {
-			case http.StateNew:
-				a.conns.add(conn)
-			case http.StateClosed:
-				a.conns.remove(conn)
-			}
-		},
-	}
-
-	err := a.listenAndServe()
+	err := a.listenAndServe(a.startListeners())
+	a.closeListeners()
 
 	a.GetLogger().Logf("Webserver stopped. %s", err)
 }
 
+func (a *Application) connState(input net.Conn, state http.ConnState) {
+	conn, ok := netutils.IncomingConn(input)
+	if !ok {
+		return
+	}
+	switch state {
+	case http.StateNew:
+		a.conns.add(conn)
+	case http.StateClosed:
+		a.conns.remove(conn)
+		netutils.ForgetConn(input)
+	}
+}
+
 // Uses our own listener to make our server stoppable. Similar to
 // net.http.Server.ListenAndServer only this version saves a reference to the listener
-func (a *Application) listenAndServe() error {
-	var deadlineToTimeoutListener = netutils.DeadlineToTimeoutListenerConstructor(
-		int64(a.cfg.HTTP.MaxIOTransferSize),
-		int64(a.cfg.HTTP.MinIOTransferSize),
-	)
+func (a *Application) listenAndServe(servers []*http.Server) error {
 	// Serve accepts incoming connections on the Listener lsn, creating a
 	// new service goroutine for each.  The service goroutines read requests and
 	// then call the handler (i.e. ServeHTTP() ) to reply to them.
-	return gracehttp.ServeWithWrapper(deadlineToTimeoutListener, a.httpSrv)
+	return gracehttp.ServeWithWrapper(a.wrapGraceListener, servers...)
 }
 
 // Stop makes sure the application is completely stopped and all of its
@@ -172,6 +198,10 @@ func (a *Application) Stop() error {
 	err = process.Signal(syscall.SIGTERM)
 	<-a.finished
 	a.ctxCancel()
+	a.Lock()
+	defer a.Unlock()
+	a.closeLogs(a.openLogs) // writes the buffered access log lines
+	a.openLogs = nil
 	return err
 }
 
@@ -188,10 +218,16 @@ func (a *Application) Reload(cfg *config.Config) error {
 // When Wait returns it is the end of the application.
 func (a *Application) Wait() error {
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt, os.Kill, syscall.SIGHUP, syscall.SIGTERM)
+	signal.Notify(signalChan, os.Interrupt, os.Kill, syscall.SIGHUP, syscall.SIGTERM,
+		syscall.SIGUSR1)
 
 	for sig := range signalChan {
-		if sig == syscall.SIGHUP {
+		if sig == syscall.SIGUSR1 {
+			a.GetLogger().Logf("Reopening the log files")
+			if err := logfile.ReopenAll(); err != nil {
+				a.GetLogger().Errorf("Reopening the log files failed: %s", err)
+			}
+		} else if sig == syscall.SIGHUP {
 			newConfig, err := a.configGetter()
 			if err != nil {
 				a.GetLogger().Errorf("Getting new config error: %s", err)
@@ -228,6 +264,8 @@ func New(version types.AppVersion, configGetter config.Getter) (*Application, er
 		configGetter: configGetter,
 		conns:        newConnections(),
 		cacheZones:   make(map[string]*types.CacheZone),
+
+		locationStats: make(map[string]*types.LocationStats),
 	}
 	a.ctx, a.ctxCancel = context.WithCancel(context.Background())
 	a.ctx = contexts.NewAppContext(a.ctx, a)
@@ -253,3 +291,14 @@ func (a *Application) Started() time.Time {
 func (a *Application) GetUpstream(id string) types.Upstream {
 	return a.upstreams[id]
 }
+
+// Upstreams returns all configured upstreams keyed by their id
+func (a *Application) Upstreams() map[string]types.Upstream {
+	a.RLock()
+	defer a.RUnlock()
+	var result = make(map[string]types.Upstream, len(a.upstreams))
+	for id, up := range a.upstreams {
+		result[id] = up
+	}
+	return result
+}
@@ -2,13 +2,15 @@ package app
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"github.com/ironsmile/nedomi/types"
 )
 
 type connections struct {
 	sync.RWMutex
-	conns map[string]types.IncomingConn
+	conns   map[string]types.IncomingConn
+	streams int64 // the HTTP/2 streams being served
 }
 
 func newConnections() *connections {
@@ -23,7 +25,22 @@ func (c *connections) add(conn types.IncomingConn) {
 	c.Unlock()
 }
 
+func (c *connections) addStream() {
+	atomic.AddInt64(&c.streams, 1)
+}
+
+func (c *connections) removeStream() {
+	atomic.AddInt64(&c.streams, -1)
+}
+
+// Streams returns the number of HTTP/2 streams being served.
+func (c *connections) Streams() int {
+	return int(atomic.LoadInt64(&c.streams))
+}
+
 func (c *connections) Size() int {
+	c.RLock()
+	defer c.RUnlock()
 	return len(c.conns)
 }
 
@@ -3,8 +3,10 @@ package app
 import (
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"reflect"
 	"time"
 
 	"github.com/ironsmile/nedomi/cache"
@@ -15,27 +17,42 @@ import (
 	"github.com/ironsmile/nedomi/storage"
 	"github.com/ironsmile/nedomi/types"
 	"github.com/ironsmile/nedomi/upstream"
-	"github.com/ironsmile/nedomi/utils"
 )
 
 func (a *Application) reinitFromConfigInplace(cfg *config.Config, testOnly bool) (toBeResized []string, err error) {
-	var oldCacheZones = a.cacheZones
+	var oldCacheZones, oldZoneTasks = a.cacheZones, a.zoneTasks
+	var oldUpstreams = a.keptUpstreams(cfg)
 	a.cfg = cfg
 	a.virtualHosts = make(map[string]*VirtualHost)
 	a.upstreams = make(map[string]types.Upstream)
 	a.cacheZones = make(map[string]*types.CacheZone)
-	logs := accessLogs{"": nil}
+	a.zoneTasks = make(map[string]*zoneTasks)
+	a.oldLocationStats, a.locationStats = a.locationStats, make(map[string]*types.LocationStats)
+	defer func() { a.oldLocationStats = nil }()
+	a.openLogs = nil
+	logs := newAccessLogs()
+	defer func() { a.openLogs = append(a.openLogs, logs.closers()...) }()
 	// Initialize the global logger
 	var l types.Logger
 	if l, err = logger.New(&a.cfg.Logger); err != nil {
 		return nil, err
 	}
+	a.addOpenLog(l)
 
 	a.SetLogger(l)
+	if a.tlsSettings, err = newTLSSettings(cfg); err != nil {
+		return nil, err
+	}
+	if a.realIP, err = newRealIP(&cfg.HTTP.RealIP); err != nil {
+		return nil, err
+	}
 	// Initialize all cache zones
 	for _, cfgCz := range a.cfg.CacheZones {
 		if zone, ok := oldCacheZones[cfgCz.ID]; ok {
 			a.cacheZones[cfgCz.ID] = zone
+			if tasks, ok := oldZoneTasks[cfgCz.ID]; ok {
+				a.zoneTasks[cfgCz.ID] = tasks
+			}
 			toBeResized = append(toBeResized, cfgCz.ID)
 			continue
 		}
@@ -46,14 +63,20 @@ func (a *Application) reinitFromConfigInplace(cfg *config.Config, testOnly bool)
 
 	// Initialize all advanced upstreams
 	for _, cfgUp := range a.cfg.HTTP.Upstreams {
-		if a.upstreams[cfgUp.ID], err = upstream.New(cfgUp, l); err != nil {
+		if up, ok := oldUpstreams[cfgUp.ID]; ok {
+			a.upstreams[cfgUp.ID] = up
+			continue
+		}
+		up, err := upstream.New(cfgUp, l)
+		if err != nil {
 			return nil, err
 		}
+		a.upstreams[cfgUp.ID] = up
 	}
 
 	a.notConfiguredHandler = newNotConfiguredHandler()
-	var accessLog io.Writer
-	if accessLog, err = logs.openAccessLog(a.cfg.HTTP.AccessLog); err != nil {
+	var accessLog *accessLog
+	if accessLog, err = logs.openAccessLog(a.cfg.HTTP.AccessLogSettings); err != nil {
 		return nil, err
 	}
 	a.notConfiguredHandler, _ = loggingHandler(a.notConfiguredHandler, accessLog, false)
@@ -70,22 +93,46 @@ func (a *Application) reinitFromConfigInplace(cfg *config.Config, testOnly bool)
 func (a *Application) reinitFromConfig(cfg *config.Config, testOnly bool) (err error) {
 	app := a.copy()
 	toBeResized, err := app.reinitFromConfigInplace(cfg, testOnly)
-	if err != nil {
+	var sockets map[string]net.Listener
+	if err == nil && !testOnly {
+		sockets, err = a.openSockets(app.cfg)
+	}
+	if err != nil || testOnly {
+		for id, up := range app.upstreams {
+			if a.upstreams[id] != up {
+				up.Stop()
+			}
+		}
+		stopZoneTasks(app.zoneTasks, a.zoneTasks)
+		a.closeLogs(app.openLogs)
 		return err
 	}
-	if testOnly {
-		return nil
-	}
 	a.Lock()
 	defer a.Unlock()
 	a.cfg = app.cfg
 	a.SetLogger(app.GetLogger())
 	a.virtualHosts = app.virtualHosts
+	for id, up := range a.upstreams { // the changed ones are created with the new settings
+		if app.upstreams[id] != up {
+			up.Stop()
+		}
+	}
+	for id, up := range app.upstreams {
+		if a.upstreams[id] == up {
+			up.SetLogger(app.GetLogger())
+		}
+	}
 	a.upstreams = app.upstreams
+	a.tlsSettings = app.tlsSettings
+	a.realIP = app.realIP
+	a.updateListeners(sockets)
 	a.notConfiguredHandler = app.notConfiguredHandler
+	a.locationStats = app.locationStats
 	for id := range a.cacheZones { // clean the cacheZones
 		delete(a.cacheZones, id)
 	}
+	stopZoneTasks(a.zoneTasks, app.zoneTasks) // of the removed zones
+	a.zoneTasks = app.zoneTasks
 	for _, id := range toBeResized { // resize the to be resized
 		var cfgCz = app.cfg.CacheZones[id]
 		var zone = app.cacheZones[id]
@@ -93,14 +140,58 @@ func (a *Application) reinitFromConfig(cfg *config.Config, testOnly bool) (err e
 		zone.Scheduler.SetLogger(app.GetLogger())
 		zone.Algorithm.SetLogger(app.GetLogger())
 		zone.Algorithm.ChangeConfig(cfgCz.BulkRemoveTimeout, cfgCz.BulkRemoveCount, cfgCz.StorageObjects)
+		if tasks, ok := a.zoneTasks[id]; ok {
+			tasks.setSnapshotInterval(a, id, time.Duration(cfgCz.SnapshotInterval)*time.Second)
+		}
 	}
 	for id, zone := range app.cacheZones { // copy everything
 		a.cacheZones[id] = zone
 	}
+	a.closeLogs(a.openLogs) // the files which are still used stay open
+	a.openLogs = app.openLogs
 
 	return nil
 }
 
+// addOpenLog adds the logger to the ones to be closed when the configuration
+// is replaced if it has files or connections to close.
+func (a *Application) addOpenLog(l types.Logger) {
+	if c, ok := l.(io.Closer); ok {
+		a.openLogs = append(a.openLogs, c)
+	}
+}
+
+// closeLogs closes the loggers and the log files in the reverse order of
+// their opening.
+func (a *Application) closeLogs(logs []io.Closer) {
+	for i := len(logs) - 1; i >= 0; i-- {
+		if err := logs[i].Close(); err != nil {
+			a.GetLogger().Errorf("Error closing log: %s", err)
+		}
+	}
+}
+
+// keptUpstreams returns the advanced upstreams which are kept with their
+// health, retry budget and balancing state because their config is the same
+// in cfg.
+func (a *Application) keptUpstreams(cfg *config.Config) map[string]types.Upstream {
+	var kept = make(map[string]types.Upstream)
+	if a.cfg == nil || a.cfg.HTTP == nil || cfg.HTTP == nil {
+		return kept
+	}
+	var oldCfgs = make(map[string]*config.Upstream, len(a.cfg.HTTP.Upstreams))
+	for _, cfgUp := range a.cfg.HTTP.Upstreams {
+		oldCfgs[cfgUp.ID] = cfgUp
+	}
+	for _, cfgUp := range cfg.HTTP.Upstreams {
+		up, ok := a.upstreams[cfgUp.ID]
+		if ok && reflect.DeepEqual(oldCfgs[cfgUp.ID], cfgUp) {
+			kept[cfgUp.ID] = up
+		}
+	}
+	return kept
+}
+
 func (a *Application) initCacheZone(cfgCz *config.CacheZone, testOnly bool) (err error) {
 	cz := &types.CacheZone{
 		ID:        cfgCz.ID,
@@ -114,13 +205,16 @@ func (a *Application) initCacheZone(cfgCz *config.CacheZone, testOnly bool) (err
 	}
 
 	// Initialize the cache algorithm
-	if cz.Algorithm, err = cache.New(cfgCz, cz.Storage.DiscardPart, a.GetLogger()); err != nil {
+	var removeFunc = countEvictions(cz.ID, cz.Storage.DiscardPart)
+	if cz.Algorithm, err = cache.New(cfgCz, removeFunc, a.GetLogger()); err != nil {
 		return fmt.Errorf("Could not initialize algorithm '%s' for cache zone '%s': %s",
 			cfgCz.Algorithm, cfgCz.ID, err)
 	}
 
 	if !testOnly {
-		a.reloadCache(cz)
+		var tasks = newZoneTasks(a.ctx, cfgCz)
+		a.zoneTasks[cfgCz.ID] = tasks
+		a.reloadCache(cz, cfgCz, tasks)
 	}
 
 	a.cacheZones[cfgCz.ID] = cz
@@ -149,10 +243,10 @@ func (a *Application) getUpstream(upID string) (types.Upstream, error) {
 	return nil, fmt.Errorf("Invalid upstream %s", upID)
 }
 
-func (a *Application) initVirtualHost(cfgVhost *config.VirtualHost, logs accessLogs) (err error) {
-	var accessLog io.Writer
+func (a *Application) initVirtualHost(cfgVhost *config.VirtualHost, logs *accessLogs) (err error) {
+	var accessLog *accessLog
 	if cfgVhost.AccessLog != "" {
-		if accessLog, err = logs.openAccessLog(cfgVhost.AccessLog); err != nil {
+		if accessLog, err = logs.openAccessLog(cfgVhost.AccessLogSettings); err != nil {
 			return fmt.Errorf("error opening access log for virtual host %s - %s",
 				cfgVhost.Name, err)
 		}
@@ -164,6 +258,7 @@ func (a *Application) initVirtualHost(cfgVhost *config.VirtualHost, logs accessL
 			CacheKey:              cfgVhost.CacheKey,
 			CacheKeyIncludesQuery: cfgVhost.CacheKeyIncludesQuery,
 			CacheDefaultDuration:  cfgVhost.CacheDefaultDuration,
+			Stats:                 a.locationStatsFor(cfgVhost.Name, cfgVhost.Name),
 		},
 	}
 	if vhost.Upstream, err = a.getUpstream(cfgVhost.Upstream); err != nil {
@@ -183,9 +278,10 @@ func (a *Application) initVirtualHost(cfgVhost *config.VirtualHost, logs accessL
 		a.virtualHosts[alias] = &vhost
 	}
 
-	if vhost.Logger, err = logger.New(&cfgVhost.Logger); err != nil {
+	if vhost.Logger, err = logger.NewOverridable(&cfgVhost.Logger, cfgVhost.Name); err != nil {
 		return err
 	}
+	a.addOpenLog(vhost.Logger)
 
 	if cfgVhost.CacheZone != nil {
 		cz, ok := a.cacheZones[cfgVhost.CacheZone.ID]
@@ -198,19 +294,18 @@ func (a *Application) initVirtualHost(cfgVhost *config.VirtualHost, logs accessL
 	if vhost.Handler, err = chainHandlers(&vhost.Location, &cfgVhost.Location, accessLog); err != nil {
 		return err
 	}
-	var locations []*types.Location
-	if locations, err = a.initFromConfigLocationsForVHost(cfgVhost.Locations, accessLog); err != nil {
+	if vhost.Locations, err = a.initFromConfigLocationsForVHost(cfgVhost.Name, cfgVhost.Locations, accessLog); err != nil {
 		return err
 	}
 
-	if vhost.Muxer, err = NewLocationMuxer(locations); err != nil {
+	if vhost.Muxer, err = NewLocationMuxer(vhost.Locations); err != nil {
 		return fmt.Errorf("Could not create location muxer for vhost %s - %s", cfgVhost.Name, err)
 	}
 
 	return nil
 }
 
-func (a *Application) initFromConfigLocationsForVHost(cfgLocations []*config.Location, accessLog io.Writer) ([]*types.Location, error) {
+func (a *Application) initFromConfigLocationsForVHost(vhostName string, cfgLocations []*config.Location, accessLog *accessLog) ([]*types.Location, error) {
 	var err error
 	var locations = make([]*types.Location, len(cfgLocations))
 	for index, locCfg := range cfgLocations {
@@ -219,14 +314,17 @@ func (a *Application) initFromConfigLocationsForVHost(cfgLocations []*config.Loc
 			CacheKey:              locCfg.CacheKey,
 			CacheKeyIncludesQuery: locCfg.CacheKeyIncludesQuery,
 			CacheDefaultDuration:  locCfg.CacheDefaultDuration,
+			Stats:                 a.locationStatsFor(vhostName, locCfg.Name),
 		}
 		if locations[index].Upstream, err = a.getUpstream(locCfg.Upstream); err != nil {
 			return nil, err
 		}
 
-		if locations[index].Logger, err = logger.New(&locCfg.Logger); err != nil {
+		if locations[index].Logger, err = logger.NewOverridable(&locCfg.Logger,
+			vhostName+" "+locCfg.Name); err != nil {
 			return nil, err
 		}
+		a.addOpenLog(locations[index].Logger)
 
 		if locCfg.CacheZone != nil {
 			cz, ok := a.cacheZones[locCfg.CacheZone.ID]
@@ -245,71 +343,7 @@ func (a *Application) initFromConfigLocationsForVHost(cfgLocations []*config.Loc
 	return locations, nil
 }
 
-func (a *Application) reloadCache(cz *types.CacheZone) {
-	counter := 0
-	callback := func(obj *types.ObjectMetadata, parts ...*types.ObjectIndex) bool {
-		counter++
-		//!TODO: remove hardcoded periods and timeout, get them from config
-		if counter%100 == 0 {
-			select {
-			case <-a.ctx.Done():
-				return false
-			case <-time.After(100 * time.Millisecond):
-			}
-		}
-
-		if !utils.IsMetadataFresh(obj) {
-			if err := cz.Storage.Discard(obj.ID); err != nil {
-				a.GetLogger().Errorf("Error for cache zone `%s` on discarding objID `%s` in reloadCache: %s", cz.ID, obj.ID, err)
-			}
-		} else {
-			cz.Scheduler.AddEvent(
-				obj.ID.Hash(),
-				storage.GetExpirationHandler(cz, obj.ID),
-				//!TODO: Maybe do not use time.Now but cached time. See the todo comment
-				// in utils.IsMetadataFresh.
-				time.Unix(obj.ExpiresAt, 0).Sub(time.Now()),
-			)
-
-			for _, idx := range parts {
-				if err := cz.Algorithm.AddObject(idx); err != nil && err != types.ErrAlreadyInCache {
-					a.GetLogger().Errorf("Error for cache zone `%s` on adding objID `%s` in reloadCache: %s", cz.ID, obj.ID, err)
-				}
-			}
-		}
-
-		return true
-	}
-
-	go func() {
-		var ch = make(chan struct{})
-		defer close(ch)
-		go func() {
-			const tick = 10 * time.Second
-
-			var ticker = time.NewTicker(tick)
-			var ticks int64
-			defer ticker.Stop()
-			for {
-				select {
-				case <-ticker.C:
-					ticks++
-					a.GetLogger().Logf("Storage reload for cache zone `%s` has reloaded %d for %s and is still going", cz.ID, counter, time.Duration(ticks)*tick)
-				case <-ch:
-					return
-				}
-			}
-		}()
-		a.GetLogger().Logf("Start storage reload for cache zone `%s`", cz.ID)
-		if err := cz.Storage.Iterate(callback); err != nil {
-			a.GetLogger().Errorf("For cache zone `%s` received iterator error '%s' after loading %d objects", cz.ID, err, counter)
-		} else {
-			a.GetLogger().Logf("Loading contents from disk for cache zone `%s` finished: %d objects loaded!", cz.ID, counter)
-		}
-	}()
-}
-
-func chainHandlers(location *types.Location, locCfg *config.Location, accessLog io.Writer) (http.Handler, error) {
+func chainHandlers(location *types.Location, locCfg *config.Location, accessLog *accessLog) (http.Handler, error) {
 	var res http.Handler
 	var err error
 	var handlers = locCfg.Handlers
@@ -327,7 +361,7 @@ func chainHandlers(location *types.Location, locCfg *config.Location, accessLog
 
 // loggingHandler will write to accessLog each and every request to it while proxing
 // it to next
-func loggingHandler(next http.Handler, accessLog io.Writer, knownVhost bool) (
+func loggingHandler(next http.Handler, accessLog *accessLog, knownVhost bool) (
 	http.Handler,
 	error,
 ) {
@@ -353,10 +387,23 @@ func loggingHandler(next http.Handler, accessLog io.Writer, knownVhost bool) (
 				vhostID += unknownVhostLogSuffix
 			}
 
+			info := new(types.AccessInfo)
+			r = r.WithContext(contexts.NewAccessInfoContext(r.Context(), info))
 			defer func(vhostID string) {
-				go func() {
-					writeLog(accessLog, r, vhostID, reqID, url, t, l.Status(), l.Size())
-				}()
+				var entry = &accessLogEntry{
+					req:                    r,
+					vhost:                  vhostName(r.Host),
+					locationIdentification: vhostID,
+					reqID:                  reqID,
+					url:                    url,
+					ts:                     t,
+					duration:               time.Since(t),
+					ttfb:                   l.TimeToFirstByte(t),
+					status:                 l.Status(),
+					size:                   l.Size(),
+					info:                   info,
+				}
+				accessLog.log(entry)
 			}(vhostID)
 			next.ServeHTTP(l, r)
 		}), nil
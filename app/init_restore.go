@@ -0,0 +1,299 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/storage"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils"
+)
+
+// reloadCache restores the state of the cache zone from its storage in the
+// background. If the cache algorithm supports snapshots, its last snapshot is
+// loaded first so that the restored objects keep their places in the cache
+// and after the restore the snapshot is saved periodically.
+func (a *Application) reloadCache(cz *types.CacheZone, cfgCz *config.CacheZone, tasks *zoneTasks) {
+	var (
+		counter uint64
+		limiter = newRestoreLimiter(tasks.ctx, cfgCz.RestoreRate)
+	)
+	callback := func(obj *types.ObjectMetadata, parts ...*types.ObjectIndex) bool {
+		if !limiter.wait() {
+			return false
+		}
+		atomic.AddUint64(&counter, 1)
+
+		if !utils.IsMetadataFresh(obj) {
+			if err := cz.Storage.Discard(obj.ID); err != nil {
+				a.GetLogger().Errorf("Error for cache zone `%s` on discarding objID `%s` in reloadCache: %s", cz.ID, obj.ID, err)
+			}
+		} else {
+			cz.Scheduler.AddEvent(
+				obj.ID.Hash(),
+				storage.GetExpirationHandler(cz, obj.ID),
+				//!TODO: Maybe do not use time.Now but cached time. See the todo comment
+				// in utils.IsMetadataFresh.
+				time.Unix(obj.ExpiresAt, 0).Sub(time.Now()),
+			)
+
+			for _, idx := range parts {
+				size := utils.PartSize(obj, idx.Part, cz.Storage.PartSize())
+				if err := cz.Algorithm.AddObject(idx, size); err != nil && err != types.ErrAlreadyInCache {
+					a.GetLogger().Errorf("Error for cache zone `%s` on adding objID `%s` in reloadCache: %s", cz.ID, obj.ID, err)
+				}
+			}
+		}
+
+		return true
+	}
+
+	go func() {
+		defer limiter.stop()
+		var ch = make(chan struct{})
+		go func() {
+			const tick = 10 * time.Second
+
+			var ticker = time.NewTicker(tick)
+			var ticks int64
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					ticks++
+					a.GetLogger().Logf("Storage reload for cache zone `%s` has reloaded %d for %s and is still going", cz.ID, atomic.LoadUint64(&counter), time.Duration(ticks)*tick)
+				case <-ch:
+					return
+				}
+			}
+		}()
+
+		snapshotter, hasSnapshots := cz.Algorithm.(types.CacheSnapshotter)
+		if hasSnapshots {
+			if err := snapshotter.LoadSnapshot(); err != nil {
+				a.GetLogger().Errorf("Could not load the cache snapshot for cache zone `%s`: %s", cz.ID, err)
+			}
+		}
+
+		a.GetLogger().Logf("Start storage reload for cache zone `%s` with %d workers", cz.ID, cfgCz.RestoreWorkers)
+		err := iterateStorage(cz.Storage, int(cfgCz.RestoreWorkers), callback)
+		close(ch)
+		if hasSnapshots {
+			snapshotter.RestoreFinished()
+		}
+		if err != nil {
+			a.GetLogger().Errorf("For cache zone `%s` received iterator error '%s' after loading %d objects", cz.ID, err, atomic.LoadUint64(&counter))
+		} else {
+			a.GetLogger().Logf("Loading contents from disk for cache zone `%s` finished: %d objects loaded!", cz.ID, atomic.LoadUint64(&counter))
+		}
+
+		// An interrupted restore should not overwrite the last good snapshot
+		if hasSnapshots && tasks.ctx.Err() == nil {
+			tasks.startSnapshots(a, cz.ID, snapshotter)
+		}
+	}()
+}
+
+// zoneTasks are the background tasks of a cache zone - the restore from its
+// storage and after it the periodic snapshots of its algorithm. They are
+// stopped when the zone is removed from the config or the application is
+// stopped.
+type zoneTasks struct {
+	ctx    context.Context
+	cancel func()
+
+	mutex         sync.Mutex
+	interval      time.Duration
+	snapshotter   types.CacheSnapshotter // set after the restore
+	stopSnapshots func()
+}
+
+func newZoneTasks(ctx context.Context, cfgCz *config.CacheZone) *zoneTasks {
+	var tasks = &zoneTasks{interval: time.Duration(cfgCz.SnapshotInterval) * time.Second}
+	tasks.ctx, tasks.cancel = context.WithCancel(ctx)
+	return tasks
+}
+
+// startSnapshots starts saving the snapshots of the restored zone.
+func (t *zoneTasks) startSnapshots(a *Application, id string, snapshotter types.CacheSnapshotter) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.snapshotter = snapshotter
+	t.restartSnapshots(a, id)
+}
+
+// setSnapshotInterval changes the interval of the snapshots of a zone which
+// was kept on reload.
+func (t *zoneTasks) setSnapshotInterval(a *Application, id string, interval time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.interval == interval {
+		return
+	}
+	t.interval = interval
+	if t.snapshotter != nil {
+		t.restartSnapshots(a, id)
+	}
+}
+
+// restartSnapshots must be called with the mutex held.
+func (t *zoneTasks) restartSnapshots(a *Application, id string) {
+	if t.stopSnapshots != nil {
+		t.stopSnapshots()
+		t.stopSnapshots = nil
+	}
+	if t.interval <= 0 {
+		return
+	}
+	var ctx context.Context
+	ctx, t.stopSnapshots = context.WithCancel(t.ctx)
+	go a.saveCacheSnapshots(ctx, id, t.snapshotter, t.interval)
+}
+
+// saveCacheSnapshots saves the snapshot of the cache algorithm every interval
+// until the context is done.
+func (a *Application) saveCacheSnapshots(ctx context.Context, id string, snapshotter types.CacheSnapshotter, interval time.Duration) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := snapshotter.SaveSnapshot(); err != nil {
+				a.GetLogger().Errorf("Could not save the cache snapshot for cache zone `%s`: %s", id, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stopZoneTasks stops the tasks of the zones which are not in kept.
+func stopZoneTasks(tasks, kept map[string]*zoneTasks) {
+	for id, t := range tasks {
+		if kept[id] != t {
+			t.cancel()
+		}
+	}
+}
+
+// iterateStorage calls stor.Iterate with the callback. If the storage is
+// partitioned its partitions are iterated by the given number of workers in
+// parallel and the callback may be called concurrently.
+func iterateStorage(stor types.Storage, workers int, callback func(*types.ObjectMetadata, ...*types.ObjectIndex) bool) error {
+	partitioned, ok := stor.(types.PartitionedStorage)
+	if !ok || workers < 2 {
+		return stor.Iterate(callback)
+	}
+
+	var (
+		stopped    int32
+		wg         sync.WaitGroup
+		errsLock   sync.Mutex
+		errs       []error
+		partitions = make(chan int)
+	)
+	wrapped := func(obj *types.ObjectMetadata, parts ...*types.ObjectIndex) bool {
+		if atomic.LoadInt32(&stopped) != 0 {
+			return false
+		}
+		if !callback(obj, parts...) {
+			atomic.StoreInt32(&stopped, 1)
+			return false
+		}
+		return true
+	}
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for partition := range partitions {
+				if err := partitioned.IteratePartition(partition, wrapped); err != nil {
+					errsLock.Lock()
+					errs = append(errs, err)
+					errsLock.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < partitioned.Partitions() && atomic.LoadInt32(&stopped) == 0; i++ {
+		partitions <- i
+	}
+	close(partitions)
+	wg.Wait()
+
+	return utils.NewCompositeError(errs...)
+}
+
+// restoreLimiterTick is how often the restoreLimiter gives out new tokens
+const restoreLimiterTick = 10 * time.Millisecond
+
+// restoreLimiter limits the number of objects per second which are restored
+// from the storage. It is shared between all of the restoring workers.
+type restoreLimiter struct {
+	ctx    context.Context
+	stop   func()
+	tokens chan struct{}
+}
+
+// newRestoreLimiter returns a restoreLimiter which allows rate objects per
+// second. A rate of 0 means no limit. The limiter stops working when the
+// context is done.
+func newRestoreLimiter(ctx context.Context, rate uint64) *restoreLimiter {
+	var l = new(restoreLimiter)
+	l.ctx, l.stop = context.WithCancel(ctx)
+	if rate == 0 {
+		return l
+	}
+
+	// at least one token fits so that rates lower than one per tick work
+	var burst = (rate*uint64(restoreLimiterTick) + uint64(time.Second) - 1) / uint64(time.Second)
+	l.tokens = make(chan struct{}, burst)
+	go l.refill(restoreLimiterTick, rate)
+	return l
+}
+
+// refill gives out rate tokens per second. The fractions of tokens which are
+// due every tick are carried over to the next ones so that no rate is rounded
+// down to the tick.
+func (l *restoreLimiter) refill(tick time.Duration, rate uint64) {
+	var ticker = time.NewTicker(tick)
+	defer ticker.Stop()
+	var due uint64 // in tokens multiplied by a second
+	for {
+		select {
+		case <-ticker.C:
+			due += rate * uint64(tick)
+			var tokens = due / uint64(time.Second)
+			due %= uint64(time.Second)
+		fill:
+			for i := uint64(0); i < tokens; i++ {
+				select {
+				case l.tokens <- struct{}{}:
+				default:
+					break fill
+				}
+			}
+		case <-l.ctx.Done():
+			return
+		}
+	}
+}
+
+// wait blocks until the next object may be restored. It returns false if the
+// restore should be stopped.
+func (l *restoreLimiter) wait() bool {
+	if l.tokens == nil || l.ctx.Err() != nil {
+		return l.ctx.Err() == nil
+	}
+	select {
+	case <-l.tokens:
+		return true
+	case <-l.ctx.Done():
+		return false
+	}
+}
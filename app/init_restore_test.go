@@ -1,10 +1,13 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -78,3 +81,149 @@ func TestDiskReload(t *testing.T) {
 		t.Errorf("Expected object count in cache to be %d but it was %d", expectedObjects, cacheObjects)
 	}
 }
+
+func TestParallelStorageIteration(t *testing.T) {
+	t.Parallel()
+	tempDir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+
+	stor, err := disk.New(&config.CacheZone{Path: tempDir, PartSize: 10}, mock.NewLogger())
+	if err != nil {
+		t.Fatalf("Could not initialize a storage: %s", err)
+	}
+
+	const objects = 50
+	for i := 0; i < objects; i++ {
+		testutils.ShouldntFail(t, stor.SaveMetadata(&types.ObjectMetadata{
+			ID:        types.NewObjectID("key", fmt.Sprintf("/obj/%d", i)),
+			ExpiresAt: time.Now().Unix() + 600,
+		}))
+	}
+
+	var (
+		lock sync.Mutex
+		seen = make(map[types.ObjectIDHash]int)
+	)
+	err = iterateStorage(stor, 4, func(obj *types.ObjectMetadata, _ ...*types.ObjectIndex) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		seen[obj.ID.Hash()]++
+		return true
+	})
+	if err != nil {
+		t.Errorf("Unexpected iteration error: %s", err)
+	}
+	if len(seen) != objects {
+		t.Errorf("Expected %d objects to be iterated but got %d", objects, len(seen))
+	}
+	for hash, count := range seen {
+		if count != 1 {
+			t.Errorf("Object %x was iterated %d times", hash, count)
+		}
+	}
+
+	var counter int
+	err = iterateStorage(stor, 4, func(obj *types.ObjectMetadata, _ ...*types.ObjectIndex) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		counter++
+		return false
+	})
+	if err != nil {
+		t.Errorf("Unexpected iteration error: %s", err)
+	}
+	if counter > 4 {
+		t.Errorf("Expected the iteration to stop but it went through %d objects", counter)
+	}
+}
+
+func TestRestoreLimiter(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var unlimited = newRestoreLimiter(ctx, 0)
+	for i := 0; i < 1000; i++ {
+		if !unlimited.wait() {
+			t.Fatal("The unlimited limiter should not stop before the context is done")
+		}
+	}
+
+	var limiters []*restoreLimiter
+	// 150 is not a multiple of the tokens per tick
+	for _, rate := range []int{500, 150} {
+		var (
+			limited = newRestoreLimiter(ctx, uint64(rate))
+			start   = time.Now()
+		)
+		limiters = append(limiters, limited)
+		for i := 0; i < rate/2; i++ {
+			if !limited.wait() {
+				t.Fatal("The limiter should not stop before the context is done")
+			}
+		}
+		if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 700*time.Millisecond {
+			t.Errorf("Expected %d objects with rate %d to take about 500ms but took %s",
+				rate/2, rate, elapsed)
+		}
+	}
+
+	cancel()
+	if unlimited.wait() {
+		t.Error("The unlimited limiter should stop after the context is done")
+	}
+	for _, limited := range limiters {
+		if limited.wait() {
+			t.Error("The limiters should stop after the context is done")
+		}
+	}
+}
+
+type countingSnapshotter struct {
+	types.CacheAlgorithm
+	saves int32
+}
+
+func (c *countingSnapshotter) SaveSnapshot() error {
+	atomic.AddInt32(&c.saves, 1)
+	return nil
+}
+
+func (c *countingSnapshotter) LoadSnapshot() error { return nil }
+
+func (c *countingSnapshotter) RestoreFinished() {}
+
+func TestZoneTasks(t *testing.T) {
+	t.Parallel()
+	var app = &Application{}
+	app.SetLogger(mock.NewLogger())
+	var (
+		snapshotter = new(countingSnapshotter)
+		tasks       = newZoneTasks(context.Background(), &config.CacheZone{})
+		saves       = func() int32 { return atomic.LoadInt32(&snapshotter.saves) }
+	)
+
+	// no snapshots without an interval
+	tasks.startSnapshots(app, "test", snapshotter)
+	time.Sleep(50 * time.Millisecond)
+	if saves() != 0 {
+		t.Errorf("Expected no snapshots without an interval but there were %d", saves())
+	}
+
+	tasks.setSnapshotInterval(app, "test", 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if saves() == 0 {
+		t.Error("Expected snapshots after the interval was set")
+	}
+
+	// the zone is removed
+	stopZoneTasks(map[string]*zoneTasks{"test": tasks}, map[string]*zoneTasks{})
+	if tasks.ctx.Err() == nil {
+		t.Error("Expected the tasks of the removed zone to be stopped")
+	}
+	time.Sleep(20 * time.Millisecond)
+	var stopped = saves()
+	time.Sleep(50 * time.Millisecond)
+	if saves() != stopped {
+		t.Errorf("Expected no snapshots after the zone was removed but there were %d", saves()-stopped)
+	}
+}
@@ -105,6 +105,114 @@ func TestReinit(t *testing.T) {
 	}
 }
 
+type countingCloser int
+
+func (c *countingCloser) Close() error {
+	*c++
+	return nil
+}
+
+func TestReinitClosesLogs(t *testing.T) {
+	t.Parallel()
+
+	app, cleanup := appFromExampleConfig(t)
+	defer cleanup()
+	var closer countingCloser
+	app.openLogs = append(app.openLogs, &closer)
+
+	cfg := *app.cfg
+	cfg.Logger = *config.NewLogger("bogus_logger", nil)
+	if err := app.reinitFromConfig(&cfg, false); err == nil {
+		t.Fatal("Expected an error for the unknown logger")
+	}
+	if closer != 0 {
+		t.Error("Expected the logs to be kept after a failed reinit")
+	}
+
+	if err := app.reinitFromConfig(app.cfg, false); err != nil {
+		t.Fatalf("Error upon reiniting app: %s", err)
+	}
+	if closer != 1 {
+		t.Errorf("Expected the old logs to be closed once after the reinit but they were closed %d times", closer)
+	}
+	for _, l := range app.openLogs {
+		if l == &closer {
+			t.Error("Expected the closed logs to be replaced")
+		}
+	}
+}
+
+func TestReinitKeepsUnchangedUpstreams(t *testing.T) {
+	t.Parallel()
+
+	app, cleanup := appFromExampleConfig(t)
+	defer cleanup()
+	var old = app.upstreams["ucdn"]
+	if old == nil {
+		t.Fatal("No ucdn upstream in the example config")
+	}
+
+	cfg := *app.cfg
+	if err := app.reinitFromConfig(&cfg, false); err != nil {
+		t.Fatalf("Error upon reiniting app: %s", err)
+	}
+	if app.upstreams["ucdn"] != old {
+		t.Error("The upstream was replaced although its config is the same")
+	}
+
+	changedCfg := cfg
+	httpCfg := *cfg.HTTP
+	changed := *httpCfg.Upstreams[0]
+	changed.Settings.Retries++
+	httpCfg.Upstreams = []*config.Upstream{&changed}
+	changedCfg.HTTP = &httpCfg
+	if err := app.reinitFromConfig(&changedCfg, false); err != nil {
+		t.Fatalf("Error upon reiniting app: %s", err)
+	}
+	if app.upstreams["ucdn"] == old {
+		t.Error("The upstream was kept although its config is changed")
+	}
+}
+
+func TestReinitKeepsOnlyConfiguredLocationStats(t *testing.T) {
+	t.Parallel()
+
+	app, cleanup := appFromExampleConfig(t)
+	defer cleanup()
+	var vhost = app.cfg.HTTP.Servers[0].Name
+	var key = vhost + " " + vhost
+	var stats = app.locationStats[key]
+	if stats == nil {
+		t.Fatalf("No stats for %s", key)
+	}
+	var count = len(app.locationStats)
+
+	cfg := *app.cfg
+	if err := app.reinitFromConfig(&cfg, false); err != nil {
+		t.Fatalf("Error upon reiniting app: %s", err)
+	}
+	if app.locationStats[key] != stats || len(app.locationStats) != count {
+		t.Error("The stats of the locations were not kept on reload")
+	}
+
+	removedCfg := cfg
+	httpCfg := *cfg.HTTP
+	httpCfg.Servers = httpCfg.Servers[1:]
+	removedCfg.HTTP = &httpCfg
+	if err := app.reinitFromConfig(&removedCfg, true); err != nil {
+		t.Fatalf("Error upon checking the config: %s", err)
+	}
+	if app.locationStats[key] != stats || len(app.locationStats) != count {
+		t.Error("The stats of the locations were changed by the config check")
+	}
+	if err := app.reinitFromConfig(&removedCfg, false); err != nil {
+		t.Fatalf("Error upon reiniting app: %s", err)
+	}
+	if _, ok := app.locationStats[key]; ok || len(app.locationStats) >= count {
+		t.Errorf("The stats of the removed virtual host %s were kept", vhost)
+	}
+}
+
 func replaceZone(cfg *config.Config, id string, newZone *config.CacheZone) {
 	delete(cfg.CacheZones, id)
 	for _, server := range cfg.HTTP.Servers {
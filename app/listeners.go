@@ -0,0 +1,286 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/netutils"
+)
+
+// listener is one of the configured listeners. The listeners from the config
+// on startup are served by gracehttp and the ones added by reloads are served
+// by the application itself.
+type listener struct {
+	net.Listener
+	socket  net.Listener    // the socket wrapped by Listener
+	cfg     config.Listener // guarded by the application lock
+	srv     *http.Server
+	owned   bool // served by the application
+	removed int32
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newListener(cfg config.Listener, owned bool) *listener {
+	return &listener{cfg: cfg, owned: owned, done: make(chan struct{})}
+}
+
+// Accept waits for the next connection. After the listener is removed by a
+// reload it blocks until the listener is closed if it is served by gracehttp
+// which expects its servers to run until it stops them.
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil && !l.owned && atomic.LoadInt32(&l.removed) == 1 {
+		<-l.done
+	}
+	return conn, err
+}
+
+// Close closes the listener for good.
+func (l *listener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.done)
+		if atomic.LoadInt32(&l.removed) == 0 {
+			err = l.Listener.Close()
+		}
+	})
+	return err
+}
+
+// remove stops accepting connections on the listener. The connections which
+// were already accepted are not interrupted.
+func (l *listener) remove() error {
+	if l.Listener == nil { // gracehttp has not opened it yet
+		return nil
+	}
+	if l.owned {
+		return l.Close()
+	}
+	if !atomic.CompareAndSwapInt32(&l.removed, 0, 1) {
+		return nil
+	}
+	return l.Listener.Close()
+}
+
+// dupSocket returns a new listener on the socket of the listener. It keeps
+// the socket open after the listener is closed.
+func (l *listener) dupSocket() (net.Listener, error) {
+	socket, ok := l.socket.(interface {
+		File() (*os.File, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("the socket on %s can not be shared", l.cfg.Address)
+	}
+	file, err := socket.File()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return net.FileListener(file)
+}
+
+// wrap wraps the socket so that the connections from it have per IO timeouts,
+// the client addresses from their PROXY protocol headers and are TLS
+// connections if the listener is for TLS.
+func (a *Application) wrap(l *listener, socket net.Listener) {
+	l.socket = socket
+	if l.cfg.ProxyProtocol {
+		trusted, _ := netutils.ParseIPNets(l.cfg.ProxyProtocolTrusted) // validated with the config
+		socket = netutils.NewProxyProtocolListener(socket, trusted,
+			time.Duration(l.cfg.ReadTimeout)*time.Second)
+	}
+	var wrapped = netutils.DeadlineToTimeoutListenerConstructor(
+		int64(a.cfg.HTTP.MaxIOTransferSize),
+		int64(a.cfg.HTTP.MinIOTransferSize),
+	)(socket)
+	if l.cfg.TLS {
+		wrapped = netutils.NewTLSListener(wrapped, a.newTLSConfig(l.cfg.HTTP2))
+	}
+	l.Listener = wrapped
+}
+
+// newServer returns the server for the listener. Only the virtual hosts for
+// the listener are served by it.
+func (a *Application) newServer(l *listener) *http.Server {
+	var srv = &http.Server{
+		Addr:           l.cfg.Address,
+		Handler:        a.listenerHandler(l),
+		ReadTimeout:    time.Duration(l.cfg.ReadTimeout) * time.Second,
+		WriteTimeout:   time.Duration(l.cfg.WriteTimeout) * time.Second,
+		MaxHeaderBytes: a.cfg.HTTP.MaxHeadersSize,
+		ConnState:      a.connState,
+	}
+	if l.cfg.HTTP2 {
+		// over TLS HTTP/2 is used only if the client negotiates it
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetHTTP2(l.cfg.TLS)
+		srv.Protocols.SetUnencryptedHTTP2(!l.cfg.TLS)
+	}
+	return srv
+}
+
+func (a *Application) listenerHandler(l *listener) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		a.serve(w, req, a.getLocationOn(l, req.Host, req.URL.Path))
+	})
+}
+
+// getLocationOn returns the location for the host and path if its virtual
+// host is served on the listener.
+func (a *Application) getLocationOn(l *listener, host, path string) *types.Location {
+	a.RLock()
+	vh, ok := a.virtualHosts[vhostName(host)]
+	ok = ok && l.cfg.Serves(vh.Name)
+	a.RUnlock()
+	if !ok {
+		return nil
+	}
+	return vh.match(path)
+}
+
+// startListeners creates the listeners from the config and returns their
+// servers.
+func (a *Application) startListeners() []*http.Server {
+	a.Lock()
+	defer a.Unlock()
+	a.listeners = make(map[string]*listener)
+	var servers []*http.Server
+	for _, cfg := range a.cfg.HTTP.GetListeners() {
+		var l = newListener(cfg, false)
+		l.srv = a.newServer(l)
+		a.listeners[cfg.Address] = l
+		servers = append(servers, l.srv)
+	}
+	return servers
+}
+
+// wrapGraceListener is the wrapper for the sockets opened by gracehttp. It
+// returns the listener for the socket.
+func (a *Application) wrapGraceListener(socket net.Listener) net.Listener {
+	a.Lock()
+	defer a.Unlock()
+	for _, l := range a.listeners {
+		if l.Listener == nil && netutils.ListensOn(socket, l.cfg.Address) {
+			a.wrap(l, socket)
+			return l
+		}
+	}
+	// should not happen but serve it with the settings of the first listener
+	var l = newListener(a.cfg.HTTP.GetListeners()[0], false)
+	a.wrap(l, socket)
+	return l
+}
+
+// openSockets opens the sockets for the listeners in the config which are
+// not served yet or are served with settings which need a new listener. The
+// socket of a replaced listener is shared by its successor so that no
+// connections are refused while it is replaced. If any socket can not be
+// opened the ones already opened are closed and an error is returned.
+func (a *Application) openSockets(cfg *config.Config) (map[string]net.Listener, error) {
+	a.RLock()
+	defer a.RUnlock()
+	if a.listeners == nil { // not serving yet
+		return nil, nil
+	}
+	var sockets = make(map[string]net.Listener)
+	for _, cfg := range cfg.HTTP.GetListeners() {
+		l, ok := a.listeners[cfg.Address]
+		if ok && l.cfg.SameSocket(&cfg) {
+			continue
+		}
+		var socket net.Listener
+		var err error
+		if ok {
+			socket, err = l.dupSocket()
+		} else {
+			socket, err = net.Listen("tcp", cfg.Address)
+		}
+		if err != nil {
+			closeSockets(sockets)
+			return nil, fmt.Errorf("error listening on %s - %s", cfg.Address, err)
+		}
+		sockets[cfg.Address] = socket
+	}
+	return sockets, nil
+}
+
+func closeSockets(sockets map[string]net.Listener) {
+	for _, socket := range sockets {
+		_ = socket.Close()
+	}
+}
+
+// updateListeners serves the sockets opened by openSockets for the current
+// config and after that removes the listeners which are not in it any more or
+// are replaced. It must be called with the lock held.
+func (a *Application) updateListeners(sockets map[string]net.Listener) {
+	if a.listeners == nil { // not serving yet
+		closeSockets(sockets)
+		return
+	}
+	var (
+		cfgs     = a.cfg.HTTP.GetListeners()
+		inConfig = make(map[string]bool)
+		replaced []*listener
+	)
+	for _, cfg := range cfgs {
+		inConfig[cfg.Address] = true
+		socket, ok := sockets[cfg.Address]
+		if !ok {
+			if l, ok := a.listeners[cfg.Address]; ok {
+				l.cfg = cfg // only its virtual hosts are changed
+			}
+			continue
+		}
+		if old, ok := a.listeners[cfg.Address]; ok {
+			replaced = append(replaced, old)
+		}
+		var l = newListener(cfg, true)
+		a.wrap(l, socket)
+		l.srv = a.newServer(l)
+		a.listeners[cfg.Address] = l
+		a.GetLogger().Logf("Listening on %s", cfg.Address)
+		go a.serveListener(l)
+	}
+	for address, l := range a.listeners {
+		if !inConfig[address] {
+			replaced = append(replaced, l)
+			delete(a.listeners, address)
+		}
+	}
+	for _, l := range replaced {
+		if err := l.remove(); err != nil {
+			a.GetLogger().Errorf("Error closing the listener on %s: %s", l.cfg.Address, err)
+		}
+		a.GetLogger().Logf("Stopped listening on %s", l.cfg.Address)
+	}
+}
+
+func (a *Application) serveListener(l *listener) {
+	var err = l.srv.Serve(l)
+	select {
+	case <-l.done:
+	default:
+		a.GetLogger().Errorf("Serving on %s stopped: %s", l.cfg.Address, err)
+	}
+}
+
+// closeListeners closes the listeners served by the application.
+func (a *Application) closeListeners() {
+	a.Lock()
+	defer a.Unlock()
+	for _, l := range a.listeners {
+		if l.owned {
+			_ = l.Close()
+		}
+	}
+}
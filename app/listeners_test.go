@@ -0,0 +1,277 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/contexts"
+	"github.com/ironsmile/nedomi/mock"
+	"github.com/ironsmile/nedomi/utils/testutils"
+)
+
+func newListenersTestApp(t *testing.T, listeners ...config.Listener) *Application {
+	var app = &Application{
+		cfg:                  &config.Config{HTTP: new(config.HTTP)},
+		ctx:                  context.Background(),
+		stats:                new(applicationStats),
+		conns:                newConnections(),
+		notConfiguredHandler: newNotConfiguredHandler(),
+		virtualHosts:         make(map[string]*VirtualHost),
+		listeners:            make(map[string]*listener),
+	}
+	app.cfg.HTTP.Listeners = listeners
+	app.cfg.HTTP.ReadTimeout, app.cfg.HTTP.WriteTimeout = 10, 10
+	app.SetLogger(mock.NewLogger())
+	for _, name := range []string{"public", "admin"} {
+		muxer, err := NewLocationMuxer(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		app.virtualHosts[name] = &VirtualHost{
+			Location: *newLocationWithHandler(name),
+			Muxer:    muxer,
+		}
+	}
+	return app
+}
+
+// testReloadListeners serves the listeners as a reload with them would.
+func (a *Application) testReloadListeners(t *testing.T, listeners []config.Listener) {
+	var cfg, http = *a.cfg, *a.cfg.HTTP
+	http.Listeners, cfg.HTTP = listeners, &http
+	sockets, err := a.openSockets(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Lock()
+	defer a.Unlock()
+	a.cfg = &cfg
+	a.updateListeners(sockets)
+}
+
+func (a *Application) testGet(t *testing.T, address, host string) (int, string) {
+	a.RLock()
+	var addr = a.listeners[address].Addr().String()
+	a.RUnlock()
+	req, err := http.NewRequest("GET", "http://"+addr+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = host
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestListenersVirtualHosts(t *testing.T) {
+	t.Parallel()
+	const public, internal = "127.0.0.1:0", "127.0.0.2:0"
+	var app = newListenersTestApp(t,
+		config.Listener{Address: public, VirtualHosts: []string{"public"}},
+		config.Listener{Address: internal},
+	)
+	app.testReloadListeners(t, app.cfg.HTTP.Listeners)
+	defer app.closeListeners()
+
+	var tests = []struct {
+		address, host string
+		status        int
+	}{
+		{public, "public", http.StatusOK},
+		{public, "admin", http.StatusNotFound},
+		{internal, "public", http.StatusOK},
+		{internal, "admin", http.StatusOK},
+		{internal, "unknown", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if status, body := app.testGet(t, test.address, test.host); status != test.status {
+			t.Errorf("expected %d for %s on %s got %d %q",
+				test.status, test.host, test.address, status, body)
+		}
+	}
+
+	// the virtual hosts are changed in place
+	var publicListener = app.listeners[public]
+	app.testReloadListeners(t, []config.Listener{
+		{Address: public, VirtualHosts: []string{"admin"}},
+		{Address: internal},
+	})
+	if app.listeners[public] != publicListener {
+		t.Error("the listener was replaced when only its virtual hosts changed")
+	}
+	if status, _ := app.testGet(t, public, "admin"); status != http.StatusOK {
+		t.Errorf("expected admin to be served on %s after the reload got %d", public, status)
+	}
+}
+
+func TestListenersReload(t *testing.T) {
+	t.Parallel()
+	const first, second = "127.0.0.1:0", "127.0.0.3:0"
+	var app = newListenersTestApp(t, config.Listener{Address: first})
+	app.testReloadListeners(t, app.cfg.HTTP.Listeners)
+	defer app.closeListeners()
+	var old = app.listeners[first]
+	var oldAddr = old.Addr().String()
+	if status, _ := app.testGet(t, first, "public"); status != http.StatusOK {
+		t.Fatalf("expected %d got %d", http.StatusOK, status)
+	}
+
+	app.testReloadListeners(t, []config.Listener{
+		{Address: first, ReadTimeout: 20},
+		{Address: second},
+	})
+	if len(app.listeners) != 2 {
+		t.Fatalf("expected 2 listeners got %d", len(app.listeners))
+	}
+	if app.listeners[first] == old {
+		t.Error("the listener was not replaced when its timeouts changed")
+	}
+	if addr := app.listeners[first].Addr().String(); addr != oldAddr {
+		t.Errorf("expected the replaced listener to keep its socket on %s got %s", oldAddr, addr)
+	}
+	if _, err := old.Accept(); err == nil {
+		t.Error("the replaced listener is still accepting connections")
+	}
+	for _, address := range []string{first, second} {
+		if status, _ := app.testGet(t, address, "public"); status != http.StatusOK {
+			t.Errorf("expected %d on %s got %d", http.StatusOK, address, status)
+		}
+	}
+
+	app.testReloadListeners(t, app.cfg.HTTP.Listeners[1:])
+	if _, ok := app.listeners[first]; ok || len(app.listeners) != 1 {
+		t.Errorf("expected only the listener on %s got %v", second, app.listeners)
+	}
+}
+
+func TestListenersReloadFailure(t *testing.T) {
+	t.Parallel()
+	const first = "127.0.0.1:0"
+	var app = newListenersTestApp(t, config.Listener{Address: first})
+	app.testReloadListeners(t, app.cfg.HTTP.Listeners)
+	defer app.closeListeners()
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var freeAddr = free.Addr().String()
+	_ = free.Close()
+
+	var cfg, httpCfg = *app.cfg, *app.cfg.HTTP
+	httpCfg.Listeners = []config.Listener{
+		{Address: first, ReadTimeout: 20},
+		{Address: freeAddr},
+		{Address: busy.Addr().String()},
+	}
+	cfg.HTTP = &httpCfg
+	if _, err := app.openSockets(&cfg); err == nil {
+		t.Fatal("expected an error for the address in use")
+	}
+	// the sockets opened before the error are closed
+	if socket, err := net.Listen("tcp", freeAddr); err != nil {
+		t.Errorf("expected %s to be free after the failed reload got %s", freeAddr, err)
+	} else {
+		_ = socket.Close()
+	}
+	if len(app.listeners) != 1 || app.listeners[first].cfg.ReadTimeout == 20 {
+		t.Errorf("expected the listeners to be unchanged got %v", app.listeners)
+	}
+	if status, _ := app.testGet(t, first, "public"); status != http.StatusOK {
+		t.Errorf("expected %d after the failed reload got %d", http.StatusOK, status)
+	}
+}
+
+func TestListenersHTTP2(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+	const h2c, h2, http1 = "127.0.0.1:0", "127.0.0.4:0", "127.0.0.5:0"
+	var app = newListenersTestApp(t,
+		config.Listener{Address: h2c, HTTP2: true},
+		config.Listener{Address: h2, TLS: true, HTTP2: true},
+		config.Listener{Address: http1, TLS: true},
+	)
+	var err error
+	if app.tlsSettings, err = newTLSSettings(newTestTLSConfig(t, dir)); err != nil {
+		t.Fatal(err)
+	}
+	app.virtualHosts["public"].Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _ := contexts.GetConn(r.Context())
+		conn.SetThrottle(1024 * 1024)
+		defer conn.RemoveThrottling()
+		fmt.Fprintf(w, "%d %s %d", r.ProtoMajor, conn.ID(), app.Stats().OpenStreams)
+	})
+	app.testReloadListeners(t, app.cfg.HTTP.Listeners)
+	defer app.closeListeners()
+
+	var get = func(scheme, address string, protocols *http.Protocols) (int, string) {
+		var transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			Protocols:       protocols,
+		}
+		defer transport.CloseIdleConnections()
+		app.RLock()
+		var addr = app.listeners[address].Addr().String()
+		app.RUnlock()
+		req, err := http.NewRequest("GET", scheme+"://"+addr+"/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = "public"
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.ProtoMajor, string(body)
+	}
+
+	var unencrypted, encrypted = new(http.Protocols), new(http.Protocols)
+	unencrypted.SetUnencryptedHTTP2(true)
+	encrypted.SetHTTP1(true)
+	encrypted.SetHTTP2(true)
+	for _, test := range []struct {
+		scheme, address string
+		protocols       *http.Protocols
+		major           int
+	}{
+		{"http", h2c, unencrypted, 2},
+		{"http", h2c, nil, 1},
+		{"https", h2, encrypted, 2},
+		{"https", http1, encrypted, 1},
+	} {
+		major, body := get(test.scheme, test.address, test.protocols)
+		var fields = strings.Fields(body)
+		if major != test.major || len(fields) != 3 || fields[0] != fmt.Sprint(test.major) {
+			t.Errorf("expected HTTP/%d from %s got HTTP/%d %q", test.major, test.address, major, body)
+			continue
+		}
+		// the requests over HTTP/2 have their own connections
+		if isH2 := strings.Contains(fields[1], "#"); isH2 != (test.major == 2) {
+			t.Errorf("unexpected connection ID %s for HTTP/%d", fields[1], test.major)
+		}
+		if expected := fmt.Sprint(test.major - 1); fields[2] != expected {
+			t.Errorf("expected %s open streams for HTTP/%d got %s", expected, test.major, fields[2])
+		}
+	}
+	if streams := app.Stats().OpenStreams; streams != 0 {
+		t.Errorf("expected no open streams after the requests got %d", streams)
+	}
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("nedomi_http_requests_total",
+		"Number of requests served by virtual host and status code.", "vhost", "code")
+	httpResponseBytes = metrics.NewCounterVec("nedomi_http_response_bytes_total",
+		"Number of bytes sent in the response bodies by virtual host.", "vhost")
+	cacheEvictions = metrics.NewCounterVec("nedomi_cache_evictions_total",
+		"Number of object parts evicted from the cache zones.", "zone")
+	accessLogSampledOut = metrics.NewCounterVec("nedomi_access_log_sampled_out_total",
+		"Number of cache hits not written in the access logs because of sampling.", "vhost")
+)
+
+func init() {
+	metrics.DefaultRegistry.Register(httpRequests)
+	metrics.DefaultRegistry.Register(httpResponseBytes)
+	metrics.DefaultRegistry.Register(cacheEvictions)
+	metrics.DefaultRegistry.Register(accessLogSampledOut)
+}
+
+// observeResponse counts the response in the virtual host metrics and in the
+// stats of the location which served it.
+func observeResponse(vhost string, location *types.Location, l *responseLogger) {
+	var status = l.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	httpRequests.Inc(vhost, strconv.Itoa(status))
+	httpResponseBytes.Add(l.Size(), vhost)
+	location.Stats.Responded(status, l.Size())
+}
+
+// countEvictions returns a remove function for the cache algorithm of the
+// zone which counts the evicted objects.
+func countEvictions(zoneID string, remove func(*types.ObjectIndex) error) func(*types.ObjectIndex) error {
+	return func(idx *types.ObjectIndex) error {
+		cacheEvictions.Inc(zoneID)
+		return remove(idx)
+	}
+}
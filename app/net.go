@@ -2,10 +2,12 @@ package app
 
 import (
 	"encoding/hex"
+	"net"
 	"net/http"
 	"strings"
 
 	"github.com/ironsmile/nedomi/contexts"
+	"github.com/ironsmile/nedomi/logger"
 	"github.com/ironsmile/nedomi/types"
 	"github.com/ironsmile/nedomi/utils/httputils"
 )
@@ -13,26 +15,49 @@ import (
 // GetLocationFor returns the Location that mathes the provided host and path
 func (app *Application) GetLocationFor(host, path string) *types.Location {
 	app.RLock()
-	split := strings.Split(host, ":")
-	vh, ok := app.virtualHosts[split[0]]
+	vh, ok := app.virtualHosts[vhostName(host)]
 	app.RUnlock()
 	if !ok {
 		return nil
 	}
+	return vh.match(path)
+}
 
-	location := vh.Muxer.Match(path)
-	if location == nil {
-		return &vh.Location
+// Locations returns the locations of all virtual hosts keyed by the virtual
+// host name. The first location of each is the virtual host itself.
+func (app *Application) Locations() map[string][]*types.Location {
+	app.RLock()
+	defer app.RUnlock()
+	var result = make(map[string][]*types.Location)
+	for name, vh := range app.virtualHosts {
+		if name != vh.Name { // an alias
+			continue
+		}
+		result[name] = append([]*types.Location{&vh.Location}, vh.Locations...)
 	}
-	return location
+	return result
 }
 
 func (app *Application) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	app.serve(writer, req, app.GetLocationFor(req.Host, req.URL.Path))
+}
+
+// serve serves the request with the location. Requests without a location
+// are not configured.
+func (app *Application) serve(writer http.ResponseWriter, req *http.Request, location *types.Location) {
 	var (
 		reqID    = app.newRequestIDFor(app.stats.requested())
 		ctx      = contexts.NewIDContext(app.ctx, reqID)
-		location = app.GetLocationFor(req.Host, req.URL.Path)
+		peerAddr = req.RemoteAddr
 	)
+	app.RLock()
+	var clientAddr = app.realIP.clientAddr(req)
+	app.RUnlock()
+	if clientAddr != "" {
+		ctx = contexts.NewPeerAddrContext(ctx, peerAddr)
+		req = req.WithContext(ctx)
+		req.RemoteAddr = clientAddr
+	}
 
 	if location == nil || location.Handler == nil {
 		req = req.WithContext(ctx)
@@ -43,17 +68,53 @@ func (app *Application) ServeHTTP(writer http.ResponseWriter, req *http.Request)
 
 	defer app.stats.responded()
 
-	var conn, ok = app.conns.find(req.RemoteAddr)
+	var conn, ok = app.conns.find(peerAddr)
 	if !ok { // highly unlikely
 		app.GetLogger().Errorf("couldn't find connection for req with addr %s!%s!%s\n",
-			req.RemoteAddr, reqID, req.URL.Path)
+			peerAddr, reqID, req.URL.Path)
 		httputils.Error(writer, http.StatusInternalServerError)
 		return
 	}
 
+	if isStream(req) {
+		app.conns.addStream()
+		defer app.conns.removeStream()
+		app.RLock()
+		var minWrite = int64(app.cfg.HTTP.MinIOTransferSize)
+		app.RUnlock()
+		var stream = newStreamConn(conn, writer, reqID, minWrite)
+		conn, writer = stream, stream
+	}
+
 	ctx = contexts.NewConnContext(ctx, conn) // TODO: figure out how to remove this
+	ctx = contexts.NewLoggerContext(ctx, requestLogger(req, reqID, location))
 	req = req.WithContext(ctx)
-	location.Handler.ServeHTTP(writer, req)
+	var l = &responseLogger{ResponseWriter: writer}
+	defer observeResponse(vhostName(req.Host), location, l)
+	location.Handler.ServeHTTP(l, req)
+}
+
+// requestLogger returns the logger of the location with the request ID, the
+// name of the location and the client address attached to its messages.
+func requestLogger(req *http.Request, reqID types.RequestID, location *types.Location) types.StructuredLogger {
+	var clientAddr, _, err = net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		clientAddr = req.RemoteAddr
+	}
+	var locationName = vhostName(req.Host)
+	if location.Name != locationName {
+		locationName += " " + location.Name
+	}
+	return logger.Structured(location.Logger).With(
+		types.LogField{Key: types.LogFieldRequestID, Value: reqID},
+		types.LogField{Key: types.LogFieldLocation, Value: locationName},
+		types.LogField{Key: types.LogFieldClientAddr, Value: clientAddr},
+	)
+}
+
+// vhostName returns the name of the virtual host for the supplied Host header
+func vhostName(host string) string {
+	return strings.Split(host, ":")[0]
 }
 
 func newNotConfiguredHandler() http.Handler {
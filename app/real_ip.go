@@ -0,0 +1,60 @@
+package app
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/utils/netutils"
+)
+
+// realIP gets the client addresses of the requests from trusted proxies from
+// a header.
+type realIP struct {
+	trusted   netutils.IPNets
+	header    string
+	recursive bool
+}
+
+// newRealIP returns the realIP for the config. It returns nil if there are
+// no trusted proxies.
+func newRealIP(cfg *config.RealIP) (*realIP, error) {
+	trusted, err := netutils.ParseIPNets(cfg.Trusted)
+	if err != nil || len(trusted) == 0 {
+		return nil, err
+	}
+	return &realIP{trusted: trusted, header: cfg.GetHeader(), recursive: cfg.Recursive}, nil
+}
+
+// clientAddr returns the client address for the request as a host:port. It
+// is empty if the request is not from a trusted proxy or it has no valid
+// client address in the header.
+func (r *realIP) clientAddr(req *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	host, port, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil || !r.trusted.Contains(net.ParseIP(host)) {
+		return ""
+	}
+	var addresses []string
+	for _, value := range req.Header[r.header] {
+		addresses = append(addresses, strings.Split(value, ",")...)
+	}
+	var client net.IP
+	for i := len(addresses) - 1; i >= 0; i-- {
+		var ip = net.ParseIP(strings.TrimSpace(addresses[i]))
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !r.recursive || !r.trusted.Contains(ip) {
+			break
+		}
+	}
+	if client == nil {
+		return ""
+	}
+	return net.JoinHostPort(client.String(), port)
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ironsmile/nedomi/config"
+)
+
+func TestRealIPClientAddr(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		cfg        config.RealIP
+		remoteAddr string
+		header     map[string]string
+		expected   string
+	}{
+		{ // untrusted
+			cfg:        config.RealIP{Trusted: []string{"10.0.0.0/8"}},
+			remoteAddr: "192.168.0.1:1234",
+			header:     map[string]string{"X-Forwarded-For": "1.2.3.4"},
+		},
+		{
+			cfg:        config.RealIP{Trusted: []string{"10.0.0.0/8"}},
+			remoteAddr: "10.0.0.1:1234",
+			header:     map[string]string{"X-Forwarded-For": "5.6.7.8, 1.2.3.4"},
+			expected:   "1.2.3.4:1234",
+		},
+		{ // the last one is trusted but not recursive
+			cfg:        config.RealIP{Trusted: []string{"10.0.0.0/8"}},
+			remoteAddr: "10.0.0.1:1234",
+			header:     map[string]string{"X-Forwarded-For": "1.2.3.4, 10.0.0.2"},
+			expected:   "10.0.0.2:1234",
+		},
+		{
+			cfg:        config.RealIP{Trusted: []string{"10.0.0.0/8"}, Recursive: true},
+			remoteAddr: "10.0.0.1:1234",
+			header:     map[string]string{"X-Forwarded-For": "5.6.7.8, 1.2.3.4, 10.0.0.3, 10.0.0.2"},
+			expected:   "1.2.3.4:1234",
+		},
+		{ // all trusted
+			cfg:        config.RealIP{Trusted: []string{"10.0.0.0/8"}, Recursive: true},
+			remoteAddr: "10.0.0.1:1234",
+			header:     map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"},
+			expected:   "10.0.0.3:1234",
+		},
+		{ // garbage stops the search
+			cfg:        config.RealIP{Trusted: []string{"10.0.0.0/8"}, Recursive: true},
+			remoteAddr: "10.0.0.1:1234",
+			header:     map[string]string{"X-Forwarded-For": "1.2.3.4, unknown, 10.0.0.2"},
+			expected:   "10.0.0.2:1234",
+		},
+		{ // no header
+			cfg:        config.RealIP{Trusted: []string{"10.0.0.0/8"}},
+			remoteAddr: "10.0.0.1:1234",
+		},
+		{
+			cfg:        config.RealIP{Trusted: []string{"2001:db8::/32"}, Header: "x-real-ip"},
+			remoteAddr: "[2001:db8::1]:1234",
+			header: map[string]string{
+				"X-Forwarded-For": "1.2.3.4",
+				"X-Real-IP":       "2001:db8:1::5",
+			},
+			expected: "[2001:db8:1::5]:1234",
+		},
+	}
+
+	for i, test := range tests {
+		r, err := newRealIP(&test.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var req = &http.Request{RemoteAddr: test.remoteAddr, Header: make(http.Header)}
+		for key, value := range test.header {
+			req.Header.Set(key, value)
+		}
+		if got := r.clientAddr(req); got != test.expected {
+			t.Errorf("test %d: expected `%s` got `%s`", i, test.expected, got)
+		}
+	}
+
+	if r, err := newRealIP(&config.RealIP{}); r != nil || err != nil {
+		t.Errorf("expected no realIP without trusted proxies got %v, %v", r, err)
+	}
+}
@@ -11,17 +11,15 @@ var (
 	errCfgIsNil                      = errors.New("no config was provided for the reload")
 	errCfgUserIsDifferent            = errors.New("can't change user by reload")
 	errCfgWorkDirIsDifferent         = errors.New("can't change workdir by reload")
-	errCfgListenIsDifferent          = errors.New("can't change addressed being listened to by reload")
 	errCfgMaxTransferSizeIsDifferent = errors.New("can't change max_io_transfer_size by reload")
 	errCfgMinTransferSizeIsDifferent = errors.New("can't change min_io_transfer_size by reload")
-	errCfgReadTimeoutIsDifferent     = errors.New("can't change read_timeout by reload")
-	errCfgWriteTimeoutIsDifferent    = errors.New("can't change write_timeout by reload")
 	errCfgMaxHeadersSizeIsDifferent  = errors.New("can't change max_headers_size by reload")
 
 	errTmplDifferentType      = "different types for same id '%s' between configs"
 	errTmplDifferentPath      = "different paths for same id '%s' between configs"
 	errTmplDifferentAlgorithm = "different algorithms for same id '%s' between configs"
 	errTmplDifferentPartSize  = "different part size for same id '%s' between configs"
+	errTmplDifferentAdmission = "different admission settings for same id '%s' between configs"
 )
 
 // checks if the provided config could be loaded in place of the current one.
@@ -37,21 +35,12 @@ func (a *Application) checkConfigCouldBeReloaded(cfg *config.Config) error {
 	if a.cfg.System.User != cfg.System.User {
 		return errCfgUserIsDifferent
 	}
-	if a.cfg.HTTP.Listen != cfg.HTTP.Listen {
-		return errCfgListenIsDifferent
-	}
 	if a.cfg.HTTP.MaxIOTransferSize != cfg.HTTP.MaxIOTransferSize {
 		return errCfgMaxTransferSizeIsDifferent
 	}
 	if a.cfg.HTTP.MinIOTransferSize != cfg.HTTP.MinIOTransferSize {
 		return errCfgMinTransferSizeIsDifferent
 	}
-	if a.cfg.HTTP.ReadTimeout != cfg.HTTP.ReadTimeout {
-		return errCfgReadTimeoutIsDifferent
-	}
-	if a.cfg.HTTP.WriteTimeout != cfg.HTTP.WriteTimeout {
-		return errCfgWriteTimeoutIsDifferent
-	}
 	if a.cfg.HTTP.MaxHeadersSize != cfg.HTTP.MaxHeadersSize {
 		return errCfgMaxHeadersSizeIsDifferent
 	}
@@ -78,6 +67,10 @@ func cacheZonesAreCompatible(zones1, zones2 map[string]*config.CacheZone) error
 		if zone2.PartSize != zone1.PartSize {
 			return fmt.Errorf(errTmplDifferentPartSize, key)
 		}
+		if zone2.AdmissionMinRequests != zone1.AdmissionMinRequests ||
+			zone2.AdmissionWindow != zone1.AdmissionWindow {
+			return fmt.Errorf(errTmplDifferentAdmission, key)
+		}
 	}
 	// !TODO check that a zone does not have the same path but with different ID
 
@@ -110,6 +110,29 @@ func TestCacheZonesAreCompatible(t *testing.T) {
 			},
 			err: "different part size for same id 'pesho' between configs",
 		},
+		{ // different admission settings
+			cfg1: map[string]*config.CacheZone{
+				"pesho": {
+					ID:                   "pesho",
+					Type:                 "type1",
+					Path:                 "/path/to/somewhere",
+					Algorithm:            "algorithm",
+					PartSize:             10,
+					AdmissionMinRequests: 2,
+				},
+			},
+			cfg2: map[string]*config.CacheZone{
+				"pesho": {
+					ID:                   "pesho",
+					Type:                 "type1",
+					Path:                 "/path/to/somewhere",
+					Algorithm:            "algorithm",
+					PartSize:             10,
+					AdmissionMinRequests: 3,
+				},
+			},
+			err: "different admission settings for same id 'pesho' between configs",
+		},
 		{ // object size going up is fine
 			cfg1: map[string]*config.CacheZone{
 				"pesho": {
@@ -316,7 +339,7 @@ func TestCheckConfigCouldBeReloaded(t *testing.T) {
 				},
 			},
 		},
-		err: errCfgListenIsDifferent,
+		err: nil, // the listeners can be changed by reload
 	}, {
 		cfg1: &config.Config{
 			BaseConfig: config.BaseConfig{
@@ -434,7 +457,7 @@ func TestCheckConfigCouldBeReloaded(t *testing.T) {
 				},
 			},
 		},
-		err: errCfgReadTimeoutIsDifferent,
+		err: nil, // the listeners can be changed by reload
 	}, {
 		cfg1: &config.Config{
 			BaseConfig: config.BaseConfig{
@@ -472,7 +495,7 @@ func TestCheckConfigCouldBeReloaded(t *testing.T) {
 				},
 			},
 		},
-		err: errCfgWriteTimeoutIsDifferent,
+		err: nil, // the listeners can be changed by reload
 	}, {
 		cfg1: &config.Config{
 			BaseConfig: config.BaseConfig{
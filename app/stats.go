@@ -18,3 +18,17 @@ func (as *applicationStats) responded() uint64 {
 func (as *applicationStats) notConfigured() uint64 {
 	return atomic.AddUint64(&as.NotConfigured, 1)
 }
+
+// locationStatsFor returns the stats for the location of the virtual host.
+// The same stats are returned for a location after a reload.
+func (a *Application) locationStatsFor(vhost, location string) *types.LocationStats {
+	var key = vhost + " " + location
+	stats, ok := a.locationStats[key]
+	if !ok {
+		if stats, ok = a.oldLocationStats[key]; !ok {
+			stats = new(types.LocationStats)
+		}
+		a.locationStats[key] = stats
+	}
+	return stats
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/throttle"
+)
+
+// streamConn is the types.IncomingConn of a request over HTTP/2. Many
+// requests share the same connection so they are throttled through their
+// response writers and not through the connection.
+type streamConn struct {
+	http.ResponseWriter
+	id       string
+	w        io.Writer
+	minWrite int64
+}
+
+func newStreamConn(conn types.IncomingConn, w http.ResponseWriter, reqID types.RequestID,
+	minWrite int64) *streamConn {
+	return &streamConn{
+		ResponseWriter: w,
+		id:             conn.ID() + "#" + string(reqID),
+		w:              w,
+		minWrite:       minWrite,
+	}
+}
+
+// ID returns the ID of the connection with the request ID.
+func (s *streamConn) ID() string {
+	return s.id
+}
+
+// SetThrottle throttles the response of the request.
+func (s *streamConn) SetThrottle(speed types.BytesSize) {
+	s.w = throttle.NewThrottleWriter(s.ResponseWriter, int64(speed), s.minWrite)
+}
+
+// RemoveThrottling stops throttling the response of the request.
+func (s *streamConn) RemoveThrottling() {
+	s.w = s.ResponseWriter
+}
+
+func (s *streamConn) Write(b []byte) (int, error) {
+	return s.w.Write(b)
+}
+
+func (s *streamConn) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(s.w, r)
+}
+
+// isStream returns whether the request is one of many on its connection.
+func isStream(req *http.Request) bool {
+	return req.ProtoMajor == 2
+}
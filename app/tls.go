@@ -0,0 +1,114 @@
+package app
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+
+	"github.com/ironsmile/nedomi/config"
+)
+
+// tlsSettings are the TLS settings and certificates for the TLS connections.
+// They are created from the config on every reload so the new connections use
+// the new certificates while the old ones are not interrupted.
+type tlsSettings struct {
+	config      *tls.Config
+	http2Config *tls.Config                 // the same config with HTTP/2 negotiated first
+	certs       map[string]*tls.Certificate // by virtual host name and alias
+	defaultCert *tls.Certificate
+}
+
+// newTLSSettings loads the certificates in the config. It returns nil if there
+// are no TLS listeners.
+func newTLSSettings(cfg *config.Config) (*tlsSettings, error) {
+	var tlsCfg = &cfg.HTTP.TLS
+	if !cfg.HTTP.HasTLSListeners() {
+		return nil, nil
+	}
+	var (
+		s      = &tlsSettings{certs: make(map[string]*tls.Certificate)}
+		loaded = make(map[[2]string]*tls.Certificate)
+		err    error
+	)
+	var load = func(certFile, keyFile string) (*tls.Certificate, error) {
+		var key = [2]string{certFile, keyFile}
+		if cert, ok := loaded[key]; ok {
+			return cert, nil
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading certificate %s - %s", certFile, err)
+		}
+		loaded[key] = &cert
+		return &cert, nil
+	}
+
+	if s.defaultCert, err = load(tlsCfg.Certificate, tlsCfg.Key); err != nil {
+		return nil, err
+	}
+	for _, vhost := range cfg.HTTP.Servers {
+		if vhost.TLSCertificate == "" {
+			continue
+		}
+		cert, err := load(vhost.TLSCertificate, vhost.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("virtual host %s: %s", vhost.Name, err)
+		}
+		s.certs[vhost.Name] = cert
+		for _, alias := range vhost.Aliases {
+			s.certs[alias] = cert
+		}
+	}
+
+	s.config = &tls.Config{
+		GetCertificate: s.getCertificate,
+		NextProtos:     []string{"http/1.1"},
+	}
+	if s.config.MinVersion, err = config.ParseTLSVersion(tlsCfg.MinVersion); err != nil {
+		return nil, err
+	}
+	if s.config.MaxVersion, err = config.ParseTLSVersion(tlsCfg.MaxVersion); err != nil {
+		return nil, err
+	}
+	if s.config.CipherSuites, err = config.ParseCipherSuites(tlsCfg.CipherSuites); err != nil {
+		return nil, err
+	}
+	s.http2Config = s.config.Clone()
+	s.http2Config.NextProtos = []string{"h2", "http/1.1"}
+	return s, nil
+}
+
+// getCertificate returns the certificate for the server name sent by the
+// client. Wildcard names like *.example.com match one level of subdomains.
+// The default certificate is used for unknown names and clients without SNI.
+func (s *tlsSettings) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	var name = strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := s.certs[name]; ok {
+		return cert, nil
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert, ok := s.certs["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+	return s.defaultCert, nil
+}
+
+// newTLSConfig returns the TLS config for a listener. It gets the current
+// settings for every new connection so that the certificates are changed on
+// reload.
+func (a *Application) newTLSConfig(http2 bool) *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			a.RLock()
+			defer a.RUnlock()
+			if a.tlsSettings == nil {
+				return nil, fmt.Errorf("TLS is not configured")
+			}
+			if http2 {
+				return a.tlsSettings.http2Config, nil
+			}
+			return a.tlsSettings.config, nil
+		},
+	}
+}
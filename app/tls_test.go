@@ -0,0 +1,154 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/utils/netutils"
+	"github.com/ironsmile/nedomi/utils/testutils"
+)
+
+func newTestTLSConfig(t *testing.T, dir string) *config.Config {
+	var cfg = &config.Config{HTTP: new(config.HTTP)}
+	cfg.HTTP.TLS.Listen = "127.0.0.1:0"
+	cfg.HTTP.TLS.Certificate, cfg.HTTP.TLS.Key = testutils.GenerateCertificate(t, dir, "default")
+
+	var vhost = new(config.VirtualHost)
+	vhost.Name = "example.com"
+	vhost.Aliases = []string{"www.example.com"}
+	vhost.TLSCertificate, vhost.TLSKey = testutils.GenerateCertificate(t, dir,
+		"example.com", "example.com", "www.example.com")
+	var wildcard = new(config.VirtualHost)
+	wildcard.Name = "*.example.org"
+	wildcard.TLSCertificate, wildcard.TLSKey = testutils.GenerateCertificate(t, dir,
+		"example.org", "*.example.org")
+	var noCert = new(config.VirtualHost)
+	noCert.Name = "example.net"
+	cfg.HTTP.Servers = []*config.VirtualHost{vhost, wildcard, noCert}
+	return cfg
+}
+
+func TestTLSCertificateSelection(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+	settings, err := newTLSSettings(newTestTLSConfig(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = map[string]string{
+		"example.com":      "example.com",
+		"WWW.example.com.": "example.com",
+		"cdn.example.org":  "example.org",
+		"a.b.example.org":  "default",
+		"example.org":      "default",
+		"example.net":      "default",
+		"":                 "default",
+	}
+	for serverName, expected := range tests {
+		cert, err := settings.getCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", serverName, err)
+		}
+		leaf, err := parseLeaf(cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if leaf != expected {
+			t.Errorf("expected certificate %s for %q got %s", expected, serverName, leaf)
+		}
+	}
+}
+
+func TestTLSSettingsErrors(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+	var cfg = newTestTLSConfig(t, dir)
+	cfg.HTTP.Servers[0].TLSKey = cfg.HTTP.TLS.Key // does not match
+	if _, err := newTLSSettings(cfg); err == nil {
+		t.Error("expected an error for a certificate with the wrong key")
+	}
+
+	cfg = newTestTLSConfig(t, dir)
+	cfg.HTTP.TLS.Listen = ""
+	if settings, err := newTLSSettings(cfg); settings != nil || err != nil {
+		t.Errorf("expected no settings when TLS is disabled got %v, %v", settings, err)
+	}
+}
+
+func TestTLSListenerWithReload(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+	var app = &Application{}
+	var err error
+	if app.tlsSettings, err = newTLSSettings(newTestTLSConfig(t, dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !netutils.ListensOn(l, l.Addr().String()) {
+		t.Errorf("the listener should listen on its own address %s", l.Addr())
+	}
+	var srv = &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, r.TLS != nil)
+		}),
+	}
+	go func() { _ = srv.Serve(netutils.NewTLSListener(l, app.newTLSConfig(false))) }()
+	defer l.Close()
+
+	var get = func(serverName string) string {
+		var client = &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{ServerName: serverName, InsecureSkipVerify: true},
+		}}
+		resp, err := client.Get("https://" + l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		if string(body) != "true" {
+			t.Errorf("the request was not known to be over TLS")
+		}
+		return resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	if got := get("www.example.com"); got != "example.com" {
+		t.Errorf("expected the example.com certificate got %s", got)
+	}
+
+	// reloading replaces the certificate for the new connections
+	var cfg = newTestTLSConfig(t, dir)
+	cfg.HTTP.Servers[0].TLSCertificate, cfg.HTTP.Servers[0].TLSKey = testutils.GenerateCertificate(
+		t, dir, "example.com-new", "example.com")
+	settings, err := newTLSSettings(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Lock()
+	app.tlsSettings = settings
+	app.Unlock()
+	if got := get("www.example.com"); got != "example.com-new" {
+		t.Errorf("expected the reloaded example.com certificate got %s", got)
+	}
+}
+
+func parseLeaf(cert *tls.Certificate) (string, error) {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return "", err
+	}
+	return leaf.Subject.CommonName, nil
+}
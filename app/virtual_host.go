@@ -5,5 +5,15 @@ import "github.com/ironsmile/nedomi/types"
 // VirtualHost links a config vritual host to its cache algorithm and a storage object.
 type VirtualHost struct {
 	types.Location
-	Muxer *LocationMuxer
+	Muxer     *LocationMuxer
+	Locations []*types.Location
+}
+
+// match returns the location of the virtual host for the path. It is the
+// virtual host itself if none of its locations match.
+func (vh *VirtualHost) match(path string) *types.Location {
+	if location := vh.Muxer.Match(path); location != nil {
+		return location
+	}
+	return &vh.Location
 }
@@ -74,23 +74,6 @@ func buildCommonLogLine(
 	return buf
 }
 
-// writeLog writes a log entry for req to w in Apache Common Log Format.
-// ts is the timestamp with which the entry should be logged.
-// status and size are used to provide the response HTTP status and size.
-func writeLog(
-	w io.Writer,
-	req *http.Request,
-	locationIdentification string,
-	reqID types.RequestID,
-	url url.URL,
-	ts time.Time,
-	status int, size uint64,
-) {
-	buf := buildCommonLogLine(req, locationIdentification, reqID, url, ts, status, size)
-	buf = append(buf, '\n')
-	_, _ = w.Write(buf)
-}
-
 func appendQuoted(buf []byte, s string) []byte {
 	var runeTmp [utf8.UTFMax]byte
 	for width := 0; len(s) > 0; s = s[width:] {
@@ -159,8 +142,9 @@ const lowerhex = "0123456789abcdef"
 
 type responseLogger struct {
 	http.ResponseWriter
-	status int
-	size   uint64
+	status    int
+	size      uint64
+	firstByte time.Time
 }
 
 func (l *responseLogger) Write(b []byte) (n int, err error) {
@@ -168,12 +152,14 @@ func (l *responseLogger) Write(b []byte) (n int, err error) {
 		// The status will be StatusOK if WriteHeader has not been called yet
 		l.status = http.StatusOK
 	}
+	l.wrote()
 	n, err = l.ResponseWriter.Write(b)
 	atomic.AddUint64(&l.size, uint64(n))
 	return n, err
 }
 
 func (l *responseLogger) WriteHeader(s int) {
+	l.wrote()
 	l.ResponseWriter.WriteHeader(s)
 	l.status = s
 }
@@ -186,7 +172,24 @@ func (l *responseLogger) Size() uint64 {
 	return l.size
 }
 
+// wrote records the time of the first write
+func (l *responseLogger) wrote() {
+	if l.firstByte.IsZero() {
+		l.firstByte = time.Now()
+	}
+}
+
+// TimeToFirstByte returns the time from start until the headers or the body
+// started being written. It is zero if nothing was written.
+func (l *responseLogger) TimeToFirstByte(start time.Time) time.Duration {
+	if l.firstByte.IsZero() {
+		return 0
+	}
+	return l.firstByte.Sub(start)
+}
+
 func (l *responseLogger) ReadFrom(r io.Reader) (n int64, err error) {
+	l.wrote()
 	n, err = io.Copy(l.ResponseWriter, r)
 	atomic.AddUint64(&l.size, uint64(n))
 	return n, err
@@ -0,0 +1,370 @@
+// Package arc contains an Adaptive Replacement Cache implementation.
+//
+// ARC keeps two lists of objects in the cache - recently used once (t1) and
+// used at least twice (t2). It also remembers the objects which were recently
+// evicted from them (b1 and b2). Hits in the remembered objects are used to
+// adapt the target size of t1 to the current workload.
+package arc
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/cacheutils"
+)
+
+const (
+	t1 = iota // objects in the cache which were used once
+	t2        // objects in the cache which were used at least twice
+	b1        // hashes of objects recently evicted from t1
+	b2        // hashes of objects recently evicted from t2
+)
+
+// entry is stored in the cache lookup hashmap
+type entry struct {
+	elem *list.Element
+	list int
+	size types.BytesSize
+}
+
+// AdaptiveCache implements the Adaptive Replacement Cache algorithm.
+type AdaptiveCache struct {
+	types.SyncLogger
+
+	cfg *config.CacheZone
+
+	lists  [4]*list.List
+	lookup map[types.ObjectIndexHash]*entry
+	mutex  sync.Mutex
+
+	// The adaptive target size of t1
+	p int
+
+	// The size in bytes of the objects in t1 and t2
+	size types.BytesSize
+
+	removeFunc func(*types.ObjectIndex) error
+	admission  *cacheutils.AdmissionFilter
+
+	// Used to track cache hit/miss information
+	requests uint64
+	hits     uint64
+}
+
+func (ac *AdaptiveCache) capacity() int {
+	if ac.cfg.StorageObjects < 1 {
+		return 1
+	}
+	return int(ac.cfg.StorageObjects)
+}
+
+func (ac *AdaptiveCache) isCached(h types.ObjectIndexHash) bool {
+	e, ok := ac.lookup[h]
+	return ok && (e.list == t1 || e.list == t2)
+}
+
+// Lookup implements part of types.CacheAlgorithm interface
+func (ac *AdaptiveCache) Lookup(oi *types.ObjectIndex) bool {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	ac.requests++
+	if ac.isCached(oi.Hash()) {
+		ac.hits++
+		return true
+	}
+	return false
+}
+
+// ShouldKeep implements part of types.CacheAlgorithm interface
+func (ac *AdaptiveCache) ShouldKeep(oi *types.ObjectIndex) bool {
+	return ac.admission.Admit(oi)
+}
+
+// AddObject implements part of types.CacheAlgorithm interface
+func (ac *AdaptiveCache) AddObject(oi *types.ObjectIndex, size types.BytesSize) error {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	return ac.addObject(oi, size)
+}
+
+func (ac *AdaptiveCache) addObject(oi *types.ObjectIndex, size types.BytesSize) error {
+	var h = oi.Hash()
+	if e, ok := ac.lookup[h]; ok {
+		if e.list == t1 || e.list == t2 {
+			// the part may have been saved again with a different size
+			ac.size -= e.size
+			e.size = size
+			ac.size += e.size
+			return types.ErrAlreadyInCache
+		}
+		ac.ghostHit(e)
+		ac.lists[e.list].Remove(e.elem)
+		e.list = t2
+		e.elem = ac.lists[t2].PushFront(*oi)
+		e.size = size
+		ac.size += size
+		ac.GetLogger().Debugf("Storing %s in arc after a ghost hit", oi)
+		return nil
+	}
+
+	var (
+		c  = ac.capacity()
+		l1 = ac.lists[t1].Len() + ac.lists[b1].Len()
+		l2 = ac.lists[t2].Len() + ac.lists[b2].Len()
+	)
+	if l1 >= c {
+		if ac.lists[t1].Len() < c {
+			ac.forgetOldest(b1)
+			ac.replace(false)
+		} else {
+			ac.evictOldest(t1)
+		}
+	} else if l1+l2 >= c {
+		if l1+l2 >= 2*c {
+			ac.forgetOldest(b2)
+		}
+		ac.replace(false)
+	}
+
+	ac.GetLogger().Debugf("Storing %s in arc", oi)
+	ac.lookup[h] = &entry{list: t1, elem: ac.lists[t1].PushFront(*oi), size: size}
+	ac.size += size
+	return nil
+}
+
+// ghostHit adapts the target size of t1 when an object which was recently
+// evicted is requested again and makes space for it.
+func (ac *AdaptiveCache) ghostHit(e *entry) {
+	var b1Len, b2Len = ac.lists[b1].Len(), ac.lists[b2].Len()
+	if e.list == b1 {
+		delta := 1
+		if b2Len > b1Len {
+			delta = b2Len / b1Len
+		}
+		ac.p = min(ac.p+delta, ac.capacity())
+		ac.replace(false)
+		return
+	}
+
+	delta := 1
+	if b1Len > b2Len {
+		delta = b1Len / b2Len
+	}
+	ac.p = max(ac.p-delta, 0)
+	ac.replace(true)
+}
+
+// replace evicts an object from t1 or t2 depending on the target size of t1
+// and remembers it in the corresponding ghost list. Nothing is evicted if there
+// is free space in the cache.
+func (ac *AdaptiveCache) replace(inB2 bool) {
+	if ac.objects() < ac.capacity() {
+		return
+	}
+	var t1Len = ac.lists[t1].Len()
+	if t1Len > 0 && (t1Len > ac.p || (inB2 && t1Len == ac.p) || ac.lists[t2].Len() == 0) {
+		ac.demoteOldest(t1, b1)
+	} else if ac.lists[t2].Len() > 0 {
+		ac.demoteOldest(t2, b2)
+	}
+}
+
+// demoteOldest evicts the last object of the from list and puts its hash in
+// the front of the to list.
+func (ac *AdaptiveCache) demoteOldest(from, to int) {
+	var oi = ac.lists[from].Remove(ac.lists[from].Back()).(types.ObjectIndex)
+	var h = oi.Hash()
+	e, ok := ac.lookup[h]
+	if !ok {
+		ac.GetLogger().Errorf("ERROR! Object in cache list was not found in the "+
+			" lookup map: %v", oi)
+		e = &entry{}
+		ac.lookup[h] = e
+	}
+	ac.size -= e.size
+	e.size = 0
+	e.list = to
+	e.elem = ac.lists[to].PushFront(h)
+	ac.remove(&oi)
+}
+
+// evictOldest evicts the last object of the list without remembering it.
+func (ac *AdaptiveCache) evictOldest(from int) {
+	var back = ac.lists[from].Back()
+	if back == nil {
+		return
+	}
+	var oi = ac.lists[from].Remove(back).(types.ObjectIndex)
+	if e, ok := ac.lookup[oi.Hash()]; ok {
+		ac.size -= e.size
+	}
+	delete(ac.lookup, oi.Hash())
+	ac.remove(&oi)
+}
+
+// forgetOldest removes the last hash from a ghost list.
+func (ac *AdaptiveCache) forgetOldest(from int) {
+	var back = ac.lists[from].Back()
+	if back == nil {
+		return
+	}
+	delete(ac.lookup, ac.lists[from].Remove(back).(types.ObjectIndexHash))
+}
+
+func (ac *AdaptiveCache) remove(oi *types.ObjectIndex) {
+	if err := ac.removeFunc(oi); err != nil {
+		ac.GetLogger().Logf("error while removing %s from cache - %s", oi, err)
+	}
+}
+
+// Remove the objects given from the cache.
+func (ac *AdaptiveCache) Remove(ois ...*types.ObjectIndex) {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	for _, oi := range ois {
+		if e, ok := ac.lookup[oi.Hash()]; ok && (e.list == t1 || e.list == t2) {
+			delete(ac.lookup, oi.Hash())
+			ac.lists[e.list].Remove(e.elem)
+			ac.size -= e.size
+		}
+	}
+}
+
+// PromoteObject implements part of types.CacheAlgorithm interface.
+// Objects used for a second time are moved to the t2 list.
+func (ac *AdaptiveCache) PromoteObject(oi *types.ObjectIndex) {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	e, ok := ac.lookup[oi.Hash()]
+	if !ok || (e.list != t1 && e.list != t2) {
+		// This object is not in the cache yet. So we add it. Its size is
+		// not known so it is considered a full part.
+		if err := ac.addObject(oi, ac.cfg.PartSize); err != nil {
+			ac.GetLogger().Errorf("Adding object in cache failed. Object: %v\n%s", oi, err)
+		}
+		return
+	}
+
+	if e.list == t2 {
+		ac.lists[t2].MoveToFront(e.elem)
+		return
+	}
+
+	ac.lists[t1].Remove(e.elem)
+	e.list = t2
+	e.elem = ac.lists[t2].PushFront(*oi)
+}
+
+// ConsumedSize implements part of types.CacheAlgorithm interface
+func (ac *AdaptiveCache) ConsumedSize() types.BytesSize {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	return ac.size
+}
+
+func (ac *AdaptiveCache) objects() int {
+	return ac.lists[t1].Len() + ac.lists[t2].Len()
+}
+
+// Stats implements part of types.CacheAlgorithm interface
+func (ac *AdaptiveCache) Stats() types.CacheStats {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	return cacheutils.NewStats(ac.cfg.Path, ac.hits, ac.requests, uint64(ac.objects()),
+		ac.size, ac.admission)
+}
+
+// ChangeConfig changes the AdaptiveCache config and start using it
+func (ac *AdaptiveCache) ChangeConfig(bulkRemoveTimout, bulkRemoveCount, newsize uint64) {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	ac.cfg.StorageObjects = newsize
+	ac.cfg.BulkRemoveCount = bulkRemoveCount
+	ac.cfg.BulkRemoveTimeout = bulkRemoveTimout
+
+	var (
+		c       = ac.capacity()
+		removed []types.ObjectIndex
+	)
+	for ac.objects() > c {
+		var from = t2
+		if ac.lists[t1].Len() > ac.p || ac.lists[t2].Len() == 0 {
+			from = t1
+		}
+		oi := ac.lists[from].Remove(ac.lists[from].Back()).(types.ObjectIndex)
+		if e, ok := ac.lookup[oi.Hash()]; ok {
+			ac.size -= e.size
+		}
+		delete(ac.lookup, oi.Hash())
+		removed = append(removed, oi)
+	}
+	ac.p = min(ac.p, c)
+	for ac.objects()+ac.lists[b1].Len()+ac.lists[b2].Len() > 2*c {
+		if ac.lists[b1].Len() > 0 {
+			ac.forgetOldest(b1)
+		} else {
+			ac.forgetOldest(b2)
+		}
+	}
+
+	if len(removed) > 0 {
+		go cacheutils.RemoveInBatches(removed, bulkRemoveCount, bulkRemoveTimout,
+			ac.removeIfMissing)
+	}
+}
+
+// removeIfMissing removes the objects from the storage, but only if they are
+// not in the cache at the time of removal
+func (ac *AdaptiveCache) removeIfMissing(ois ...types.ObjectIndex) {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	for i := range ois {
+		if !ac.isCached(ois[i].Hash()) {
+			ac.remove(&ois[i])
+		}
+	}
+}
+
+func (ac *AdaptiveCache) init() {
+	for i := range ac.lists {
+		ac.lists[i] = list.New()
+	}
+	ac.lookup = make(map[types.ObjectIndexHash]*entry)
+	ac.admission = cacheutils.NewAdmissionFilter(ac.cfg)
+}
+
+// New returns AdaptiveCache object ready for use.
+func New(cz *config.CacheZone, removeFunc func(*types.ObjectIndex) error,
+	logger types.Logger) *AdaptiveCache {
+
+	ac := &AdaptiveCache{
+		cfg:        cz,
+		removeFunc: removeFunc,
+	}
+	ac.SetLogger(logger)
+	ac.init()
+	return ac
+}
+
+func min(l, r int) int {
+	if l > r {
+		return r
+	}
+	return l
+}
+
+func max(l, r int) int {
+	if l < r {
+		return r
+	}
+	return l
+}
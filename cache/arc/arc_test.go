@@ -0,0 +1,187 @@
+package arc
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/mock"
+	"github.com/ironsmile/nedomi/types"
+)
+
+func getCacheZone(objects uint64) *config.CacheZone {
+	return &config.CacheZone{
+		ID:             "default",
+		Path:           "/some/path",
+		StorageObjects: objects,
+		PartSize:       10,
+		Algorithm:      "arc",
+	}
+}
+
+func mockRemove(*types.ObjectIndex) error {
+	return nil
+}
+
+func objectIndexes(prefix string, count int) []*types.ObjectIndex {
+	var result = make([]*types.ObjectIndex, count)
+	for i := range result {
+		result[i] = &types.ObjectIndex{ObjID: types.NewObjectID("1.1", prefix+strconv.Itoa(i))}
+	}
+	return result
+}
+
+// access uses the cache algorithm the way the cache handler does
+func access(ac *AdaptiveCache, idx *types.ObjectIndex) {
+	if ac.Lookup(idx) {
+		ac.PromoteObject(idx)
+	} else if ac.ShouldKeep(idx) {
+		ac.AddObject(idx, ac.cfg.PartSize)
+	}
+}
+
+func checkSizes(t *testing.T, ac *AdaptiveCache) {
+	var c = ac.capacity()
+	if ac.objects() > c {
+		t.Errorf("The cache has %d objects, more than %d", ac.objects(), c)
+	}
+	if ac.lists[t1].Len()+ac.lists[b1].Len() > c {
+		t.Errorf("t1 and b1 have %d objects, more than %d",
+			ac.lists[t1].Len()+ac.lists[b1].Len(), c)
+	}
+	var all = ac.objects() + ac.lists[b1].Len() + ac.lists[b2].Len()
+	if all > 2*c {
+		t.Errorf("All lists have %d objects, more than %d", all, 2*c)
+	}
+	if all != len(ac.lookup) {
+		t.Errorf("The lists have %d objects but the lookup map has %d", all, len(ac.lookup))
+	}
+	if ac.p < 0 || ac.p > c {
+		t.Errorf("The target size of t1 %d is out of bounds", ac.p)
+	}
+}
+
+func TestLookupAddAndRemove(t *testing.T) {
+	t.Parallel()
+	var removed = make(map[types.ObjectIndexHash]bool)
+	ac := New(getCacheZone(10), func(oi *types.ObjectIndex) error {
+		removed[oi.Hash()] = true
+		return nil
+	}, mock.NewLogger())
+
+	var indexes = objectIndexes("/obj/", 30)
+	if ac.Lookup(indexes[0]) {
+		t.Error("Empty cache should not contain anything")
+	}
+	if err := ac.AddObject(indexes[0], ac.cfg.PartSize); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if err := ac.AddObject(indexes[0], 5); err != types.ErrAlreadyInCache {
+		t.Errorf("Expected ErrAlreadyInCache but got %v", err)
+	}
+	if ac.ConsumedSize() != 5 {
+		t.Errorf("Expected the size to be updated to 5 but it is %d", ac.ConsumedSize())
+	}
+	if !ac.Lookup(indexes[0]) {
+		t.Error("The added object should be in the cache")
+	}
+	ac.Remove(indexes[0])
+	if ac.Lookup(indexes[0]) {
+		t.Error("The removed object should not be in the cache")
+	}
+
+	for i, idx := range indexes {
+		access(ac, idx)
+		access(ac, indexes[i/2])
+		checkSizes(t, ac)
+	}
+	for _, idx := range indexes[1:] {
+		if !ac.isCached(idx.Hash()) && !removed[idx.Hash()] {
+			t.Errorf("Object %s is not in the cache but was not removed", idx)
+		}
+	}
+
+	stats := ac.Stats()
+	if stats.Objects() != uint64(ac.objects()) || stats.Size() != ac.ConsumedSize() {
+		t.Errorf("Wrong stats %+v", stats)
+	}
+}
+
+func TestGhostHitsAdaptTheTarget(t *testing.T) {
+	t.Parallel()
+	ac := New(getCacheZone(10), mockRemove, mock.NewLogger())
+
+	// Fill the cache with objects used twice and once and evict some of the
+	// latter
+	for _, idx := range objectIndexes("/frequent/", 5) {
+		access(ac, idx)
+		access(ac, idx)
+	}
+	var indexes = objectIndexes("/obj/", 10)
+	for _, idx := range indexes {
+		access(ac, idx)
+	}
+	checkSizes(t, ac)
+	if ac.lists[b1].Len() == 0 {
+		t.Fatal("Expected some objects to be remembered in b1")
+	}
+
+	// Requesting an evicted object should favour the recent objects
+	access(ac, indexes[0])
+	checkSizes(t, ac)
+	if ac.p == 0 {
+		t.Error("Expected the target size of t1 to grow after a hit in b1")
+	}
+	if e := ac.lookup[indexes[0].Hash()]; e == nil || e.list != t2 {
+		t.Error("Expected the object from b1 to be put in t2")
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	t.Parallel()
+	ac := New(getCacheZone(100), mockRemove, mock.NewLogger())
+
+	var hot = objectIndexes("/hot/", 50)
+	for round := 0; round < 3; round++ {
+		for _, idx := range hot {
+			access(ac, idx)
+		}
+	}
+	for _, idx := range objectIndexes("/scan/", 1000) {
+		access(ac, idx)
+		checkSizes(t, ac)
+	}
+
+	for _, idx := range hot {
+		if !ac.isCached(idx.Hash()) {
+			t.Errorf("The popular object %s was evicted by the scan", idx)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	t.Parallel()
+	var removed = make(chan *types.ObjectIndex, 100)
+	ac := New(getCacheZone(100), func(oi *types.ObjectIndex) error {
+		removed <- oi
+		return nil
+	}, mock.NewLogger())
+
+	for _, idx := range objectIndexes("/obj/", 100) {
+		access(ac, idx)
+	}
+	ac.ChangeConfig(1, 10, 50)
+	checkSizes(t, ac)
+	if ac.objects() != 50 {
+		t.Errorf("Expected 50 objects after the resize but got %d", ac.objects())
+	}
+
+	for i := 0; i < 50; i++ {
+		select {
+		case <-removed:
+		case <-time.After(time.Second):
+			t.Fatalf("Only %d objects were removed after the resize", i)
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/ironsmile/nedomi/config"
 	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/cacheutils"
 )
 
 var debug bool
@@ -34,6 +35,9 @@ type Element struct {
 
 	// In which tier this LRU element is. Tiers are from 0 up to cacheTiers
 	ListTier int
+
+	// The size of the object in bytes
+	Size types.BytesSize
 }
 
 // TieredLRUCache implements segmented LRU Cache. It has cacheTiers segments.
@@ -46,9 +50,18 @@ type TieredLRUCache struct {
 	lookup map[types.ObjectIndexHash]*Element
 	mutex  sync.Mutex
 
+	// How many full sized parts fit in every tier
 	tierListSize int
 
+	// How many bytes the objects in every tier take
+	tierBytes [cacheTiers]types.BytesSize
+
 	removeFunc func(*types.ObjectIndex) error
+	admission  *cacheutils.AdmissionFilter
+
+	// The positions of the objects from the loaded snapshot. It is used
+	// while the cache is restored and is nil otherwise.
+	snapshot map[types.ObjectIndexHash]snapshotPosition
 
 	// Used to track cache hit/miss information
 	requests uint64
@@ -71,33 +84,47 @@ func (tc *TieredLRUCache) Lookup(oi *types.ObjectIndex) bool {
 	return ok
 }
 
-// ShouldKeep implements part of types.CacheAlgorithm interface
+// ShouldKeep implements part of types.CacheAlgorithm interface. The object is
+// added with the full part size as its actual size is not known yet. It is
+// corrected when the object is added again after it is saved.
 func (tc *TieredLRUCache) ShouldKeep(oi *types.ObjectIndex) bool {
-	if err := tc.AddObject(oi); err != nil && err != types.ErrAlreadyInCache {
+	if !tc.admission.Admit(oi) {
+		return false
+	}
+	if err := tc.AddObject(oi, tc.cfg.PartSize); err != nil && err != types.ErrAlreadyInCache {
 		tc.GetLogger().Errorf("Error storing object: %s", err)
 	}
 	return true
 }
 
-// AddObject implements part of types.CacheAlgorithm interface
-func (tc *TieredLRUCache) AddObject(oi *types.ObjectIndex) error {
+// AddObject implements part of types.CacheAlgorithm interface. When the
+// object is already in the cache only its size is updated.
+func (tc *TieredLRUCache) AddObject(oi *types.ObjectIndex, size types.BytesSize) error {
 	tc.mutex.Lock()
 	defer tc.mutex.Unlock()
 
-	if _, ok := tc.lookup[oi.Hash()]; ok {
+	if el, ok := tc.lookup[oi.Hash()]; ok {
+		if el.Size != size {
+			tc.tierBytes[el.ListTier] -= el.Size
+			el.Size = size
+			tc.tierBytes[el.ListTier] += el.Size
+			tc.removeObjects(tc.rebalance(el.ListTier))
+		}
 		return types.ErrAlreadyInCache
 	}
 
-	lastList := tc.tiers[cacheTiers-1]
+	if tc.snapshot != nil && tc.addFromSnapshot(oi, size) {
+		tc.GetLogger().Debugf("Storing %s in lru from snapshot", oi)
+		return nil
+	}
 
-	if lastList.Len() >= tc.tierListSize {
+	lastListInd := cacheTiers - 1
+	for !tc.hasSpace(lastListInd, size) && tc.tiers[lastListInd].Len() > 0 {
 		tc.freeSpaceInLastList()
 	}
 
-	le := &Element{
-		ListTier: cacheTiers - 1,
-		ListElem: lastList.PushFront(*oi),
-	}
+	le := &Element{Size: size}
+	tc.pushFront(le, *oi, lastListInd)
 
 	tc.GetLogger().Debugf("Storing %s in lru", oi)
 	tc.lookup[oi.Hash()] = le
@@ -117,9 +144,18 @@ func (tc *TieredLRUCache) freeSpaceInLastList() {
 		return
 	}
 
+	// The object which will be moved in a tier is the front one of the first
+	// non empty tier below it.
 	freeList := -1
+	var movedSize types.BytesSize
 	for i := lastListInd - 1; i >= 0; i-- {
-		if tc.tiers[i].Len() < tc.tierListSize {
+		if front := tc.tiers[i+1].Front(); front != nil {
+			val := front.Value.(types.ObjectIndex)
+			if el, ok := tc.lookup[val.Hash()]; ok {
+				movedSize = el.Size
+			}
+		}
+		if tc.hasSpace(i, movedSize) {
 			freeList = i
 			break
 		}
@@ -133,28 +169,106 @@ func (tc *TieredLRUCache) freeSpaceInLastList() {
 			if front == nil {
 				continue
 			}
-			val := tc.tiers[i].Remove(front).(types.ObjectIndex)
+			val := front.Value.(types.ObjectIndex)
 			valLruEl, ok := tc.lookup[val.Hash()]
 			if !ok {
 				tc.GetLogger().Errorf("ERROR! Object in cache list was not found in the "+
 					" lookup map: %v", val)
+				tc.tiers[i].Remove(front)
 				i++
 				continue
 			}
-			valLruEl.ListElem = tc.tiers[i-1].PushBack(val)
-			valLruEl.ListTier = i - 1
+			tc.removeElement(valLruEl)
+			tc.pushBack(valLruEl, val, i-1)
 		}
+		// The objects moved in the tiers may be bigger than the ones which
+		// were moved out of them.
+		tc.removeObjects(tc.rebalance(freeList + 1))
 	} else {
 		// There is no free slots anywhere in the upper tiers. So we will have to
 		// remove something from the cache in order to make space.
-		val := lastList.Remove(lastList.Back()).(types.ObjectIndex)
+		val, _ := tc.removeBack(lastListInd)
+		delete(tc.lookup, val.Hash())
+		tc.removeObjects([]types.ObjectIndex{val})
+	}
+}
+
+// rebalance moves the least recently used objects of the tiers which are over
+// their size to the front of the lower tiers, starting from the supplied
+// tier. The objects which do not fit in the last tier are removed from the
+// cache and returned so that they can be removed from the storage.
+func (tc *TieredLRUCache) rebalance(from int) []types.ObjectIndex {
+	lastListInd := cacheTiers - 1
+	for i := from; i < lastListInd; i++ {
+		for !tc.hasSpace(i, 0) && tc.tiers[i].Len() > 0 {
+			if val, el := tc.removeBack(i); el != nil {
+				tc.pushFront(el, val, i+1)
+			}
+		}
+	}
+
+	var removed []types.ObjectIndex
+	for !tc.hasSpace(lastListInd, 0) && tc.tiers[lastListInd].Len() > 0 {
+		val, _ := tc.removeBack(lastListInd)
 		delete(tc.lookup, val.Hash())
-		if err := tc.removeFunc(&val); err != nil {
-			tc.GetLogger().Logf("error while removing %s from cache - %s", &val, err)
+		removed = append(removed, val)
+	}
+	return removed
+}
+
+// removeObjects removes the objects which are no longer in the cache from the
+// storage.
+func (tc *TieredLRUCache) removeObjects(ois []types.ObjectIndex) {
+	for i := range ois {
+		if err := tc.removeFunc(&ois[i]); err != nil {
+			tc.GetLogger().Logf("error while removing %s from cache - %s", &ois[i], err)
 		}
 	}
 }
 
+// tierSize returns how many bytes fit in every tier.
+func (tc *TieredLRUCache) tierSize() types.BytesSize {
+	return tc.cfg.PartSize * types.BytesSize(tc.tierListSize)
+}
+
+// hasSpace returns whether an object with the supplied size fits in the tier.
+func (tc *TieredLRUCache) hasSpace(tier int, size types.BytesSize) bool {
+	return tc.tierBytes[tier]+size <= tc.tierSize()
+}
+
+func (tc *TieredLRUCache) pushFront(el *Element, oi types.ObjectIndex, tier int) {
+	el.ListElem = tc.tiers[tier].PushFront(oi)
+	el.ListTier = tier
+	tc.tierBytes[tier] += el.Size
+}
+
+func (tc *TieredLRUCache) pushBack(el *Element, oi types.ObjectIndex, tier int) {
+	el.ListElem = tc.tiers[tier].PushBack(oi)
+	el.ListTier = tier
+	tc.tierBytes[tier] += el.Size
+}
+
+func (tc *TieredLRUCache) removeElement(el *Element) {
+	tc.tiers[el.ListTier].Remove(el.ListElem)
+	tc.tierBytes[el.ListTier] -= el.Size
+}
+
+// removeBack removes the least recently used object from the tier and returns
+// it along with its lookup element. The element is nil when the cache is
+// inconsistent and the object is not in the lookup map.
+func (tc *TieredLRUCache) removeBack(tier int) (types.ObjectIndex, *Element) {
+	val := tc.tiers[tier].Back().Value.(types.ObjectIndex)
+	el, ok := tc.lookup[val.Hash()]
+	if !ok {
+		tc.GetLogger().Errorf("ERROR! Object in cache list was not found in the "+
+			" lookup map: %v", val)
+		tc.tiers[tier].Remove(tc.tiers[tier].Back())
+		return val, nil
+	}
+	tc.removeElement(el)
+	return val, el
+}
+
 // Remove the objects given from the cache.
 func (tc *TieredLRUCache) Remove(ois ...*types.ObjectIndex) {
 	tc.mutex.Lock()
@@ -163,7 +277,7 @@ func (tc *TieredLRUCache) Remove(ois ...*types.ObjectIndex) {
 	for _, oi := range ois {
 		if el, ok := tc.lookup[oi.Hash()]; ok {
 			delete(tc.lookup, oi.Hash())
-			tc.tiers[el.ListTier].Remove(el.ListElem)
+			tc.removeElement(el)
 		}
 	}
 }
@@ -186,8 +300,9 @@ func (tc *TieredLRUCache) PromoteObject(oi *types.ObjectIndex) {
 		// AddObject which tries to lock it too.
 		tc.mutex.Unlock()
 
-		// This object is not in the cache yet. So we add it.
-		if err := tc.AddObject(oi); err != nil {
+		// This object is not in the cache yet. So we add it. Its size is
+		// not known so it is considered a full part.
+		if err := tc.AddObject(oi, tc.cfg.PartSize); err != nil {
 			tc.GetLogger().Errorf("Adding object in cache failed. Object: %v\n%s", oi, err)
 		}
 
@@ -207,39 +322,18 @@ func (tc *TieredLRUCache) PromoteObject(oi *types.ObjectIndex) {
 		return
 	}
 
-	upperTier := tc.tiers[lruEl.ListTier-1]
-
-	defer func() {
-		currentTier.Remove(lruEl.ListElem)
-		lruEl.ListElem = upperTier.PushFront(*oi)
-		lruEl.ListTier--
-	}()
-
-	if upperTier.Len() < tc.tierListSize {
-		// The upper tier is not yet full. So we can push our object at the end
-		// of it without needing to remove anything from it.
-		return
-	}
-
-	// The upper tier is full. An element from it will be swapped with the one
-	// currently promoted.
-	upperListLastOi := upperTier.Remove(upperTier.Back()).(types.ObjectIndex)
-	upperListLastLruEl, ok := tc.lookup[upperListLastOi.Hash()]
-
-	if !ok {
-		tc.GetLogger().Error("ERROR! Cache inconsistency. Element from the linked list " +
-			"was not found in the lookup table")
-		return
-	}
-
-	upperListLastLruEl.ListElem = currentTier.PushFront(upperListLastOi)
-	upperListLastLruEl.ListTier = lruEl.ListTier
+	// When the upper tier is full its least recently used objects are moved
+	// to the front of the tier of the promoted object.
+	var tier = lruEl.ListTier
+	tc.removeElement(lruEl)
+	tc.pushFront(lruEl, *oi, tier-1)
+	tc.removeObjects(tc.rebalance(tier - 1))
 }
 
 func (tc *TieredLRUCache) checkTiers() {
 	for i := 0; i < cacheTiers; i++ {
-		if tc.tiers[i].Len() > tc.tierListSize {
-			tc.GetLogger().Error(i, tc.tiers[i].Len())
+		if tc.tierBytes[i] > tc.tierSize() {
+			tc.GetLogger().Error(i, tc.tiers[i].Len(), tc.tierBytes[i])
 			panic("tiers are not accurately sized")
 		}
 	}
@@ -257,7 +351,7 @@ func (tc *TieredLRUCache) consumedSize() types.BytesSize {
 	var sum types.BytesSize
 
 	for i := 0; i < cacheTiers; i++ {
-		sum += (tc.cfg.PartSize * types.BytesSize(tc.tiers[i].Len()))
+		sum += tc.tierBytes[i]
 	}
 
 	return sum
@@ -269,6 +363,7 @@ func (tc *TieredLRUCache) init() {
 	}
 	tc.lookup = make(map[types.ObjectIndexHash]*Element)
 	tc.tierListSize = int(tc.cfg.StorageObjects / uint64(cacheTiers))
+	tc.admission = cacheutils.NewAdmissionFilter(tc.cfg)
 }
 
 // New returns TieredLRUCache object ready for use.
@@ -302,43 +397,24 @@ func (tc *TieredLRUCache) resize() {
 
 	var newtierListSize = int(tc.cfg.StorageObjects / 4)
 	if tc.tierListSize > newtierListSize {
-		var oids = tc.resizeDown(int(tc.stats().Objects() - tc.cfg.StorageObjects))
-
-		for _, oi := range oids {
-			delete(tc.lookup, oi.Hash())
-		}
-
-		// for each tier from the upper most without the last
-		for i := 0; cacheTiers-1 > i; i++ {
-			// while it's bigger than the new size
-			for tc.tiers[i].Len() > newtierListSize {
-				// move it's last element to the lower tier
-				back := tc.tiers[i].Back()
-				val := tc.tiers[i].Remove(back).(types.ObjectIndex)
-				valLruEl, ok := tc.lookup[val.Hash()]
-				if !ok {
-					tc.GetLogger().Errorf("ERROR! Object in cache list was not found in the "+
-						" lookup map during resize: %v", val)
-					continue
-				}
-				valLruEl.ListElem = tc.tiers[i+1].PushFront(val)
-				valLruEl.ListTier = i + 1
-			}
-		}
+		tc.tierListSize = newtierListSize
 
+		// The least recently used objects which do not fit in the new size
+		// are removed first.
 		var (
-			additionalOids []types.ObjectIndex
-			last           = tc.tiers[cacheTiers-1]
+			oids    []types.ObjectIndex
+			newSize = tc.tierSize() * cacheTiers
 		)
-		for last.Len() > newtierListSize {
-			additionalOids = append(additionalOids, last.Remove(last.Back()).(types.ObjectIndex))
-		}
-
-		for _, oi := range additionalOids {
-			delete(tc.lookup, oi.Hash())
+		for i := cacheTiers - 1; i >= 0; i-- {
+			for tc.tiers[i].Len() > 0 && tc.consumedSize() > newSize {
+				val, _ := tc.removeBack(i)
+				delete(tc.lookup, val.Hash())
+				oids = append(oids, val)
+			}
 		}
 
-		go tc.throttledRemove(append(oids, additionalOids...))
+		// Then the rest are moved down the tiers until they fit in them.
+		go tc.throttledRemove(append(oids, tc.rebalance(0)...))
 	}
 	tc.tierListSize = newtierListSize
 }
@@ -384,35 +460,3 @@ func (tc *TieredLRUCache) removeIfMissing(ois ...types.ObjectIndex) {
 		}
 	}
 }
-
-func (tc *TieredLRUCache) resizeDown(remove int) []types.ObjectIndex {
-	if 0 >= remove {
-		return nil
-	}
-	var result = make([]types.ObjectIndex, remove)
-	lastListInd := cacheTiers - 1
-	var removed = 0
-	var i int
-
-	for i = lastListInd; i >= 0 && remove != removed; i-- {
-		removed += removeFromList(tc.tiers[i], remove-removed, result[removed:])
-	}
-
-	return result
-}
-
-// removes up to n elements from the list starting backwards and putting their
-// values in the removed slice (which should be atleast remove big). Also returns how
-// many were removed
-func removeFromList(l *list.List, remove int, removed []types.ObjectIndex) int {
-	var e = l.Back()
-	var prev *list.Element
-	var i = 0
-	for ; remove > i && e != nil; i++ {
-		prev = e.Prev()
-		removed[i] = l.Remove(e).(types.ObjectIndex)
-		e = prev
-	}
-
-	return i
-}
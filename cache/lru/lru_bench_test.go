@@ -69,7 +69,7 @@ func BenchmarkLookupAndRemove(b *testing.B) {
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
 			oi := getObjectIndexFor(randUint32(), "1.1", randPath())
-			lru.AddObject(oi)
+			lru.AddObject(oi, lru.cfg.PartSize)
 			if !lru.Lookup(oi) {
 				atomic.AddUint64(&tooFast, 1)
 			}
@@ -76,7 +76,7 @@ func TestLookupAndRemove(t *testing.T) {
 		t.Error("Empty LRU cache returned True for a object index lookup")
 	}
 
-	if err := lru.AddObject(oi); err != nil {
+	if err := lru.AddObject(oi, lru.cfg.PartSize); err != nil {
 		t.Errorf("Error adding object into the cache. %s", err)
 	}
 	oi = getObjectIndex() // get a new/same objectIndex
@@ -97,7 +97,7 @@ func TestSize(t *testing.T) {
 	oi := getObjectIndex()
 	lru := New(cz, nil, mock.NewLogger())
 
-	if err := lru.AddObject(oi); err != nil {
+	if err := lru.AddObject(oi, lru.cfg.PartSize); err != nil {
 		t.Errorf("Error adding object into the cache. %s", err)
 	}
 
@@ -105,7 +105,7 @@ func TestSize(t *testing.T) {
 		t.Errorf("Expec 1 object but found %d", objects)
 	}
 
-	if err := lru.AddObject(oi); err == nil {
+	if err := lru.AddObject(oi, lru.cfg.PartSize); err == nil {
 		t.Error("Exepected error when adding object for the second time")
 	}
 
@@ -115,7 +115,7 @@ func TestSize(t *testing.T) {
 			ObjID: types.NewObjectID("1.1", "/path/to/other/object"),
 		}
 
-		if err := lru.AddObject(oii); err != nil {
+		if err := lru.AddObject(oii, lru.cfg.PartSize); err != nil {
 			t.Errorf("Adding object in cache. %s", err)
 		}
 	}
@@ -212,6 +212,66 @@ func TestShouldKeepMethod(t *testing.T) {
 		t.Error("ShouldKeep returned false after its second call")
 	}
 
+	if err := lru.AddObject(oi, 1024); err != types.ErrAlreadyInCache {
+		t.Errorf("Expected ErrAlreadyInCache for an object added by ShouldKeep but got %v", err)
+	}
+
+	if size := lru.ConsumedSize(); size != 1024 {
+		t.Errorf("Expected the size of the saved object to be used but the size was %d", size)
+	}
+}
+
+func TestByteWeightedEviction(t *testing.T) {
+	t.Parallel()
+	cz := getCacheZone()
+	var removed []types.ObjectIndex
+	lru := New(cz, func(oi *types.ObjectIndex) error {
+		removed = append(removed, *oi)
+		return nil
+	}, mock.NewLogger())
+	defer printOnFailure(t, lru)
+
+	var (
+		halfPart = cz.PartSize / 2
+		capacity = cz.PartSize * types.BytesSize(lru.tierListSize*cacheTiers)
+		fits     = int(capacity / halfPart)
+	)
+	for i := 0; i < fits; i++ {
+		oi := &types.ObjectIndex{
+			Part:  uint32(i),
+			ObjID: types.NewObjectID("1.1", "/path/to/small/objects"),
+		}
+		if err := lru.AddObject(oi, halfPart); err != nil {
+			t.Errorf("Adding object in cache. %s", err)
+		}
+	}
+
+	if objects := lru.Stats().Objects(); objects != uint64(fits) {
+		t.Errorf("Expected %d half part objects in the cache but found %d", fits, objects)
+	}
+	if size := lru.ConsumedSize(); size != capacity {
+		t.Errorf("Expected the cache to be full with %d bytes but it had %d", capacity, size)
+	}
+	if len(removed) != 0 {
+		t.Errorf("Expected no objects to be removed but %d were", len(removed))
+	}
+
+	// A full part does not fit in the space of one half part object
+	if err := lru.AddObject(getObjectIndex(), cz.PartSize); err != nil {
+		t.Errorf("Adding object in cache. %s", err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("Expected 2 half part objects to be removed but %d were", len(removed))
+	}
+	if size := lru.Stats().Size(); size != capacity {
+		t.Errorf("Expected the cache stats to show %d bytes but they showed %d", capacity, size)
+	}
+	for i := 0; i < cacheTiers; i++ {
+		if lru.tierBytes[i] > lru.tierSize() {
+			t.Errorf("Tier %d has %d bytes which is more than its size %d",
+				i, lru.tierBytes[i], lru.tierSize())
+		}
+	}
 }
 
 func TestPromotionToTheFrontOfTheList(t *testing.T) {
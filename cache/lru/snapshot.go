@@ -0,0 +1,226 @@
+package lru
+
+// This file contains the TieredLRUCache's implementation of the
+// types.CacheSnapshotter interface.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ironsmile/nedomi/types"
+)
+
+// SnapshotFileName is the name of the file in the cache zone path in which
+// the tiers of the cache are saved.
+const SnapshotFileName = "lru.snapshot"
+
+// The snapshot file starts with snapshotMagic and then for every tier there
+// is the number of objects in it followed by their hashes from the front to
+// the back of the tier.
+var snapshotMagic = [8]byte{'n', 'e', 'd', 'o', 'l', 'r', 'u', 1}
+
+// snapshotPosition is where an object was in the cache when the snapshot was
+// saved.
+type snapshotPosition struct {
+	tier  int
+	index int
+}
+
+func (tc *TieredLRUCache) snapshotPath() string {
+	return filepath.Join(tc.cfg.Path, SnapshotFileName)
+}
+
+// SaveSnapshot implements part of types.CacheSnapshotter. It writes the hashes
+// of the objects in every tier to a file in the cache zone path.
+func (tc *TieredLRUCache) SaveSnapshot() error {
+	var tiers [cacheTiers][]types.ObjectIndexHash
+	tc.mutex.Lock()
+	for i := 0; i < cacheTiers; i++ {
+		tiers[i] = make([]types.ObjectIndexHash, 0, tc.tiers[i].Len())
+		for e := tc.tiers[i].Front(); e != nil; e = e.Next() {
+			oi := e.Value.(types.ObjectIndex)
+			tiers[i] = append(tiers[i], oi.Hash())
+		}
+	}
+	tc.mutex.Unlock()
+
+	// Written in a temporary file first so that a crash while saving does not
+	// leave a broken snapshot
+	f, err := ioutil.TempFile(tc.cfg.Path, SnapshotFileName)
+	if err != nil {
+		return err
+	}
+	if err := writeSnapshot(f, tiers); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), tc.snapshotPath()); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	tc.GetLogger().Debugf("[LRU] Saved snapshot of cache zone `%s`", tc.cfg.ID)
+	return nil
+}
+
+func writeSnapshot(w io.Writer, tiers [cacheTiers][]types.ObjectIndexHash) error {
+	var buf = bufio.NewWriter(w)
+	if _, err := buf.Write(snapshotMagic[:]); err != nil {
+		return err
+	}
+	for _, tier := range tiers {
+		if err := binary.Write(buf, binary.BigEndian, uint32(len(tier))); err != nil {
+			return err
+		}
+		for _, hash := range tier {
+			if _, err := buf.Write(hash[:]); err != nil {
+				return err
+			}
+		}
+	}
+	return buf.Flush()
+}
+
+func readSnapshot(r io.Reader) (map[types.ObjectIndexHash]snapshotPosition, error) {
+	var (
+		buf    = bufio.NewReader(r)
+		magic  [len(snapshotMagic)]byte
+		result = make(map[types.ObjectIndexHash]snapshotPosition)
+	)
+	if _, err := io.ReadFull(buf, magic[:]); err != nil {
+		return nil, err
+	}
+	if magic != snapshotMagic {
+		return nil, errors.New("unknown snapshot format")
+	}
+
+	for tier := 0; tier < cacheTiers; tier++ {
+		var count uint32
+		if err := binary.Read(buf, binary.BigEndian, &count); err != nil {
+			return nil, err
+		}
+		for index := 0; index < int(count); index++ {
+			var hash types.ObjectIndexHash
+			if _, err := io.ReadFull(buf, hash[:]); err != nil {
+				return nil, err
+			}
+			result[hash] = snapshotPosition{tier: tier, index: index}
+		}
+	}
+
+	return result, nil
+}
+
+// LoadSnapshot implements part of types.CacheSnapshotter. Until RestoreFinished
+// is called the added objects which are found in the snapshot are put in
+// their previous tiers. A missing snapshot is not an error.
+func (tc *TieredLRUCache) LoadSnapshot() error {
+	f, err := os.Open(tc.snapshotPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	snapshot, err := readSnapshot(f)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %s", f.Name(), err)
+	}
+
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	tc.snapshot = snapshot
+	tc.GetLogger().Logf("[LRU] Loaded snapshot with %d objects for cache zone `%s`",
+		len(snapshot), tc.cfg.ID)
+	return nil
+}
+
+// RestoreFinished implements part of types.CacheSnapshotter. It puts the
+// objects in every tier in the order from the snapshot. Objects which were
+// not in the tier in the snapshot are considered the most recent.
+func (tc *TieredLRUCache) RestoreFinished() {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if tc.snapshot == nil {
+		return
+	}
+	if debug {
+		defer tc.checkTiers()
+	}
+
+	for i := 0; i < cacheTiers; i++ {
+		var sorter = &snapshotSorter{
+			objects: make([]types.ObjectIndex, 0, tc.tiers[i].Len()),
+			indexes: make([]int, 0, tc.tiers[i].Len()),
+		}
+		for e := tc.tiers[i].Front(); e != nil; e = e.Next() {
+			oi := e.Value.(types.ObjectIndex)
+			sorter.objects = append(sorter.objects, oi)
+			sorter.indexes = append(sorter.indexes, tc.snapshotIndex(&oi, i))
+		}
+		sort.Stable(sorter)
+
+		tc.tiers[i].Init()
+		for _, oi := range sorter.objects {
+			tc.lookup[oi.Hash()].ListElem = tc.tiers[i].PushBack(oi)
+		}
+	}
+
+	tc.snapshot = nil
+}
+
+// snapshotSorter sorts the objects of a tier by their indexes in the snapshot
+type snapshotSorter struct {
+	objects []types.ObjectIndex
+	indexes []int
+}
+
+func (s *snapshotSorter) Len() int {
+	return len(s.objects)
+}
+
+func (s *snapshotSorter) Less(i, j int) bool {
+	return s.indexes[i] < s.indexes[j]
+}
+
+func (s *snapshotSorter) Swap(i, j int) {
+	s.objects[i], s.objects[j] = s.objects[j], s.objects[i]
+	s.indexes[i], s.indexes[j] = s.indexes[j], s.indexes[i]
+}
+
+// snapshotIndex returns the index of the object in the tier in the snapshot or
+// -1 if it was not in this tier in the snapshot.
+func (tc *TieredLRUCache) snapshotIndex(oi *types.ObjectIndex, tier int) int {
+	if pos, ok := tc.snapshot[oi.Hash()]; ok && pos.tier == tier {
+		return pos.index
+	}
+	return -1
+}
+
+// addFromSnapshot puts the object in the tier it was in according to the
+// snapshot. It returns false if the object is not in the snapshot or there is
+// no space for it in its tier.
+func (tc *TieredLRUCache) addFromSnapshot(oi *types.ObjectIndex, size types.BytesSize) bool {
+	pos, ok := tc.snapshot[oi.Hash()]
+	if !ok || !tc.hasSpace(pos.tier, size) {
+		return false
+	}
+
+	le := &Element{Size: size}
+	tc.pushBack(le, *oi, pos.tier)
+	tc.lookup[oi.Hash()] = le
+	return true
+}
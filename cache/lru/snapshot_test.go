@@ -0,0 +1,142 @@
+package lru
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ironsmile/nedomi/mock"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/testutils"
+)
+
+func tierContents(tc *TieredLRUCache) [cacheTiers][]types.ObjectIndexHash {
+	var result [cacheTiers][]types.ObjectIndexHash
+	for i := 0; i < cacheTiers; i++ {
+		for e := tc.tiers[i].Front(); e != nil; e = e.Next() {
+			oi := e.Value.(types.ObjectIndex)
+			result[i] = append(result[i], oi.Hash())
+			if tc.lookup[oi.Hash()].ListTier != i || tc.lookup[oi.Hash()].ListElem != e {
+				panic("the lookup map is not consistent with the tiers")
+			}
+		}
+	}
+	return result
+}
+
+func TestSnapshotSaveAndRestore(t *testing.T) {
+	t.Parallel()
+	path, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+
+	cz := getCacheZone()
+	cz.Path = path
+	original := New(cz, mockRemove, mock.NewLogger())
+	fillCache(t, original)
+
+	var objects []*types.ObjectIndex
+	for i := 0; i < cacheTiers; i++ {
+		for e := original.tiers[i].Front(); e != nil; e = e.Next() {
+			oi := e.Value.(types.ObjectIndex)
+			objects = append(objects, &oi)
+		}
+	}
+	// Mix the order inside the tiers a bit
+	original.PromoteObject(objects[len(objects)-1])
+	original.PromoteObject(objects[2])
+
+	if err := original.SaveSnapshot(); err != nil {
+		t.Fatalf("Unexpected error while saving the snapshot: %s", err)
+	}
+
+	restored := New(getCacheZone(), mockRemove, mock.NewLogger())
+	restored.cfg.Path = path
+	if err := restored.LoadSnapshot(); err != nil {
+		t.Fatalf("Unexpected error while loading the snapshot: %s", err)
+	}
+	for _, i := range rand.Perm(len(objects)) {
+		if err := restored.AddObject(objects[i], restored.cfg.PartSize); err != nil {
+			t.Errorf("Unexpected error while adding %s: %s", objects[i], err)
+		}
+	}
+	restored.RestoreFinished()
+
+	if expected, got := tierContents(original), tierContents(restored); !reflect.DeepEqual(expected, got) {
+		t.Errorf("The restored tiers differ from the original\nexpected %v\ngot %v", expected, got)
+	}
+	if restored.snapshot != nil {
+		t.Error("The snapshot should not be kept after the restore is finished")
+	}
+}
+
+func TestSnapshotNewObjectsAreMostRecent(t *testing.T) {
+	t.Parallel()
+	path, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+
+	cz := getCacheZone()
+	cz.Path = path
+	lru := New(cz, mockRemove, mock.NewLogger())
+	old := &types.ObjectIndex{ObjID: types.NewObjectID("1.1", "/old"), Part: 0}
+	fresh := &types.ObjectIndex{ObjID: types.NewObjectID("1.1", "/new"), Part: 0}
+	if err := lru.AddObject(old, lru.cfg.PartSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := lru.SaveSnapshot(); err != nil {
+		t.Fatalf("Unexpected error while saving the snapshot: %s", err)
+	}
+
+	lru = New(cz, mockRemove, mock.NewLogger())
+	if err := lru.LoadSnapshot(); err != nil {
+		t.Fatalf("Unexpected error while loading the snapshot: %s", err)
+	}
+	if err := lru.AddObject(old, lru.cfg.PartSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := lru.AddObject(fresh, lru.cfg.PartSize); err != nil {
+		t.Fatal(err)
+	}
+	lru.RestoreFinished()
+
+	last := lru.tiers[cacheTiers-1]
+	if front := last.Front().Value.(types.ObjectIndex); front.Hash() != fresh.Hash() {
+		t.Errorf("Expected %s to be the most recent object but it was %s", fresh, &front)
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	t.Parallel()
+	path, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+
+	cz := getCacheZone()
+	cz.Path = path
+	lru := New(cz, mockRemove, mock.NewLogger())
+	if err := lru.LoadSnapshot(); err != nil {
+		t.Errorf("A missing snapshot should not be an error but got: %s", err)
+	}
+
+	var snapshotPath = filepath.Join(path, SnapshotFileName)
+	for _, contents := range []string{"", "wrong magic", string(snapshotMagic[:]) + "\x00\x00\x00\x05short"} {
+		if err := ioutil.WriteFile(snapshotPath, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := lru.LoadSnapshot(); err == nil {
+			t.Errorf("Expected an error for snapshot %q", contents)
+		}
+	}
+	if lru.snapshot != nil {
+		t.Error("A broken snapshot should not be used")
+	}
+	// Nothing should change without a snapshot
+	lru.RestoreFinished()
+
+	cz.Path = filepath.Join(path, "missing")
+	if err := lru.SaveSnapshot(); err == nil {
+		t.Error("Expected an error when saving in a missing directory")
+	}
+}
+
+var _ types.CacheSnapshotter = (*TieredLRUCache)(nil)
@@ -17,6 +17,8 @@ type TieredCacheStats struct {
 	requests uint64
 	size     types.BytesSize
 	objects  uint64
+	admitted uint64
+	rejected uint64
 }
 
 // CacheHitPrc implements part of CacheStats interface
@@ -52,6 +54,16 @@ func (lcs *TieredCacheStats) Requests() uint64 {
 	return lcs.requests
 }
 
+// Admitted implements part of CacheStats interface
+func (lcs *TieredCacheStats) Admitted() uint64 {
+	return lcs.admitted
+}
+
+// Rejected implements part of CacheStats interface
+func (lcs *TieredCacheStats) Rejected() uint64 {
+	return lcs.rejected
+}
+
 // Stats implements part of types.CacheAlgorithm interface
 func (tc *TieredLRUCache) Stats() types.CacheStats {
 	tc.mutex.Lock()
@@ -64,9 +76,8 @@ func (tc *TieredLRUCache) stats() types.CacheStats {
 	var allObjects uint64
 
 	for i := 0; i < cacheTiers; i++ {
-		objects := types.BytesSize(tc.tiers[i].Len())
-		sum += (tc.cfg.PartSize * objects)
-		allObjects += uint64(objects)
+		sum += tc.tierBytes[i]
+		allObjects += uint64(tc.tiers[i].Len())
 	}
 
 	return &TieredCacheStats{
@@ -75,5 +86,7 @@ func (tc *TieredLRUCache) stats() types.CacheStats {
 		requests: tc.requests,
 		size:     sum,
 		objects:  allObjects,
+		admitted: tc.admission.Admitted(),
+		rejected: tc.admission.Rejected(),
 	}
 }
@@ -14,16 +14,18 @@ func mockRemove(*types.ObjectIndex) error {
 
 func TestCreatingCacheAlgorithms(t *testing.T) {
 	t.Parallel()
-	cz := config.CacheZone{
-		ID:             "default",
-		Path:           "/does/not/matter",
-		PartSize:       4123123,
-		StorageObjects: 9813743,
-		Algorithm:      "lru",
-	}
-
-	if _, err := New(&cz, mockRemove, mock.NewLogger()); err != nil {
-		t.Errorf("Error when creating cache algorithm. %s", err)
+	for _, algorithm := range []string{"lru", "arc", "tinylfu"} {
+		cz := config.CacheZone{
+			ID:             "default",
+			Path:           "/does/not/matter",
+			PartSize:       4123123,
+			StorageObjects: 9813743,
+			Algorithm:      algorithm,
+		}
+
+		if _, err := New(&cz, mockRemove, mock.NewLogger()); err != nil {
+			t.Errorf("Error when creating cache algorithm %s. %s", algorithm, err)
+		}
 	}
 }
 
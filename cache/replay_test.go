@@ -0,0 +1,202 @@
+package cache
+
+// This file contains a harness for comparing the hit rates of the cache
+// algorithms. By default they are compared on a generated workload with Zipf
+// popularity. A real access log can be replayed instead with:
+//
+//	go test -run XXX -bench HitRate -replay-log /path/to/access.log ./cache/
+//
+// The hit rates are reported as the hit% metric of the benchmarks so the
+// results of different runs can be compared with benchstat.
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/mock"
+	"github.com/ironsmile/nedomi/types"
+)
+
+var replayLog string
+
+func init() {
+	flag.StringVar(&replayLog, "replay-log", "", "access log replayed by the hit rate benchmarks")
+}
+
+const replayPartSize = 2 * 1024 * 1024
+
+// replayRequest is a single request from the replayed workload
+type replayRequest struct {
+	id    *types.ObjectID
+	parts uint32
+}
+
+// parseAccessLogLine returns the request from a line written by the access
+// log of nedomi.
+func parseAccessLogLine(line string) (*replayRequest, error) {
+	// host -> location reqID - user [time] "METHOD uri PROTO" status size duration
+	var fields = strings.Fields(line)
+	if len(fields) < 3 {
+		return nil, errors.New("too short line")
+	}
+	var location = fields[2]
+
+	var start, end = strings.Index(line, `] "`), strings.LastIndex(line, `" `)
+	if start == -1 || end <= start {
+		return nil, errors.New("no request in the line")
+	}
+	var request = strings.Fields(line[start+3 : end])
+	var response = strings.Fields(line[end+2:])
+	if len(request) < 2 || len(response) < 2 {
+		return nil, errors.New("malformed request or response")
+	}
+	size, err := strconv.ParseUint(response[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &replayRequest{
+		id:    types.NewObjectID(location, request[1]),
+		parts: uint32(size/replayPartSize) + 1,
+	}, nil
+}
+
+func readAccessLog(r io.Reader) ([]*replayRequest, error) {
+	var result []*replayRequest
+	var scanner = bufio.NewScanner(r)
+	for scanner.Scan() {
+		if req, err := parseAccessLogLine(scanner.Text()); err == nil {
+			result = append(result, req)
+		}
+	}
+	return result, scanner.Err()
+}
+
+// zipfWorkload returns requests for objects with Zipf distributed popularity.
+func zipfWorkload(requests, objects int) []*replayRequest {
+	var (
+		r      = rand.New(rand.NewSource(42))
+		zipf   = rand.NewZipf(r, 1.1, 1, uint64(objects-1))
+		ids    = make([]*types.ObjectID, objects)
+		result = make([]*replayRequest, requests)
+	)
+	for i := range ids {
+		ids[i] = types.NewObjectID("replay", "/object/"+strconv.Itoa(i))
+	}
+	for i := range result {
+		result[i] = &replayRequest{id: ids[zipf.Uint64()], parts: uint32(1 + r.Intn(4))}
+	}
+	return result
+}
+
+// replay goes through the requests the way the cache handler uses the cache
+// algorithm and returns the hit rate.
+func replay(algorithm types.CacheAlgorithm, requests []*replayRequest) float64 {
+	for _, req := range requests {
+		for part := uint32(0); part < req.parts; part++ {
+			idx := &types.ObjectIndex{ObjID: req.id, Part: part}
+			if algorithm.Lookup(idx) {
+				algorithm.PromoteObject(idx)
+			} else if algorithm.ShouldKeep(idx) {
+				algorithm.AddObject(idx, replayPartSize)
+			}
+		}
+	}
+
+	var stats = algorithm.Stats()
+	if stats.Requests() == 0 {
+		return 0
+	}
+	return float64(stats.Hits()) / float64(stats.Requests())
+}
+
+func algorithmNames() []string {
+	var result []string
+	for name := range cacheTypes {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func newReplayAlgorithm(tb testing.TB, name string, objects uint64) types.CacheAlgorithm {
+	cz := &config.CacheZone{
+		ID:             "replay",
+		Path:           "/does/not/matter",
+		PartSize:       replayPartSize,
+		StorageObjects: objects,
+		Algorithm:      name,
+	}
+	algorithm, err := New(cz, mockRemove, mock.NewLogger())
+	if err != nil {
+		tb.Fatalf("Error when creating cache algorithm %s. %s", name, err)
+	}
+	return algorithm
+}
+
+func TestParseAccessLogLine(t *testing.T) {
+	t.Parallel()
+	var line = `127.0.0.1 -> example.com 1b2c3d - - [10/Oct/2016:13:55:36 +0300] ` +
+		`"GET /video/file.mp4?start=10 HTTP/1.1" 200 5242880 123456`
+	req, err := parseAccessLogLine(line)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if req.id.CacheKey() != "example.com" || req.id.Path() != "/video/file.mp4?start=10" {
+		t.Errorf("Wrong object id %s", req.id)
+	}
+	if req.parts != 3 {
+		t.Errorf("Expected 3 parts but got %d", req.parts)
+	}
+
+	if _, err := parseAccessLogLine("garbage"); err == nil {
+		t.Error("Expected an error for a malformed line")
+	}
+}
+
+func TestReplayHitRates(t *testing.T) {
+	t.Parallel()
+	var requests = zipfWorkload(20000, 2000)
+	for _, name := range algorithmNames() {
+		var rate = replay(newReplayAlgorithm(t, name, 1000), requests)
+		if rate <= 0 || rate >= 1 {
+			t.Errorf("Unexpected hit rate %f for %s", rate, name)
+		}
+	}
+}
+
+func BenchmarkHitRate(b *testing.B) {
+	var requests = zipfWorkload(200000, 50000)
+	if replayLog != "" {
+		f, err := os.Open(replayLog)
+		if err != nil {
+			b.Fatal(err)
+		}
+		requests, err = readAccessLog(f)
+		f.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, name := range algorithmNames() {
+		for _, objects := range []uint64{1000, 10000} {
+			b.Run(name+"/"+strconv.FormatUint(objects, 10), func(b *testing.B) {
+				var rate float64
+				for i := 0; i < b.N; i++ {
+					rate = replay(newReplayAlgorithm(b, name, objects), requests)
+				}
+				b.ReportMetric(rate*100, "hit%")
+			})
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package tinylfu
+
+import (
+	"encoding/binary"
+
+	"github.com/ironsmile/nedomi/types"
+)
+
+const (
+	// The number of rows in the sketch. Every object has a counter in each row
+	// and its frequency is the minimum of them.
+	sketchDepth = 4
+
+	// The maximum value of a counter. Counters are 4 bits.
+	sketchMaxCount = 15
+
+	// How many counters per cached object there are in a row
+	sketchCountersPerObject = 4
+
+	// After how many increments per cached object the counters are halved so
+	// that the old popularity fades away.
+	sketchSamplesPerObject = 10
+)
+
+// sketch is a count-min sketch which estimates how often the objects were
+// requested recently. The first request for every object is only recorded in
+// a bloom filter (the doorkeeper) so that the objects requested once do not
+// fill up the counters.
+type sketch struct {
+	rows       [sketchDepth][]uint8 // two counters in every byte
+	doorkeeper []uint64
+	mask       uint64
+	additions  uint64
+	resetAt    uint64
+}
+
+// newSketch returns a sketch for a cache with the given number of objects.
+func newSketch(objects uint64) *sketch {
+	var width uint64 = 64
+	for width < objects*sketchCountersPerObject {
+		width <<= 1
+	}
+
+	var s = &sketch{
+		mask:    width - 1,
+		resetAt: objects * sketchSamplesPerObject,
+	}
+	if s.resetAt < width {
+		s.resetAt = width
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width/2)
+	}
+	// One bit per counter in a row for every of the sketchDepth hashes
+	s.doorkeeper = make([]uint64, width*sketchDepth/64)
+	return s
+}
+
+// resize returns a sketch for a cache with the given number of objects with
+// the counters of s. The counters which fall in the same place in a narrower
+// sketch are merged by taking the biggest of them, so the estimates can only
+// grow like with any other collision.
+func (s *sketch) resize(objects uint64) *sketch {
+	var (
+		result   = newSketch(objects)
+		oldWidth = s.mask + 1
+		width    = result.mask + 1
+	)
+	for index := uint64(0); index < oldWidth || index < width; index++ {
+		var from, to = index & s.mask, index & result.mask
+		for row := range s.rows {
+			if counter := s.counter(row, from); counter > result.counter(row, to) {
+				result.setCounter(row, to, counter)
+			}
+			if s.hasBit(from*sketchDepth + uint64(row)) {
+				result.setBit(to*sketchDepth + uint64(row))
+			}
+		}
+	}
+	result.additions = s.additions
+	if result.additions >= result.resetAt {
+		result.reset()
+	}
+	return result
+}
+
+// indexes returns where the counters for the hash are in every row.
+func (s *sketch) indexes(h types.ObjectIndexHash) (result [sketchDepth]uint64) {
+	// The object hash is a sha1 so parts of it are good enough as hashes
+	var (
+		h1 = binary.BigEndian.Uint64(h[0:8])
+		h2 = binary.BigEndian.Uint64(h[8:16]) ^ uint64(binary.BigEndian.Uint32(h[types.ObjectIDHashSize:]))
+	)
+	for i := range result {
+		result[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return result
+}
+
+// doorkeeperBits returns the positions of the bits for the hash in the
+// doorkeeper.
+func (s *sketch) doorkeeperBits(h types.ObjectIndexHash) (result [sketchDepth]uint64) {
+	for i, index := range s.indexes(h) {
+		result[i] = index*sketchDepth + uint64(i)
+	}
+	return result
+}
+
+// inDoorkeeper returns whether the hash is in the doorkeeper and adds it if it
+// is not.
+func (s *sketch) inDoorkeeper(h types.ObjectIndexHash, add bool) bool {
+	var found = true
+	for _, bit := range s.doorkeeperBits(h) {
+		if !s.hasBit(bit) {
+			found = false
+			if add {
+				s.setBit(bit)
+			}
+		}
+	}
+	return found
+}
+
+func (s *sketch) hasBit(bit uint64) bool {
+	return s.doorkeeper[bit/64]&(1<<(bit%64)) != 0
+}
+
+func (s *sketch) setBit(bit uint64) {
+	s.doorkeeper[bit/64] |= 1 << (bit % 64)
+}
+
+// increment records a request for the hash.
+func (s *sketch) increment(h types.ObjectIndexHash) {
+	if s.inDoorkeeper(h, true) {
+		for i, index := range s.indexes(h) {
+			if s.counter(i, index) < sketchMaxCount {
+				s.rows[i][index/2] += 1 << (4 * (index % 2))
+			}
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *sketch) counter(row int, index uint64) uint8 {
+	return (s.rows[row][index/2] >> (4 * (index % 2))) & 0x0f
+}
+
+func (s *sketch) setCounter(row int, index uint64, counter uint8) {
+	var shift = 4 * (index % 2)
+	s.rows[row][index/2] = s.rows[row][index/2]&^(0x0f<<shift) | counter<<shift
+}
+
+// estimate returns the estimated number of recent requests for the hash.
+func (s *sketch) estimate(h types.ObjectIndexHash) uint8 {
+	var result uint8 = sketchMaxCount
+	for i, index := range s.indexes(h) {
+		if counter := s.counter(i, index); counter < result {
+			result = counter
+		}
+	}
+	if result < sketchMaxCount && s.inDoorkeeper(h, false) {
+		result++
+	}
+	return result
+}
+
+// reset halves all of the counters and clears the doorkeeper.
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			// Both of the counters in the byte are halved
+			s.rows[i][j] = (s.rows[i][j] >> 1) & 0x77
+		}
+	}
+	for i := range s.doorkeeper {
+		s.doorkeeper[i] = 0
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,318 @@
+// Package tinylfu contains a W-TinyLFU cache eviction implementation.
+//
+// New objects enter a small LRU window. Objects evicted from the window are
+// admitted in the main segmented LRU only if they were requested more often
+// than the object which would be evicted from it in their place. The request
+// frequencies are estimated with a count-min sketch which is periodically
+// halved so that it follows the changes in the popularity.
+package tinylfu
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/cacheutils"
+)
+
+const (
+	window    = iota // recently added objects
+	probation        // objects in the main cache which were not used there yet
+	protected        // objects in the main cache which were used there
+)
+
+const (
+	// Percent of the cache for the window
+	windowPercent = 1
+	// Percent of the main cache for the protected segment
+	protectedPercent = 80
+)
+
+// entry is stored in the cache lookup hashmap
+type entry struct {
+	elem    *list.Element
+	segment int
+	size    types.BytesSize
+}
+
+// WTinyLFUCache implements the W-TinyLFU cache algorithm.
+type WTinyLFUCache struct {
+	types.SyncLogger
+
+	cfg *config.CacheZone
+
+	segments [3]*list.List
+	lookup   map[types.ObjectIndexHash]*entry
+	sketch   *sketch
+	mutex    sync.Mutex
+
+	windowSize    int
+	protectedSize int
+	mainSize      int
+
+	// The size in bytes of all objects in the cache
+	size types.BytesSize
+
+	removeFunc func(*types.ObjectIndex) error
+	admission  *cacheutils.AdmissionFilter
+
+	// Used to track cache hit/miss information
+	requests uint64
+	hits     uint64
+}
+
+// Lookup implements part of types.CacheAlgorithm interface. Every lookup is
+// counted in the frequency sketch.
+func (tc *WTinyLFUCache) Lookup(oi *types.ObjectIndex) bool {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	tc.requests++
+	var h = oi.Hash()
+	tc.sketch.increment(h)
+
+	if _, ok := tc.lookup[h]; ok {
+		tc.hits++
+		return true
+	}
+	return false
+}
+
+// ShouldKeep implements part of types.CacheAlgorithm interface. Every new
+// object which passes the admission filter is kept in the window at first.
+func (tc *WTinyLFUCache) ShouldKeep(oi *types.ObjectIndex) bool {
+	return tc.admission.Admit(oi)
+}
+
+// AddObject implements part of types.CacheAlgorithm interface
+func (tc *WTinyLFUCache) AddObject(oi *types.ObjectIndex, size types.BytesSize) error {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	return tc.addObject(oi, size)
+}
+
+func (tc *WTinyLFUCache) addObject(oi *types.ObjectIndex, size types.BytesSize) error {
+	if e, ok := tc.lookup[oi.Hash()]; ok {
+		// the part may have been saved again with a different size
+		tc.size -= e.size
+		e.size = size
+		tc.size += e.size
+		return types.ErrAlreadyInCache
+	}
+
+	tc.GetLogger().Debugf("Storing %s in tinylfu", oi)
+	tc.lookup[oi.Hash()] = &entry{
+		segment: window,
+		elem:    tc.segments[window].PushFront(*oi),
+		size:    size,
+	}
+	tc.size += size
+
+	for tc.segments[window].Len() > tc.windowSize {
+		tc.admitFromWindow()
+	}
+	return nil
+}
+
+// admitFromWindow moves the last object of the window to the main cache if
+// there is space for it or it is more popular than the main cache victim.
+// Otherwise it is evicted.
+func (tc *WTinyLFUCache) admitFromWindow() {
+	var candidate = tc.segments[window].Back()
+	var candidateOi = candidate.Value.(types.ObjectIndex)
+	var candidateEntry = tc.lookup[candidateOi.Hash()]
+
+	if tc.segments[probation].Len()+tc.segments[protected].Len() >= tc.mainSize {
+		var victimSegment = probation
+		if tc.segments[probation].Len() == 0 {
+			victimSegment = protected
+		}
+		var victim = tc.segments[victimSegment].Back()
+		if victim == nil {
+			tc.evict(window, candidate)
+			return
+		}
+		var victimOi = victim.Value.(types.ObjectIndex)
+		if tc.sketch.estimate(candidateOi.Hash()) <= tc.sketch.estimate(victimOi.Hash()) {
+			tc.evict(window, candidate)
+			return
+		}
+		tc.evict(victimSegment, victim)
+	}
+
+	tc.segments[window].Remove(candidate)
+	candidateEntry.segment = probation
+	candidateEntry.elem = tc.segments[probation].PushFront(candidateOi)
+}
+
+func (tc *WTinyLFUCache) evict(segment int, elem *list.Element) {
+	var oi = tc.segments[segment].Remove(elem).(types.ObjectIndex)
+	tc.forget(&oi)
+	if err := tc.removeFunc(&oi); err != nil {
+		tc.GetLogger().Logf("error while removing %s from cache - %s", &oi, err)
+	}
+}
+
+// Remove the objects given from the cache.
+func (tc *WTinyLFUCache) Remove(ois ...*types.ObjectIndex) {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	for _, oi := range ois {
+		if e, ok := tc.lookup[oi.Hash()]; ok {
+			tc.forget(oi)
+			tc.segments[e.segment].Remove(e.elem)
+		}
+	}
+}
+
+// forget removes the object from the lookup map.
+func (tc *WTinyLFUCache) forget(oi *types.ObjectIndex) {
+	if e, ok := tc.lookup[oi.Hash()]; ok {
+		tc.size -= e.size
+		delete(tc.lookup, oi.Hash())
+	}
+}
+
+// PromoteObject implements part of types.CacheAlgorithm interface. Objects
+// used in the probation segment are moved to the protected one.
+func (tc *WTinyLFUCache) PromoteObject(oi *types.ObjectIndex) {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	e, ok := tc.lookup[oi.Hash()]
+	if !ok {
+		// This object is not in the cache yet. So we add it. Its size is
+		// not known so it is considered a full part.
+		if err := tc.addObject(oi, tc.cfg.PartSize); err != nil {
+			tc.GetLogger().Errorf("Adding object in cache failed. Object: %v\n%s", oi, err)
+		}
+		return
+	}
+
+	if e.segment != probation {
+		tc.segments[e.segment].MoveToFront(e.elem)
+		return
+	}
+
+	tc.segments[probation].Remove(e.elem)
+	e.segment = protected
+	e.elem = tc.segments[protected].PushFront(*oi)
+
+	for tc.segments[protected].Len() > tc.protectedSize {
+		// The least recently used protected object gets another chance in
+		// the probation segment
+		demoted := tc.segments[protected].Remove(tc.segments[protected].Back()).(types.ObjectIndex)
+		demotedEntry := tc.lookup[demoted.Hash()]
+		demotedEntry.segment = probation
+		demotedEntry.elem = tc.segments[probation].PushFront(demoted)
+	}
+}
+
+// ConsumedSize implements part of types.CacheAlgorithm interface
+func (tc *WTinyLFUCache) ConsumedSize() types.BytesSize {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	return tc.size
+}
+
+// Stats implements part of types.CacheAlgorithm interface
+func (tc *WTinyLFUCache) Stats() types.CacheStats {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	return cacheutils.NewStats(tc.cfg.Path, tc.hits, tc.requests, uint64(len(tc.lookup)),
+		tc.size, tc.admission)
+}
+
+// ChangeConfig changes the WTinyLFUCache config and start using it
+func (tc *WTinyLFUCache) ChangeConfig(bulkRemoveTimout, bulkRemoveCount, newsize uint64) {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	var oldsize = tc.cfg.StorageObjects
+	tc.cfg.StorageObjects = newsize
+	tc.cfg.BulkRemoveCount = bulkRemoveCount
+	tc.cfg.BulkRemoveTimeout = bulkRemoveTimout
+	if oldsize == newsize {
+		return
+	}
+
+	tc.setSizes()
+	tc.sketch = tc.sketch.resize(newsize)
+
+	// The least valuable objects are removed first
+	var removed []types.ObjectIndex
+	for _, segment := range []int{window, probation, protected} {
+		var l = tc.segments[segment]
+		for len(tc.lookup) > tc.windowSize+tc.mainSize && l.Len() > 0 {
+			oi := l.Remove(l.Back()).(types.ObjectIndex)
+			tc.forget(&oi)
+			removed = append(removed, oi)
+		}
+	}
+	for tc.segments[protected].Len() > tc.protectedSize {
+		demoted := tc.segments[protected].Remove(tc.segments[protected].Back()).(types.ObjectIndex)
+		demotedEntry := tc.lookup[demoted.Hash()]
+		demotedEntry.segment = probation
+		demotedEntry.elem = tc.segments[probation].PushFront(demoted)
+	}
+
+	if len(removed) > 0 {
+		go cacheutils.RemoveInBatches(removed, bulkRemoveCount, bulkRemoveTimout,
+			tc.removeIfMissing)
+	}
+}
+
+// removeIfMissing removes the objects from the storage, but only if they are
+// not in the cache at the time of removal
+func (tc *WTinyLFUCache) removeIfMissing(ois ...types.ObjectIndex) {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	for i := range ois {
+		if _, ok := tc.lookup[ois[i].Hash()]; !ok {
+			if err := tc.removeFunc(&ois[i]); err != nil {
+				tc.GetLogger().Logf("error while removing %s from cache - %s", &ois[i], err)
+			}
+		}
+	}
+}
+
+func (tc *WTinyLFUCache) setSizes() {
+	var size = int(tc.cfg.StorageObjects)
+	tc.windowSize = size * windowPercent / 100
+	if tc.windowSize < 1 {
+		tc.windowSize = 1
+	}
+	tc.mainSize = size - tc.windowSize
+	if tc.mainSize < 0 {
+		tc.mainSize = 0
+	}
+	tc.protectedSize = tc.mainSize * protectedPercent / 100
+}
+
+func (tc *WTinyLFUCache) init() {
+	for i := range tc.segments {
+		tc.segments[i] = list.New()
+	}
+	tc.lookup = make(map[types.ObjectIndexHash]*entry)
+	tc.sketch = newSketch(tc.cfg.StorageObjects)
+	tc.admission = cacheutils.NewAdmissionFilter(tc.cfg)
+	tc.setSizes()
+}
+
+// New returns WTinyLFUCache object ready for use.
+func New(cz *config.CacheZone, removeFunc func(*types.ObjectIndex) error,
+	logger types.Logger) *WTinyLFUCache {
+
+	tc := &WTinyLFUCache{
+		cfg:        cz,
+		removeFunc: removeFunc,
+	}
+	tc.SetLogger(logger)
+	tc.init()
+	return tc
+}
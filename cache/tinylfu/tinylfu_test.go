@@ -0,0 +1,216 @@
+package tinylfu
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/mock"
+	"github.com/ironsmile/nedomi/types"
+)
+
+func getCacheZone(objects uint64) *config.CacheZone {
+	return &config.CacheZone{
+		ID:             "default",
+		Path:           "/some/path",
+		StorageObjects: objects,
+		PartSize:       10,
+		Algorithm:      "tinylfu",
+	}
+}
+
+func mockRemove(*types.ObjectIndex) error {
+	return nil
+}
+
+func objectIndexes(prefix string, count int) []*types.ObjectIndex {
+	var result = make([]*types.ObjectIndex, count)
+	for i := range result {
+		result[i] = &types.ObjectIndex{ObjID: types.NewObjectID("1.1", prefix+strconv.Itoa(i))}
+	}
+	return result
+}
+
+// access uses the cache algorithm the way the cache handler does
+func access(tc *WTinyLFUCache, idx *types.ObjectIndex) {
+	if tc.Lookup(idx) {
+		tc.PromoteObject(idx)
+	} else if tc.ShouldKeep(idx) {
+		tc.AddObject(idx, tc.cfg.PartSize)
+	}
+}
+
+func checkSizes(t *testing.T, tc *WTinyLFUCache) {
+	if tc.segments[window].Len() > tc.windowSize {
+		t.Errorf("The window has %d objects, more than %d", tc.segments[window].Len(), tc.windowSize)
+	}
+	if tc.segments[protected].Len() > tc.protectedSize {
+		t.Errorf("The protected segment has %d objects, more than %d",
+			tc.segments[protected].Len(), tc.protectedSize)
+	}
+	var all = tc.segments[window].Len() + tc.segments[probation].Len() + tc.segments[protected].Len()
+	if all != len(tc.lookup) {
+		t.Errorf("The segments have %d objects but the lookup map has %d", all, len(tc.lookup))
+	}
+	if uint64(all) > tc.cfg.StorageObjects {
+		t.Errorf("The cache has %d objects, more than %d", all, tc.cfg.StorageObjects)
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	t.Parallel()
+	tc := New(getCacheZone(100), mockRemove, mock.NewLogger())
+
+	var hot = objectIndexes("/hot/", 50)
+	for round := 0; round < 5; round++ {
+		for _, idx := range hot {
+			access(tc, idx)
+		}
+	}
+	for _, idx := range objectIndexes("/scan/", 1000) {
+		access(tc, idx)
+	}
+	checkSizes(t, tc)
+
+	for _, idx := range hot {
+		if _, ok := tc.lookup[idx.Hash()]; !ok {
+			t.Errorf("The popular object %s was evicted by the scan", idx)
+		}
+	}
+}
+
+func TestLookupAddAndRemove(t *testing.T) {
+	t.Parallel()
+	var removed = make(map[types.ObjectIndexHash]bool)
+	tc := New(getCacheZone(10), func(oi *types.ObjectIndex) error {
+		removed[oi.Hash()] = true
+		return nil
+	}, mock.NewLogger())
+
+	var indexes = objectIndexes("/obj/", 20)
+	if tc.Lookup(indexes[0]) {
+		t.Error("Empty cache should not contain anything")
+	}
+	if err := tc.AddObject(indexes[0], tc.cfg.PartSize); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if err := tc.AddObject(indexes[0], 5); err != types.ErrAlreadyInCache {
+		t.Errorf("Expected ErrAlreadyInCache but got %v", err)
+	}
+	if tc.ConsumedSize() != 5 {
+		t.Errorf("Expected the size to be updated to 5 but it is %d", tc.ConsumedSize())
+	}
+	if !tc.Lookup(indexes[0]) {
+		t.Error("The added object should be in the cache")
+	}
+
+	tc.Remove(indexes[0])
+	if tc.Lookup(indexes[0]) {
+		t.Error("The removed object should not be in the cache")
+	}
+
+	for _, idx := range indexes {
+		access(tc, idx)
+		checkSizes(t, tc)
+	}
+	if len(tc.lookup)+len(removed) != len(indexes) {
+		t.Errorf("Expected every object to be either cached or removed, got %d cached and %d removed",
+			len(tc.lookup), len(removed))
+	}
+	for h := range removed {
+		if _, ok := tc.lookup[h]; ok {
+			t.Error("Removed object is still in the cache")
+		}
+	}
+
+	stats := tc.Stats()
+	if stats.Objects() != uint64(len(tc.lookup)) || stats.Size() != tc.ConsumedSize() {
+		t.Errorf("Wrong stats %+v", stats)
+	}
+	if stats.Requests() != 23 || stats.Hits() != 1 {
+		t.Errorf("Expected 23 requests and 1 hit but got %d and %d", stats.Requests(), stats.Hits())
+	}
+}
+
+func TestResize(t *testing.T) {
+	t.Parallel()
+	var removed = make(chan *types.ObjectIndex, 100)
+	tc := New(getCacheZone(100), func(oi *types.ObjectIndex) error {
+		removed <- oi
+		return nil
+	}, mock.NewLogger())
+
+	var indexes = objectIndexes("/obj/", 100)
+	for _, idx := range indexes {
+		access(tc, idx)
+		access(tc, idx)
+	}
+	var popular = tc.sketch.estimate(indexes[0].Hash())
+	tc.ChangeConfig(1, 10, 100)
+	if tc.sketch.estimate(indexes[0].Hash()) != popular {
+		t.Error("Expected the frequencies to be kept when the size does not change")
+	}
+	tc.ChangeConfig(1, 10, 50)
+	checkSizes(t, tc)
+	if len(tc.lookup) != 50 {
+		t.Errorf("Expected 50 objects after the resize but got %d", len(tc.lookup))
+	}
+
+	for i := 0; i < 50; i++ {
+		select {
+		case <-removed:
+		case <-time.After(time.Second):
+			t.Fatalf("Only %d objects were removed after the resize", i)
+		}
+	}
+}
+
+func TestSketch(t *testing.T) {
+	t.Parallel()
+	var (
+		s       = newSketch(100)
+		popular = objectIndexes("/popular/", 1)[0].Hash()
+		rare    = objectIndexes("/rare/", 1)[0].Hash()
+	)
+	for i := 0; i < 20; i++ {
+		s.increment(popular)
+	}
+	s.increment(rare)
+	if s.estimate(popular) != sketchMaxCount {
+		t.Errorf("Expected the popular estimate to be capped at %d but got %d",
+			sketchMaxCount, s.estimate(popular))
+	}
+	if s.estimate(rare) == 0 || s.estimate(rare) >= s.estimate(popular) {
+		t.Errorf("Wrong estimate for the rare object %d", s.estimate(rare))
+	}
+
+	s.reset()
+	if s.estimate(popular) != sketchMaxCount/2 {
+		t.Errorf("Expected the estimate to be halved but it is %d", s.estimate(popular))
+	}
+}
+
+func TestSketchResize(t *testing.T) {
+	t.Parallel()
+	var (
+		s       = newSketch(100)
+		popular = objectIndexes("/popular/", 1)[0].Hash()
+		rare    = objectIndexes("/rare/", 1)[0].Hash()
+	)
+	for i := 0; i < 10; i++ {
+		s.increment(popular)
+	}
+	var expected = s.estimate(popular)
+	for _, objects := range []uint64{1000, 10} {
+		resized := s.resize(objects)
+		if resized.estimate(popular) != expected {
+			t.Errorf("Expected the estimate to be %d after resizing to %d objects but got %d",
+				expected, objects, resized.estimate(popular))
+		}
+		if resized.estimate(rare) >= expected {
+			t.Errorf("Expected a lower estimate for the rare object after resizing to %d objects but got %d",
+				objects, resized.estimate(rare))
+		}
+	}
+}
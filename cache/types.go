@@ -8,15 +8,29 @@ import (
 	"github.com/ironsmile/nedomi/config"
 	"github.com/ironsmile/nedomi/types"
 
+	"github.com/ironsmile/nedomi/cache/arc"
+
 	"github.com/ironsmile/nedomi/cache/lru"
+
+	"github.com/ironsmile/nedomi/cache/tinylfu"
 )
 
 type newCacheFunc func(*config.CacheZone, func(*types.ObjectIndex) error, types.Logger) types.CacheAlgorithm
 
 var cacheTypes = map[string]newCacheFunc{
 
+	"arc": func(cz *config.CacheZone, remove func(*types.ObjectIndex) error,
+		logger types.Logger) types.CacheAlgorithm {
+		return arc.New(cz, remove, logger)
+	},
+
 	"lru": func(cz *config.CacheZone, remove func(*types.ObjectIndex) error,
 		logger types.Logger) types.CacheAlgorithm {
 		return lru.New(cz, remove, logger)
 	},
+
+	"tinylfu": func(cz *config.CacheZone, remove func(*types.ObjectIndex) error,
+		logger types.Logger) types.CacheAlgorithm {
+		return tinylfu.New(cz, remove, logger)
+	},
 }
@@ -0,0 +1,34 @@
+package config
+
+import "github.com/ironsmile/nedomi/types"
+
+// AccessLogSettings contains the options for an access log. They are set in
+// the http section and can be overridden by every virtual host.
+type AccessLogSettings struct {
+	AccessLog string `json:"access_log"`
+	AccessLogFormat
+	AccessLogRotation  LogRotation  `json:"access_log_rotation"`
+	AccessLogBuffering LogBuffering `json:"access_log_buffering"`
+	// AccessLogSampleHits makes only 1 of every that many successful cache
+	// hits logged. Zero and one log all of them.
+	AccessLogSampleHits uint64 `json:"access_log_sample_hits"`
+}
+
+// Copy returns a deep copy of the AccessLogSettings
+func (a AccessLogSettings) Copy() AccessLogSettings {
+	a.AccessLogFormat = a.AccessLogFormat.Copy()
+	return a
+}
+
+// LogBuffering contains the options for writing a log file asynchronously
+// through a buffer. Buffering is disabled when Size is zero.
+type LogBuffering struct {
+	// Size is the size of the buffer
+	Size types.BytesSize `json:"size"`
+	// FlushInterval is the longest time in milliseconds for which lines stay
+	// in the buffer
+	FlushInterval uint32 `json:"flush_interval"`
+	// QueueSize is how many lines can wait to be written in the buffer before
+	// new ones are dropped
+	QueueSize int `json:"queue_size"`
+}
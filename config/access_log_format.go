@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/ironsmile/nedomi/utils"
+)
+
+// The supported access log formats.
+const (
+	AccessLogFormatCommon   = "common"
+	AccessLogFormatJSON     = "json"
+	AccessLogFormatLogfmt   = "logfmt"
+	AccessLogFormatTemplate = "template"
+)
+
+// AccessLogFormat contains the options for the format of the access log lines.
+type AccessLogFormat struct {
+	Format   string      `json:"access_log_format"`
+	Fields   StringSlice `json:"access_log_fields"`
+	Template string      `json:"access_log_template"`
+}
+
+// Copy returns a deep copy of the AccessLogFormat
+func (a AccessLogFormat) Copy() AccessLogFormat {
+	a.Fields = utils.CopyStringSlice(a.Fields)
+	return a
+}
+
+// Validate checks the access log format for logical errors.
+func (a AccessLogFormat) Validate() error {
+	switch a.Format {
+	case "", AccessLogFormatCommon, AccessLogFormatJSON, AccessLogFormatLogfmt:
+	case AccessLogFormatTemplate:
+		if a.Template == "" {
+			return fmt.Errorf("the %s access log format needs an access_log_template",
+				AccessLogFormatTemplate)
+		}
+	default:
+		return fmt.Errorf("unknown access log format `%s`", a.Format)
+	}
+	return nil
+}
@@ -118,6 +118,9 @@ func TestConfigVerification(t *testing.T) {
 		"No error with wrong cache default duration in vhost": func(cfg *Config) {
 			cfg.HTTP.Servers[0].CacheDefaultDuration = -1 * time.Hour
 		},
+		"No error with admission filter without window": func(cfg *Config) {
+			cfg.CacheZones["test1"].AdmissionMinRequests = 2
+		},
 	}
 
 	for errorStr, fnc := range tests {
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ironsmile/nedomi/utils/netutils"
+)
+
+// Listener contains the options for one of the addresses on which nedomi
+// accepts connections.
+type Listener struct {
+	Address string `json:"address"`
+	// TLS makes the listener accept only TLS connections with the
+	// certificates from the `http.tls` settings
+	TLS bool `json:"tls"`
+	// ReadTimeout and WriteTimeout are in seconds. The `http` ones are used
+	// when they are 0.
+	ReadTimeout  uint32 `json:"read_timeout"`
+	WriteTimeout uint32 `json:"write_timeout"`
+	// HTTP2 enables HTTP/2 for the clients which support it - negotiated
+	// with ALPN for TLS listeners and with prior knowledge (h2c) for the
+	// others
+	HTTP2 bool `json:"http2"`
+	// ProxyProtocol makes the listener read a PROXY protocol v1 or v2 header
+	// from the connections from ProxyProtocolTrusted, or from all
+	// connections if it is empty. The client address is taken from it.
+	ProxyProtocol        bool     `json:"proxy_protocol"`
+	ProxyProtocolTrusted []string `json:"proxy_protocol_trusted"`
+	// VirtualHosts are the names of the only virtual hosts served on the
+	// listener. All of them are served when it is empty.
+	VirtualHosts []string `json:"virtual_hosts"`
+}
+
+// SameSocket returns whether the listener can keep using the socket of other.
+// This is true when only the virtual hosts are different.
+func (l *Listener) SameSocket(other *Listener) bool {
+	return l.Address == other.Address && l.TLS == other.TLS &&
+		l.ReadTimeout == other.ReadTimeout && l.WriteTimeout == other.WriteTimeout &&
+		l.HTTP2 == other.HTTP2 && l.ProxyProtocol == other.ProxyProtocol &&
+		strings.Join(l.ProxyProtocolTrusted, ",") == strings.Join(other.ProxyProtocolTrusted, ",")
+}
+
+// Serves returns whether the virtual host with the name is served on the
+// listener.
+func (l *Listener) Serves(vhost string) bool {
+	if len(l.VirtualHosts) == 0 {
+		return true
+	}
+	for _, name := range l.VirtualHosts {
+		if name == vhost {
+			return true
+		}
+	}
+	return false
+}
+
+// GetListeners returns all listeners - the ones from `http.listen` and
+// `http.tls.listen` and the ones in `http.listeners` with the default
+// timeouts set.
+func (h *HTTP) GetListeners() []Listener {
+	var listeners []Listener
+	if h.Listen != "" {
+		listeners = append(listeners, Listener{Address: h.Listen})
+	}
+	if h.TLS.Listen != "" {
+		listeners = append(listeners, Listener{Address: h.TLS.Listen, TLS: true})
+	}
+	listeners = append(listeners, h.Listeners...)
+	for i := range listeners {
+		if listeners[i].ReadTimeout == 0 {
+			listeners[i].ReadTimeout = h.ReadTimeout
+		}
+		if listeners[i].WriteTimeout == 0 {
+			listeners[i].WriteTimeout = h.WriteTimeout
+		}
+	}
+	return listeners
+}
+
+// HasTLSListeners returns whether any of the listeners accepts TLS
+// connections.
+func (h *HTTP) HasTLSListeners() bool {
+	for _, l := range h.GetListeners() {
+		if l.TLS {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *HTTP) validateListeners() error {
+	var listeners = h.GetListeners()
+	if len(listeners) == 0 {
+		return fmt.Errorf("Empty `http.listen` directive and no `http.listeners`")
+	}
+
+	var (
+		addresses = make(map[string]struct{})
+		vhosts    = make(map[string]struct{})
+	)
+	for _, vhost := range h.Servers {
+		vhosts[vhost.Name] = struct{}{}
+	}
+	for _, l := range listeners {
+		if _, err := net.ResolveTCPAddr("tcp", l.Address); err != nil {
+			return fmt.Errorf("Invalid listener address `%s`: %s", l.Address, err)
+		}
+		if _, ok := addresses[l.Address]; ok {
+			return fmt.Errorf("More than one listener on `%s`", l.Address)
+		}
+		addresses[l.Address] = struct{}{}
+		if _, err := netutils.ParseIPNets(l.ProxyProtocolTrusted); err != nil {
+			return fmt.Errorf("Invalid proxy_protocol_trusted for the listener on `%s`: %s",
+				l.Address, err)
+		}
+		for _, name := range l.VirtualHosts {
+			if _, ok := vhosts[name]; !ok {
+				return fmt.Errorf("Unknown virtual host %s for the listener on `%s`",
+					name, l.Address)
+			}
+		}
+	}
+	return nil
+}
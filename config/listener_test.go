@@ -0,0 +1,30 @@
+package config
+
+import "testing"
+
+func TestGetListeners(t *testing.T) {
+	t.Parallel()
+	var cfg = new(HTTP)
+	cfg.Listen = ":80"
+	cfg.ReadTimeout = 5
+	cfg.WriteTimeout = 6
+	cfg.TLS.Listen = ":443"
+	cfg.Listeners = []Listener{{Address: "10.0.0.1:8080", ReadTimeout: 1}}
+	var expected = []Listener{
+		{Address: ":80", ReadTimeout: 5, WriteTimeout: 6},
+		{Address: ":443", TLS: true, ReadTimeout: 5, WriteTimeout: 6},
+		{Address: "10.0.0.1:8080", ReadTimeout: 1, WriteTimeout: 6},
+	}
+	var listeners = cfg.GetListeners()
+	if len(listeners) != len(expected) {
+		t.Fatalf("expected %d listeners got %+v", len(expected), listeners)
+	}
+	for i := range expected {
+		if !listeners[i].SameSocket(&expected[i]) {
+			t.Errorf("expected listener %+v got %+v", expected[i], listeners[i])
+		}
+	}
+	if !cfg.HasTLSListeners() {
+		t.Error("expected a TLS listener")
+	}
+}
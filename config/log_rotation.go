@@ -0,0 +1,21 @@
+package config
+
+import "github.com/ironsmile/nedomi/types"
+
+// LogRotation contains the options for the built-in rotation of log files.
+// Rotation is disabled when both MaxSize and MaxAge are zero.
+type LogRotation struct {
+	// MaxSize is the size after which the file is rotated
+	MaxSize types.BytesSize `json:"max_size"`
+	// MaxAge is the time in seconds after which the file is rotated
+	MaxAge uint32 `json:"max_age"`
+	// MaxBackups is how many rotated files are kept, zero keeps all of them
+	MaxBackups int `json:"max_backups"`
+	// Compress makes the rotated files gzipped
+	Compress bool `json:"compress"`
+}
+
+// Enabled returns whether the files should be rotated at all.
+func (r LogRotation) Enabled() bool {
+	return r.MaxSize > 0 || r.MaxAge > 0
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ironsmile/nedomi/utils/netutils"
+)
+
+// DefaultRealIPHeader is the header with the client addresses when none is
+// configured.
+const DefaultRealIPHeader = "X-Forwarded-For"
+
+// RealIP contains the options for getting the client addresses of the
+// requests from trusted proxies from a header.
+type RealIP struct {
+	// Trusted are the networks or addresses of the proxies
+	Trusted []string `json:"trusted"`
+	// Header is the header with the client addresses. It can contain a comma
+	// separated list like X-Forwarded-For.
+	Header string `json:"header"`
+	// Recursive makes the client address the last one in the header which is
+	// not trusted instead of just the last one
+	Recursive bool `json:"recursive"`
+}
+
+// GetHeader returns the canonical name of the configured header.
+func (r *RealIP) GetHeader() string {
+	if r.Header == "" {
+		return DefaultRealIPHeader
+	}
+	return http.CanonicalHeaderKey(r.Header)
+}
+
+// Validate checks the real IP config for logical errors.
+func (r *RealIP) Validate() error {
+	if _, err := netutils.ParseIPNets(r.Trusted); err != nil {
+		return fmt.Errorf("Invalid `http.real_ip.trusted`: %s", err)
+	}
+	return nil
+}
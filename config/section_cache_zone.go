@@ -2,6 +2,7 @@ package config
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/ironsmile/nedomi/types"
 )
@@ -17,6 +18,12 @@ type CacheZone struct {
 	BulkRemoveCount    uint64          `json:"bulk_remove_count"`
 	BulkRemoveTimeout  uint64          `json:"bulk_remove_timeout"`
 	SkipCacheKeyInPath bool            `json:"skip_cache_key_in_path"`
+	RestoreWorkers     uint64          `json:"restore_workers"`
+	RestoreRate        uint64          `json:"restore_rate"`
+	SnapshotInterval   uint64          `json:"snapshot_interval"`
+
+	AdmissionMinRequests uint64 `json:"admission_min_requests"`
+	AdmissionWindow      uint64 `json:"admission_window"`
 }
 
 // Validate checks a CacheZone config section for errors.
@@ -25,6 +32,11 @@ func (cz *CacheZone) Validate() error {
 	if cz.ID == "" || cz.Type == "" || cz.Path == "" || cz.Algorithm == "" || cz.PartSize == 0 {
 		return errors.New("missing or invalid information in the cache zone config section")
 	}
+	if cz.AdmissionMinRequests > 1 && cz.AdmissionWindow == 0 {
+		// without a window the counts are never cleared and every object is
+		// admitted eventually
+		return fmt.Errorf("cache zone %s has admission_min_requests without admission_window", cz.ID)
+	}
 
 	return nil
 }
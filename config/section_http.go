@@ -3,7 +3,6 @@ package config
 import (
 	"encoding/json"
 	"errors"
-	"net"
 
 	"github.com/ironsmile/nedomi/types"
 )
@@ -22,12 +21,15 @@ type BaseHTTP struct {
 	MaxIOTransferSize types.BytesSize            `json:"max_io_transfer_size"`
 	ReadTimeout       uint32                     `json:"read_timeout"`
 	WriteTimeout      uint32                     `json:"write_timeout"`
+	TLS               TLS                        `json:"tls"`
+	Listeners         []Listener                 `json:"listeners"`
+	RealIP            RealIP                     `json:"real_ip"`
 
 	// Defaults for vhosts:
 	DefaultHandlers  []Handler `json:"default_handlers"`
 	DefaultCacheZone string    `json:"default_cache_zone"`
-	AccessLog        string    `json:"access_log"`
-	Logger           Logger    `json:"logger"`
+	AccessLogSettings
+	Logger Logger `json:"logger"`
 }
 
 // HTTP contains all configuration options for HTTP.
@@ -47,7 +49,11 @@ func (h *HTTP) UnmarshalJSON(buff []byte) error {
 
 	// Parse all the upstreams
 	for key, upstreamBuff := range h.BaseHTTP.Upstreams {
-		upstream := &Upstream{ID: key, Settings: GetDefaultUpstreamSettings()}
+		upstream := &Upstream{
+			ID:          key,
+			Settings:    GetDefaultUpstreamSettings(),
+			HealthCheck: GetDefaultUpstreamHealthCheck(),
+		}
 		if err := json.Unmarshal(upstreamBuff, upstream); err != nil {
 			return err
 		}
@@ -77,19 +83,29 @@ func (h *HTTP) UnmarshalJSON(buff []byte) error {
 // Validate checks the HTTP config for logical errors.
 func (h *HTTP) Validate() error {
 
-	if h.Listen == "" {
-		return errors.New("Empty `http.listen` directive")
-	}
-
 	if len(h.Servers) == 0 {
 		return errors.New("There has to be at least one virtual host")
 	}
 
-	//!TODO: make sure Listen is valid tcp address
-	if _, err := net.ResolveTCPAddr("tcp", h.Listen); err != nil {
+	if err := h.validateListeners(); err != nil {
 		return err
 	}
 
+	if err := h.AccessLogFormat.Validate(); err != nil {
+		return err
+	}
+
+	if err := h.RealIP.Validate(); err != nil {
+		return err
+	}
+
+	if err := h.TLS.Validate(); err != nil {
+		return err
+	}
+	if h.HasTLSListeners() && (h.TLS.Certificate == "" || h.TLS.Key == "") {
+		return errors.New("`http.tls` needs a default certificate and key for the TLS listeners")
+	}
+
 	return nil
 }
 
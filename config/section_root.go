@@ -42,6 +42,9 @@ func (c *Config) UnmarshalJSON(buff []byte) error {
 			Algorithm:         c.DefaultCacheAlgorithm,
 			BulkRemoveCount:   100,
 			BulkRemoveTimeout: 100,
+			RestoreWorkers:    4,
+			SnapshotInterval:  300,
+			AdmissionWindow:   3600,
 		}
 
 		if err := json.Unmarshal(*cacheZoneBuff, &cacheZone); err != nil {
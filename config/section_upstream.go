@@ -9,19 +9,68 @@ import (
 
 // Upstream contains all configuration options for an upstream group.
 type Upstream struct {
-	ID        string
-	Balancing string            `json:"balancing"`
-	Addresses []UpstreamAddress `json:"addresses"`
-	Settings  UpstreamSettings  `json:"settings"`
+	ID          string
+	Balancing   string              `json:"balancing"`
+	Addresses   []UpstreamAddress   `json:"addresses"`
+	Settings    UpstreamSettings    `json:"settings"`
+	HealthCheck UpstreamHealthCheck `json:"health_check"`
 }
 
-// UpstreamSettings contains all possible upstream settings.
+// UpstreamSettings contains all possible upstream settings. All timeouts are
+// in seconds and zero means no timeout.
 type UpstreamSettings struct {
 	MaxConnectionsPerServer uint32 `json:"max_connections_per_server"`
 	UseIPv4                 bool   `json:"use_ipv4"`
 	UseIPv6                 bool   `json:"use_ipv6"`
 	ResolveAddresses        bool   `json:"resolve_addresses"`
-	//!TODO: add settings for timeouts, keep-alives, retries, etc.
+
+	ConnectTimeout        uint32 `json:"connect_timeout"`
+	TLSHandshakeTimeout   uint32 `json:"tls_handshake_timeout"`
+	ResponseHeaderTimeout uint32 `json:"response_header_timeout"`
+	// Timeout is for the whole request including the reading of the body.
+	Timeout uint32 `json:"timeout"`
+	// IdleTimeout is how long an idle connection is kept in the pool.
+	IdleTimeout uint32 `json:"idle_timeout"`
+	// KeepAlive is the period of the TCP keep-alive probes.
+	KeepAlive                   uint32 `json:"keep_alive"`
+	DisableKeepAlives           bool   `json:"disable_keep_alives"`
+	MaxIdleConnections          uint32 `json:"max_idle_connections"`
+	MaxIdleConnectionsPerServer uint32 `json:"max_idle_connections_per_server"`
+
+	// Retries is how many times an idempotent request is retried with
+	// another address after a connection error or a timeout.
+	Retries uint32 `json:"retries"`
+	// RetryBackoff is the milliseconds before the first retry. It is doubled
+	// for every next one.
+	RetryBackoff uint32 `json:"retry_backoff"`
+	// RetryBudget is the percent of the requests to the upstream which can
+	// be retries so that an outage does not multiply the requests to it.
+	RetryBudget uint32 `json:"retry_budget"`
+
+	// LoadFactor is how many times the average requests in progress per
+	// weight an address can have with the boundedload balancing before the
+	// requests for it go to the next addresses.
+	LoadFactor float64 `json:"load_factor"`
+}
+
+// UpstreamHealthCheck contains the settings for checking the health of the
+// upstream addresses. The unhealthy addresses are not used while there are
+// healthy ones.
+type UpstreamHealthCheck struct {
+	// MaxFails is the number of consecutive connection errors or 5xx responses
+	// after which an address is unhealthy. Zero disables the passive checks.
+	MaxFails uint32 `json:"max_fails"`
+	// FailTimeout is the seconds after which an unhealthy address is used
+	// again when there are no active checks.
+	FailTimeout uint32 `json:"fail_timeout"`
+
+	// Path is requested from every address every Interval seconds when it is
+	// set. An address is unhealthy when the probes fail MaxFails times in a
+	// row (at least once) and healthy again after Passes successful ones.
+	Path     string `json:"path"`
+	Interval uint32 `json:"interval"`
+	Timeout  uint32 `json:"timeout"`
+	Passes   uint32 `json:"passes"`
 }
 
 // UpstreamAddress contains a single upstream URL and it's weight.
@@ -39,6 +88,26 @@ func (cz *Upstream) Validate() error {
 	if len(cz.Addresses) < 1 {
 		return fmt.Errorf("upstream %s has no addresses", cz.ID)
 	}
+	if cz.Settings.Timeout != 0 && cz.Settings.ResponseHeaderTimeout > cz.Settings.Timeout {
+		return fmt.Errorf("upstream %s has response_header_timeout longer than its timeout", cz.ID)
+	}
+	if cz.Settings.LoadFactor != 0 && cz.Settings.LoadFactor < 1 {
+		return fmt.Errorf("upstream %s has load_factor lower than 1", cz.ID)
+	}
+	if cz.Settings.RetryBudget > 100 {
+		return fmt.Errorf("upstream %s has retry_budget over 100 percent", cz.ID)
+	}
+	if hc := cz.HealthCheck; hc.MaxFails > 0 && hc.Path == "" && hc.FailTimeout == 0 {
+		return fmt.Errorf("upstream %s has max_fails without fail_timeout", cz.ID)
+	}
+	if hc := cz.HealthCheck; hc.Path != "" {
+		if !strings.HasPrefix(hc.Path, "/") {
+			return fmt.Errorf("upstream %s has health check path %s not starting with /", cz.ID, hc.Path)
+		}
+		if hc.Interval == 0 || hc.Timeout == 0 || hc.Passes == 0 {
+			return fmt.Errorf("upstream %s has zero health check interval, timeout or passes", cz.ID)
+		}
+	}
 
 	return nil
 }
@@ -84,6 +153,29 @@ func GetDefaultUpstreamSettings() UpstreamSettings {
 		UseIPv4:                 true,
 		UseIPv6:                 false,
 		ResolveAddresses:        true,
-		//!TODO: add settings for timeouts, keep-alives, retries, etc.
+
+		ConnectTimeout:              10,
+		TLSHandshakeTimeout:         5,
+		IdleTimeout:                 90,
+		KeepAlive:                   10,
+		MaxIdleConnectionsPerServer: 5,
+
+		Retries:      0, // No retries by default
+		RetryBackoff: 50,
+		RetryBudget:  20,
+
+		LoadFactor: 1.25,
+	}
+}
+
+// GetDefaultUpstreamHealthCheck returns the default health check settings
+// which do not check the upstream addresses.
+func GetDefaultUpstreamHealthCheck() UpstreamHealthCheck {
+	return UpstreamHealthCheck{
+		MaxFails:    0, // No passive checks by default
+		FailTimeout: 10,
+		Interval:    10,
+		Timeout:     5,
+		Passes:      1,
 	}
 }
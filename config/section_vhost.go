@@ -15,7 +15,11 @@ const DefaultCacheDuration time.Duration = time.Hour
 type baseVirtualHost struct {
 	Locations map[string]json.RawMessage `json:"locations"`
 	Aliases   []string                   `json:"aliases"`
-	AccessLog string                     `json:"access_log"`
+	AccessLogSettings
+	// The certificate for the TLS connections to the virtual host and its
+	// aliases
+	TLSCertificate string `json:"tls_certificate"`
+	TLSKey         string `json:"tls_key"`
 }
 
 // VirtualHost contains all configuration options for virtual hosts. It
@@ -89,6 +93,14 @@ func (vh *VirtualHost) Validate() error {
 		return fmt.Errorf("Cache default duration in %s must be positive", vh)
 	}
 
+	if err := vh.AccessLogFormat.Validate(); err != nil {
+		return fmt.Errorf("Invalid access log format in %s: %s", vh, err)
+	}
+
+	if (vh.TLSCertificate == "") != (vh.TLSKey == "") {
+		return fmt.Errorf("Both tls_certificate and tls_key should be set in %s", vh)
+	}
+
 	return nil
 }
 
@@ -113,7 +125,7 @@ func newVHostFromHTTP(h *HTTP) VirtualHost {
 	return VirtualHost{
 		parent: h,
 		baseVirtualHost: baseVirtualHost{
-			AccessLog: h.AccessLog,
+			AccessLogSettings: h.AccessLogSettings.Copy(),
 		},
 		Location: Location{
 			baseLocation: baseLocation{
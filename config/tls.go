@@ -0,0 +1,86 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLS contains the options for terminating TLS connections. They are used by
+// all listeners with TLS.
+type TLS struct {
+	// Listen is an address on which TLS connections are accepted. It is
+	// a shorthand for a TLS listener in `http.listeners`.
+	Listen string `json:"listen"`
+	// Certificate and Key are the files of the default certificate which is
+	// used for the host names without a certificate of their own
+	Certificate string `json:"certificate"`
+	Key         string `json:"key"`
+	// MinVersion and MaxVersion are versions like "1.2"
+	MinVersion string `json:"min_version"`
+	MaxVersion string `json:"max_version"`
+	// CipherSuites are the names of the allowed cipher suites as in the
+	// crypto/tls package. They do not apply to TLS 1.3.
+	CipherSuites []string `json:"cipher_suites"`
+}
+
+// Validate checks the TLS config for logical errors.
+func (t *TLS) Validate() error {
+	if (t.Certificate == "") != (t.Key == "") {
+		return errors.New("Both `http.tls.certificate` and `http.tls.key` should be set")
+	}
+	minVersion, err := ParseTLSVersion(t.MinVersion)
+	if err != nil {
+		return err
+	}
+	maxVersion, err := ParseTLSVersion(t.MaxVersion)
+	if err != nil {
+		return err
+	}
+	if minVersion != 0 && maxVersion != 0 && minVersion > maxVersion {
+		return fmt.Errorf("the TLS min_version %s is higher than the max_version %s",
+			t.MinVersion, t.MaxVersion)
+	}
+	_, err = ParseCipherSuites(t.CipherSuites)
+	return err
+}
+
+// ParseTLSVersion returns the crypto/tls constant for a version like "1.2".
+// The empty version is 0 which means the default.
+func ParseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	if v, ok := tlsVersions[version]; ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version `%s`", version)
+}
+
+// ParseCipherSuites returns the IDs of the named cipher suites. No names
+// means the default suites which is nil.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	var known = make(map[string]uint16)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[suite.Name] = suite.ID
+	}
+	var ids = make([]uint16, len(names))
+	for i, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS cipher suite `%s`", name)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
@@ -0,0 +1,25 @@
+package contexts
+
+import (
+	"context"
+
+	"github.com/ironsmile/nedomi/types"
+)
+
+// The key type is unexported to prevent collisions with context keys defined in
+// other packages.
+type accessInfoContextKey int
+
+const aiKey accessInfoContextKey = 0
+
+// NewAccessInfoContext returns a new Context carrying the supplied AccessInfo
+// which the handlers fill in while serving the request.
+func NewAccessInfoContext(ctx context.Context, info *types.AccessInfo) context.Context {
+	return context.WithValue(ctx, aiKey, info)
+}
+
+// GetAccessInfo extracts the types.AccessInfo object, if present.
+func GetAccessInfo(ctx context.Context) (*types.AccessInfo, bool) {
+	info, ok := ctx.Value(aiKey).(*types.AccessInfo)
+	return info, ok
+}
@@ -0,0 +1,25 @@
+package contexts
+
+import (
+	"context"
+
+	"github.com/ironsmile/nedomi/types"
+)
+
+// The key type is unexported to prevent collisions with context keys defined in
+// other packages.
+type loggerContextKey int
+
+const loggerKey loggerContextKey = 0
+
+// NewLoggerContext returns a new Context carrying the supplied logger for the
+// request.
+func NewLoggerContext(ctx context.Context, l types.StructuredLogger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// GetLogger extracts the types.StructuredLogger for the request, if present.
+func GetLogger(ctx context.Context) (types.StructuredLogger, bool) {
+	l, ok := ctx.Value(loggerKey).(types.StructuredLogger)
+	return l, ok
+}
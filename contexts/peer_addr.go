@@ -0,0 +1,23 @@
+package contexts
+
+import "context"
+
+// The key type is unexported to prevent collisions with context keys defined in
+// other packages.
+type peerAddrContextKey int
+
+const peerAddrKey peerAddrContextKey = 0
+
+// NewPeerAddrContext returns a new Context carrying the address of the peer
+// which sent the request when it is different than the client address in
+// the request.RemoteAddr - for example a trusted load balancer.
+func NewPeerAddrContext(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, peerAddrKey, addr)
+}
+
+// GetPeerAddr extracts the address of the peer which sent the request, if
+// present.
+func GetPeerAddr(ctx context.Context) (string, bool) {
+	addr, ok := ctx.Value(peerAddrKey).(string)
+	return addr, ok
+}
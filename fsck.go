@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/logger"
+	"github.com/ironsmile/nedomi/storage/disk"
+)
+
+const fsckCommand = "fsck"
+
+// fsckReport is what the fsck command outputs as JSON
+type fsckReport struct {
+	Zone string `json:"zone"`
+	*disk.FsckReport
+}
+
+// runFsck checks (and possibly repairs) the disk storage of a cache zone. The
+// result is written to the stdout as JSON.
+func runFsck(args []string) int {
+	var (
+		zoneID string
+		repair bool
+		flags  = flag.NewFlagSet(fsckCommand, flag.ContinueOnError)
+	)
+	flags.StringVar(&zoneID, "zone", "", "The ID of the cache zone which will be checked")
+	flags.BoolVar(&repair, "repair", false, "Delete the problematic files which are found")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if zoneID == "" {
+		fmt.Fprintln(os.Stderr, "The -zone argument is required. See -h.")
+		return 2
+	}
+
+	cfg, err := config.Get()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't parse the config: %s\n", err)
+		return 4
+	}
+
+	cfgCz, ok := cfg.CacheZones[zoneID]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "There is no cache zone `%s` in the config\n", zoneID)
+		return 2
+	}
+
+	if cfgCz.Type != "disk" {
+		fmt.Fprintf(os.Stderr, "Cache zone `%s` is of type `%s`, only disk storages can be checked\n",
+			zoneID, cfgCz.Type)
+		return 2
+	}
+
+	if repair && isRunning(cfg.System.Pidfile) {
+		fmt.Fprintf(os.Stderr, "nedomi seems to be running (see %s), stop it before repairing\n",
+			cfg.System.Pidfile)
+		return 7
+	}
+
+	l, err := logger.New(&cfg.Logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't initialize the logger: %s\n", err)
+		return 4
+	}
+
+	stor, err := disk.NewReadOnly(cfgCz, l)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't initialize the storage for cache zone `%s`: %s\n",
+			zoneID, err)
+		return 4
+	}
+
+	report, err := stor.Fsck(repair)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error while checking cache zone `%s`: %s\n", zoneID, err)
+		return 5
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	if err := enc.Encode(fsckReport{Zone: zoneID, FsckReport: report}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error while writing the report: %s\n", err)
+		return 5
+	}
+
+	if report.Problems() > 0 && !repair || len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// isRunning checks whether the pidfile points to a running process
+func isRunning(pidfile string) bool {
+	b, err := ioutil.ReadFile(pidfile)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return false
+	}
+	return syscall.Kill(pid, 0) == nil
+}
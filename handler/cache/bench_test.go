@@ -60,7 +60,7 @@ func benchmarkGetContentsiOf40(b *testing.B, i int) {
 			reqID:        types.RequestID(`testiID`),
 		}
 		rq.obj, _ = rq.Cache.Storage.GetMetadata(rq.objID)
-		contents, _, err := rq.getContents(indexes, i)
+		contents, _, _, err := rq.getContents(indexes, i)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ironsmile/nedomi/contexts"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils"
+)
+
+const (
+	cacheStatusHeader = "Cache-Status"
+	xCacheHeader      = "X-Cache"
+)
+
+// The reasons for forwarding a request to the upstream as defined in
+// https://tools.ietf.org/html/rfc9211#section-2.2
+const (
+	fwdBypass  = "bypass"
+	fwdMethod  = "method"
+	fwdURIMiss = "uri-miss"
+	fwdMiss    = "miss"
+	fwdRequest = "request"
+	fwdStale   = "stale"
+	fwdPartial = "partial"
+)
+
+// cacheStatus describes how the cache handler served a response.
+type cacheStatus struct {
+	result  types.CacheStatus
+	fwd     string // the reason for going to the upstream, empty for hits
+	fetched int    // the number of parts fetched from the upstream
+}
+
+// setCacheStatus sets the status of the response. It should be called before
+// writing the response headers.
+func (h *reqHandler) setCacheStatus(result types.CacheStatus, fwd string) {
+	h.status = &cacheStatus{result: result, fwd: fwd}
+}
+
+// setCacheStatusForParts sets the status of a response with a known object
+// depending on how many of the parts between start and end are in the storage.
+func (h *reqHandler) setCacheStatusForParts(start, end uint64) {
+	h.setCacheStatus(types.CacheStatusHit, "")
+	if h.req.Method == "HEAD" {
+		return
+	}
+	parts, err := h.Cache.Storage.GetAvailableParts(h.objID)
+	if err != nil {
+		h.log.Debugf("Could not get the available parts for the cache status: %s", err)
+		return
+	}
+	var available = make(map[uint32]struct{}, len(parts))
+	for _, part := range parts {
+		available[part.Part] = struct{}{}
+	}
+	var missing int
+	for _, idx := range utils.BreakInIndexes(h.objID, start, end, h.Cache.Storage.PartSize()) {
+		if _, ok := available[idx.Part]; !ok {
+			missing++
+		}
+	}
+	if missing > 0 {
+		h.setCacheStatus(types.CacheStatusPartial, fwdPartial)
+		h.status.fetched = missing
+	}
+}
+
+// writeCacheStatus writes the configured cache status headers in header and
+// saves the status for the access log. fwdStatus is the status code of the
+// upstream response or 0 when there was none.
+func (h *reqHandler) writeCacheStatus(header http.Header, fwdStatus int) {
+	if h.status == nil { // a sub request for parts from the upstream
+		return
+	}
+	info, _ := contexts.GetAccessInfo(h.req.Context())
+	info.SetCacheStatus(h.status.result)
+
+	if h.settings.CacheStatus {
+		var value = h.cacheStatusValue(fwdStatus)
+		if previous := header.Get(cacheStatusHeader); previous != "" {
+			// the caches closer to the client are last
+			value = previous + ", " + value
+		}
+		header.Set(cacheStatusHeader, value)
+	}
+	if h.settings.XCache {
+		header.Set(xCacheHeader, h.xCacheValue())
+	}
+}
+
+func (h *reqHandler) cacheStatusValue(fwdStatus int) string {
+	var buf = append([]byte(nil), h.settings.CacheStatusName...)
+	if h.status.fwd == "" {
+		buf = append(buf, "; hit"...)
+	} else {
+		buf = append(buf, "; fwd="...)
+		buf = append(buf, h.status.fwd...)
+	}
+	if fwdStatus != 0 {
+		buf = append(buf, "; fwd-status="...)
+		buf = strconv.AppendInt(buf, int64(fwdStatus), 10)
+	}
+	if h.obj != nil {
+		buf = append(buf, "; ttl="...)
+		buf = strconv.AppendInt(buf, h.obj.ExpiresAt-time.Now().Unix(), 10)
+	}
+	if h.status.fetched > 0 {
+		buf = append(buf, `; detail="`...)
+		buf = strconv.AppendInt(buf, int64(h.status.fetched), 10)
+		buf = append(buf, ` parts fetched"`...)
+	}
+	return string(buf)
+}
+
+func (h *reqHandler) xCacheValue() string {
+	var value string
+	switch h.status.result {
+	case types.CacheStatusHit:
+		value = "HIT"
+	case types.CacheStatusPartial:
+		value = "PARTIAL_HIT"
+	default:
+		value = "MISS"
+	}
+	return value + " from " + h.settings.CacheStatusName
+}
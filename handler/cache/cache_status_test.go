@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ironsmile/nedomi/contexts"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/testutils"
+)
+
+func TestCacheStatusHeaders(t *testing.T) {
+	t.Parallel()
+	var fsmap = map[string]string{"file": testutils.GenerateMeAString(3, 20)}
+	app := newTestAppFromMap(t, fsmap)
+	defer app.cleanup()
+
+	var rec = httptest.NewRecorder()
+	options, _ := http.NewRequest("OPTIONS", "http://example.com/file", nil)
+	app.cacheHandler.ServeHTTP(rec, options.WithContext(contexts.NewAccessInfoContext(context.Background(), new(types.AccessInfo))))
+	if got := rec.Header().Get(cacheStatusHeader); got != "" {
+		t.Errorf("Expected no Cache-Status header by default but got %q", got)
+	}
+
+	app.cacheHandler.settings.CacheStatus = true
+	app.cacheHandler.settings.XCache = true
+
+	var check = func(req *http.Request, status types.CacheStatus, cacheStatus, xCache string) {
+		var rec = httptest.NewRecorder()
+		var info = new(types.AccessInfo)
+		req = req.WithContext(contexts.NewAccessInfoContext(context.Background(), info))
+		app.cacheHandler.ServeHTTP(rec, req)
+		if got := info.CacheStatus(); got != status {
+			t.Errorf("Expected cache status %s for %s %s but got %s",
+				status, req.Method, req.Header.Get("Range"), got)
+		}
+		if got := rec.Header().Get(cacheStatusHeader); !strings.HasPrefix(got, cacheStatus) {
+			t.Errorf("Expected Cache-Status starting with %q but got %q", cacheStatus, got)
+		}
+		if got := rec.Header().Get(xCacheHeader); got != xCache {
+			t.Errorf("Expected X-Cache %q but got %q", xCache, got)
+		}
+	}
+
+	full, _ := http.NewRequest("GET", "http://example.com/file", nil)
+	check(full, types.CacheStatusMiss,
+		"nedomi; fwd=uri-miss; fwd-status=200", "MISS from nedomi")
+	check(reqForRange("file", 5, 10), types.CacheStatusHit,
+		"nedomi; hit; ttl=", "HIT from nedomi")
+	post, _ := http.NewRequest("POST", "http://example.com/file", nil)
+	check(post, types.CacheStatusBypass, "nedomi; fwd=method", "MISS from nedomi")
+}
+
+func TestCacheStatusPartsFetched(t *testing.T) {
+	t.Parallel()
+	var fsmap = map[string]string{"file": testutils.GenerateMeAString(4, 20)}
+	app := newTestAppFromMap(t, fsmap)
+	defer app.cleanup()
+	app.cacheHandler.settings.CacheStatus = true
+
+	app.testRange("file", 0, 5)
+	var rec = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://example.com/file", nil)
+	var info = new(types.AccessInfo)
+	req = req.WithContext(contexts.NewAccessInfoContext(context.Background(), info))
+	app.cacheHandler.ServeHTTP(rec, req)
+	if got := info.CacheStatus(); got != types.CacheStatusPartial {
+		t.Errorf("Expected a partial hit but got %s", got)
+	}
+	if got := info.CacheBytes(); got != 5 {
+		t.Errorf("Expected 5 bytes from the cache but got %d", got)
+	}
+	if got := rec.Header().Get(cacheStatusHeader); !strings.HasSuffix(got, `; detail="3 parts fetched"`) {
+		t.Errorf("Expected three fetched parts in the Cache-Status but got %q", got)
+	}
+	if got := rec.Header().Get(xCacheHeader); got != "" {
+		t.Errorf("Expected no X-Cache header by default but got %q", got)
+	}
+}
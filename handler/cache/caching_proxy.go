@@ -1,19 +1,36 @@
 package cache
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 
 	"github.com/ironsmile/nedomi/config"
 	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils"
 )
 
 // CachingProxy is resposible for caching the metadata and parts the requested
 // objects to `loc.Storage`, according to the `loc.Algorithm`.
 type CachingProxy struct {
 	*types.Location
-	cfg  *config.Handler
-	next http.Handler
+	cfg      *config.Handler
+	next     http.Handler
+	settings settings
+}
+
+// settings are the per location settings of the caching proxy
+type settings struct {
+	// CacheStatus enables the RFC 9211 Cache-Status response header
+	CacheStatus bool `json:"cache_status"`
+	// XCache enables the legacy X-Cache response header
+	XCache bool `json:"x_cache"`
+	// CacheStatusName is the name of the cache in the response headers
+	CacheStatusName string `json:"cache_status_name"`
+}
+
+var defaultSettings = settings{
+	CacheStatusName: "nedomi",
 }
 
 // New creates and returns a ready to used Handler.
@@ -26,20 +43,35 @@ func New(cfg *config.Handler, loc *types.Location, next http.Handler) (*CachingP
 		return nil, fmt.Errorf("caching proxy handler for %s needs a configured cache zone", loc.Name)
 	}
 
-	return &CachingProxy{loc, cfg, next}, nil
+	var s = defaultSettings
+	if cfg != nil && len(cfg.Settings) > 0 {
+		if err := json.Unmarshal(cfg.Settings, &s); err != nil {
+			return nil, fmt.Errorf("error while parsing settings for handler.cache - %s",
+				utils.ShowContextOfJSONError(err, cfg.Settings))
+		}
+	}
+
+	return &CachingProxy{
+		Location: loc,
+		cfg:      cfg,
+		next:     next,
+		settings: s,
+	}, nil
 }
 
 // ServeHTTP is the main serving function
 func (c *CachingProxy) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
-	if req.Method != "GET" && req.Method != "HEAD" {
-		c.next.ServeHTTP(resp, req)
-		return
-	}
-
 	rh := &reqHandler{
 		CachingProxy: c,
 		req:          req,
 		resp:         resp,
 	}
+	if req.Method != "GET" && req.Method != "HEAD" {
+		rh.setCacheStatus(types.CacheStatusBypass, fwdMethod)
+		rh.writeCacheStatus(resp.Header(), 0)
+		c.next.ServeHTTP(resp, req)
+		return
+	}
+
 	rh.handle()
 }
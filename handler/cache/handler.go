@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/ironsmile/nedomi/contexts"
+	"github.com/ironsmile/nedomi/logger"
 	"github.com/ironsmile/nedomi/types"
 	"github.com/ironsmile/nedomi/utils"
 	"github.com/ironsmile/nedomi/utils/cacheutils"
@@ -17,11 +18,13 @@ import (
 // parameters and state between the different functions)
 type reqHandler struct {
 	*CachingProxy
-	req   *http.Request
-	resp  http.ResponseWriter
-	objID *types.ObjectID
-	obj   *types.ObjectMetadata
-	reqID types.RequestID
+	req    *http.Request
+	resp   http.ResponseWriter
+	objID  *types.ObjectID
+	obj    *types.ObjectMetadata
+	reqID  types.RequestID
+	log    types.StructuredLogger
+	status *cacheStatus
 }
 
 // handle tries to respond to client request by loading metadata and file parts
@@ -29,15 +32,17 @@ type reqHandler struct {
 func (h *reqHandler) handle() {
 	h.objID = h.NewObjectIDForURL(h.req.URL)
 	h.reqID, _ = contexts.GetRequestID(h.req.Context())
-	h.Logger.Debugf("[%s] Caching proxy access: %s %s", h.reqID, h.req.Method, h.req.RequestURI)
+	h.log = logger.FromContext(h.req.Context(), h.Logger)
+	h.log.Debugf("Caching proxy access: %s %s", h.req.Method, h.req.RequestURI)
 
 	rng := h.req.Header.Get("Range")
 	obj, err := h.Cache.Storage.GetMetadata(h.objID)
 	if os.IsNotExist(err) {
-		h.Logger.Debugf("[%s] No metadata on storage, proxying...", h.reqID)
+		h.log.Debugf("No metadata on storage, proxying...")
+		h.setCacheStatus(types.CacheStatusMiss, fwdURIMiss)
 		h.carbonCopyProxy()
 	} else if err != nil {
-		h.Logger.Errorf("[%s] Storage error when reading metadata: %s", h.reqID, err)
+		h.log.Errorf("Storage error when reading metadata: %s", err)
 		if isTooManyFiles(err) {
 			http.Error(
 				h.resp,
@@ -46,21 +51,22 @@ func (h *reqHandler) handle() {
 			return
 		}
 		if discardErr := h.Cache.Storage.Discard(h.objID); discardErr != nil {
-			h.Logger.Errorf("[%s] Storage error when discarding of object's data: %s",
-				h.reqID, discardErr)
+			h.log.Errorf("Storage error when discarding of object's data: %s", discardErr)
 		}
+		h.setCacheStatus(types.CacheStatusMiss, fwdMiss)
 		h.carbonCopyProxy()
 	} else if !utils.IsMetadataFresh(obj) {
-		h.Logger.Debugf("[%s] Metadata is stale, proxying...", h.reqID)
+		h.log.Debugf("Metadata is stale, proxying...")
 		//!TODO: optimize, do only a head request when the metadata is stale?
 		if discardErr := h.Cache.Storage.Discard(h.objID); discardErr != nil {
-			h.Logger.Errorf("[%s] Storage error when discarding of object's data: %s",
-				h.reqID, discardErr)
+			h.log.Errorf("Storage error when discarding of object's data: %s", discardErr)
 		}
+		h.setCacheStatus(types.CacheStatusStale, fwdStale)
 		h.carbonCopyProxy()
 	} else if !cacheutils.CacheSatisfiesRequest(obj, h.req) {
-		h.Logger.Debugf("[%s] Client does not want cached response or the cache does not"+
-			"satisfy the request, proxying...", h.reqID)
+		h.log.Debugf("Client does not want cached response or the cache does not " +
+			"satisfy the request, proxying...")
+		h.setCacheStatus(types.CacheStatusMiss, fwdRequest)
 		h.carbonCopyProxy()
 	} else {
 		h.obj = obj
@@ -75,12 +81,10 @@ func (h *reqHandler) handle() {
 		// (Not Modified) response."
 
 		if rng != "" {
-			h.Logger.Debugf("[%s] Serving range '%s', preferably from cache...",
-				h.reqID, rng)
+			h.log.Debugf("Serving range '%s', preferably from cache...", rng)
 			h.knownRanged()
 		} else {
-			h.Logger.Debugf("[%s] Serving full object, preferably from cache...",
-				h.reqID)
+			h.log.Debugf("Serving full object, preferably from cache...")
 			h.knownFull()
 		}
 	}
@@ -92,9 +96,9 @@ func (h *reqHandler) carbonCopyProxy() {
 		if flexibleResp.BodyWriter != nil {
 			if err := flexibleResp.BodyWriter.Close(); err != nil {
 				if isPartWriterShorWrite(err) {
-					h.Logger.Debugf("[%s] Error while closing flexibleResponse: %s", h.reqID, err)
+					h.log.Debugf("Error while closing flexibleResponse: %s", err)
 				} else {
-					h.Logger.Errorf("[%s] Error while closing flexibleResponse: %s", h.reqID, err)
+					h.log.Errorf("Error while closing flexibleResponse: %s", err)
 				}
 			}
 		}
@@ -120,6 +124,7 @@ func (h *reqHandler) knownRanged() {
 	if len(ranges) != 1 {
 		// We do not support multiple ranges but maybe the upstream does
 		//!TODO: implement support for multiple ranges
+		h.setCacheStatus(types.CacheStatusMiss, fwdBypass)
 		h.carbonCopyProxy()
 		return
 	}
@@ -129,6 +134,8 @@ func (h *reqHandler) knownRanged() {
 	h.resp.Header().Set("Content-Range", reqRange.ContentRange(h.obj.Size))
 	h.resp.Header().Set("Content-Length", strconv.FormatUint(reqRange.Length, 10))
 	h.rewriteTimeBasedHeaders()
+	h.setCacheStatusForParts(reqRange.Start, reqRange.Start+reqRange.Length-1)
+	h.writeCacheStatus(h.resp.Header(), 0)
 	h.resp.WriteHeader(http.StatusPartialContent)
 	if h.req.Method == "HEAD" {
 		return
@@ -141,15 +148,17 @@ func (h *reqHandler) knownFull() {
 	httputils.CopyHeaders(h.obj.Headers, h.resp.Header())
 	h.resp.Header().Set("Content-Length", strconv.FormatUint(h.obj.Size, 10))
 	h.rewriteTimeBasedHeaders()
+	var responseSize = h.obj.Size
+	if responseSize != 0 {
+		responseSize--
+	}
+	h.setCacheStatusForParts(0, responseSize)
+	h.writeCacheStatus(h.resp.Header(), 0)
 	h.resp.WriteHeader(h.obj.Code)
 	if h.req.Method == "HEAD" {
 		return
 	}
 
-	var responseSize = h.obj.Size
-	if responseSize != 0 {
-		responseSize--
-	}
 	h.lazilyRespond(0, responseSize)
 }
 
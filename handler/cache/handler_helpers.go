@@ -49,34 +49,33 @@ func (h *reqHandler) getNormalizedRequest() *http.Request {
 func (h *reqHandler) getResponseHook() func(*httputils.FlexibleResponseWriter) {
 
 	return func(rw *httputils.FlexibleResponseWriter) {
-		h.Logger.Debugf("[%s] Received headers for %s, sending them to client...",
-			h.reqID, h.req.URL)
+		h.log.Debugf("Received headers for %s, sending them to client...", h.req.URL)
 		httputils.CopyHeadersWithout(rw.Headers, h.resp.Header(), hopHeaders...)
+		h.writeCacheStatus(h.resp.Header(), rw.Code)
 		h.resp.WriteHeader(rw.Code)
 
 		isCacheable := cacheutils.IsResponseCacheable(rw.Code, rw.Headers)
 		if !isCacheable {
-			h.Logger.Debugf("[%s] Response is non-cacheable", h.reqID)
+			h.log.Debugf("Response is non-cacheable")
 			rw.BodyWriter = utils.AddCloser(h.resp)
 			return
 		}
 
 		expiresIn := cacheutils.ResponseExpiresIn(rw.Headers, h.CacheDefaultDuration)
 		if expiresIn <= 0 {
-			h.Logger.Debugf("[%s] Response expires in the past: %s", h.reqID, expiresIn)
+			h.log.Debugf("Response expires in the past: %s", expiresIn)
 			rw.BodyWriter = utils.AddCloser(h.resp)
 			return
 		}
 
 		responseRange, err := httputils.GetResponseRange(rw.Code, rw.Headers)
 		if err != nil {
-			h.Logger.Debugf("[%s] Was not able to get response range (%s)",
-				h.reqID, err)
+			h.log.Debugf("Was not able to get response range (%s)", err)
 			rw.BodyWriter = utils.AddCloser(h.resp)
 			return
 		}
 
-		h.Logger.Debugf("[%s] Response is cacheable! Caching metadata and parts", h.reqID)
+		h.log.Debugf("Response is cacheable! Caching metadata and parts")
 
 		code := rw.Code
 		if code == http.StatusPartialContent {
@@ -107,8 +106,7 @@ func (h *reqHandler) getResponseHook() func(*httputils.FlexibleResponseWriter) {
 		//!TODO: also, error if we already have fresh metadata but the
 		//       received metadata is different
 		if err := h.Cache.Storage.SaveMetadata(obj); err != nil {
-			h.Logger.Errorf("[%s] Could not save metadata for %s: %s",
-				h.reqID, obj.ID, err)
+			h.log.Errorf("Could not save metadata for %s: %s", obj.ID, err)
 			rw.BodyWriter = utils.AddCloser(h.resp)
 			return
 		}
@@ -123,7 +121,7 @@ func (h *reqHandler) getResponseHook() func(*httputils.FlexibleResponseWriter) {
 			PartWriter(h.Cache, h.objID, *responseRange),
 		)
 
-		h.Logger.Debugf("[%s] Setting the cached data to expire in %s", h.reqID, expiresIn)
+		h.log.Debugf("Setting the cached data to expire in %s", expiresIn)
 		h.Cache.Scheduler.AddEvent(
 			h.objID.Hash(),
 			storage.GetExpirationHandler(h.Cache, h.objID),
@@ -138,15 +136,18 @@ func idSuffix(s, e uint64) []byte {
 
 func (h *reqHandler) getUpstreamReader(start, end uint64) io.ReadCloser {
 	subh := *h
+	subh.status = nil
 	// ->start-end
 	var newCtx context.Context
 	newCtx, subh.reqID = contexts.AppendToRequestID(subh.req.Context(), idSuffix(start, end))
+	subh.log = h.log.With(types.LogField{Key: types.LogFieldRequestID, Value: subh.reqID})
+	newCtx = contexts.NewLoggerContext(newCtx, subh.log)
 	subh.req = subh.getNormalizedRequest()
 	subh.req = subh.req.WithContext(newCtx)
 	subh.req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
 
-	h.Logger.Debugf("[%s] Making upstream request for %s, bytes [%d-%d]...",
-		subh.reqID, subh.req.URL, start, end)
+	subh.log.Debugf("Making upstream request for %s, bytes [%d-%d]...",
+		subh.req.URL, start, end)
 
 	//!TODO: optimize requests for the same pieces?
 	//       if possible, make only 1 request to the upstream for the same part
@@ -155,13 +156,11 @@ func (h *reqHandler) getUpstreamReader(start, end uint64) io.ReadCloser {
 	subh.resp = httputils.NewFlexibleResponseWriter(func(rw *httputils.FlexibleResponseWriter) {
 		respRng, err := httputils.GetResponseRange(rw.Code, rw.Headers)
 		if err != nil {
-			h.Logger.Debugf("[%s] Could not parse the content-range"+
-				"for the partial upstream request: %s",
-				subh.reqID, err)
+			subh.log.Debugf("Could not parse the content-range "+
+				"for the partial upstream request: %s", err)
 			_ = w.CloseWithError(err)
 		}
-		h.Logger.Debugf("[%s] Received response with status %d and range %v",
-			subh.reqID, rw.Code, respRng)
+		subh.log.Debugf("Received response with status %d and range %v", rw.Code, respRng)
 		if rw.Code == http.StatusPartialContent {
 			//!TODO: check whether the returned range corresponds to the requested range
 			rw.BodyWriter = w
@@ -176,7 +175,7 @@ func (h *reqHandler) getUpstreamReader(start, end uint64) io.ReadCloser {
 	go utils.SafeExecute(
 		subh.carbonCopyProxy,
 		func(err error) {
-			h.Logger.Errorf("[%s] Panic inside carbonCopyProxy %s", subh.reqID, err)
+			subh.log.Errorf("Panic inside carbonCopyProxy %s", err)
 			w.CloseWithError(err) // !TODO maybe some other error
 		},
 	)
@@ -195,30 +194,30 @@ func (h *reqHandler) getPartFromStorage(idx *types.ObjectIndex) (io.ReadCloser,
 		if isTooManyFiles(err) {
 			return nil, err
 		}
-		h.Logger.Errorf("[%s] Unexpected error while trying to load %s from storage: %s",
-			h.reqID, idx, err)
+		h.log.Errorf("Unexpected error while trying to load %s from storage: %s", idx, err)
 	} else if cached {
-		h.Logger.Debugf(
-			"[%s] CacheAlgorithm said a part %s is cached but Storage couldn't find it",
-			h.reqID, idx)
+		h.log.Debugf("CacheAlgorithm said a part %s is cached but Storage couldn't find it", idx)
 	}
 	return nil, nil
 }
 
+// getContents returns a reader for the parts of the indexes starting at from,
+// the number of parts it will read and how many of its first bytes will come
+// from the upstream.
 func (h *reqHandler) getContents(indexes []*types.ObjectIndex, from int,
-) (io.ReadCloser, int, error) {
+) (io.ReadCloser, int, uint64, error) {
 	r, err := h.getPartFromStorage(indexes[from])
 	if r != nil {
-		return r, 1, nil
+		return r, 1, 0, nil
 	} else if err != nil {
-		return nil, 0, err
+		return nil, 0, 0, err
 	}
 
 	partSize := h.Cache.Storage.PartSize()
 	fromByte := uint64(indexes[from].Part) * partSize
 	parts, err := h.Cache.Storage.GetAvailableParts(h.objID)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, 0, err
 	}
 	sort.Sort(objectIndexes(parts))
 	i := sort.Search(len(parts), func(i int) bool {
@@ -231,12 +230,12 @@ func (h *reqHandler) getContents(indexes []*types.ObjectIndex, from int,
 			toByte := umin(h.obj.Size, uint64(parts[i].Part)*partSize-1)
 			return utils.MultiReadCloser(
 					h.getUpstreamReader(fromByte, toByte), r),
-				int(parts[i].Part-indexes[from].Part) + 1, nil
+				int(parts[i].Part-indexes[from].Part) + 1, toByte - fromByte + 1, nil
 		}
 	}
 
 	toByte := umin(h.obj.Size, uint64(indexes[len(indexes)-1].Part+1)*partSize-1)
-	return h.getUpstreamReader(fromByte, toByte), len(indexes) - from, nil
+	return h.getUpstreamReader(fromByte, toByte), len(indexes) - from, toByte - fromByte + 1, nil
 }
 
 func (h *reqHandler) lazilyRespond(start, end uint64) {
@@ -246,19 +245,18 @@ func (h *reqHandler) lazilyRespond(start, end uint64) {
 	var shouldReturn = false
 
 	for i := 0; i < len(indexes); {
-		contents, partsCount, err := h.getContents(indexes, i)
+		contents, partsCount, fromUpstream, err := h.getContents(indexes, i)
 		if err != nil {
-			h.Logger.Errorf(
-				"[%s] Unexpected error while trying to load %s from storage: %s",
-				h.reqID, indexes[i], err)
+			h.log.Errorf("Unexpected error while trying to load %s from storage: %s",
+				indexes[i], err)
 			return
 		}
 		if i == 0 && startOffset > 0 {
+			fromUpstream -= umin(fromUpstream, startOffset)
 			contents, err = utils.SkipReadCloser(contents, int64(startOffset))
 			if err != nil {
-				h.Logger.Errorf(
-					"[%s] Unexpected error while trying to skip %d from %s: %s",
-					h.reqID, startOffset, indexes[i], err)
+				h.log.Errorf("Unexpected error while trying to skip %d from %s: %s",
+					startOffset, indexes[i], err)
 				return
 			}
 		}
@@ -271,20 +269,22 @@ func (h *reqHandler) lazilyRespond(start, end uint64) {
 			contents = utils.LimitReadCloser(contents, int64(endLimit))
 		}
 
-		if copied, err := io.Copy(h.resp, contents); err != nil {
-			h.Logger.Logf(
-				"[%s] Error sending contents after %dbytes of %s, parts[%d-%d]: %s",
-				h.reqID, copied, h.objID, indexes[i].Part,
-				indexes[i+partsCount-1].Part, err)
+		copied, err := io.Copy(h.resp, contents)
+		if err != nil {
+			h.log.Logf("Error sending contents after %dbytes of %s, parts[%d-%d]: %s",
+				copied, h.objID, indexes[i].Part, indexes[i+partsCount-1].Part, err)
 
 			shouldReturn = true
 		}
+		// the bytes from the upstream are always before the ones from the storage
+		var fromCache = uint64(copied) - umin(uint64(copied), fromUpstream)
+		h.Stats.ServedFromCache(fromCache)
+		info, _ := contexts.GetAccessInfo(h.req.Context())
+		info.AddCacheBytes(fromCache)
 		//!TODO: compare the copied length with the expected
 		if err := contents.Close(); err != nil {
-			h.Logger.Errorf(
-				"[%s] Error while closing content reader for %s, parts[%d-%d]: %s",
-				h.reqID, h.objID, indexes[i].Part, indexes[i+partsCount-1].Part,
-				err)
+			h.log.Errorf("Error while closing content reader for %s, parts[%d-%d]: %s",
+				h.objID, indexes[i].Part, indexes[i+partsCount-1].Part, err)
 		}
 
 		if shouldReturn {
@@ -92,11 +92,13 @@ func (pw *partWriter) flushBuffer() error {
 	if !pw.cz.Algorithm.ShouldKeep(idx) {
 		pw.buf = nil
 		return nil
-	} else if err := pw.cz.Storage.SavePart(idx, bytes.NewBuffer(pw.buf)); err != nil {
+	}
+	var size = types.BytesSize(len(pw.buf))
+	if err := pw.cz.Storage.SavePart(idx, bytes.NewBuffer(pw.buf)); err != nil {
 		return err
 	}
 	pw.buf = nil
-	if err := pw.cz.Algorithm.AddObject(idx); err != nil && err != types.ErrAlreadyInCache {
+	if err := pw.cz.Algorithm.AddObject(idx, size); err != nil && err != types.ErrAlreadyInCache {
 		return err
 	}
 	return nil
@@ -39,6 +39,29 @@ func Test2PartsFile(t *testing.T) {
 	app.testFullRequest(file)
 }
 
+func TestCacheBytes(t *testing.T) {
+	var fsmap = make(map[string]string)
+	var file = "2parts"
+	fsmap[file] = testutils.GenerateMeAString(2, 10)
+	t.Parallel()
+	app := newTestAppFromMap(t, fsmap)
+	defer app.cleanup()
+	var stats = app.cacheHandler.Stats
+
+	app.testFullRequest(file)
+	if stats.CacheBytes() != 0 {
+		t.Errorf("Expected nothing from the cache but got %d bytes", stats.CacheBytes())
+	}
+	app.testFullRequest(file)
+	if stats.CacheBytes() != 10 {
+		t.Errorf("Expected 10 bytes from the cache but got %d", stats.CacheBytes())
+	}
+	app.testRange(file, 2, 6)
+	if stats.CacheBytes() != 16 {
+		t.Errorf("Expected 16 bytes from the cache but got %d", stats.CacheBytes())
+	}
+}
+
 func TestZeroSizeFile(t *testing.T) {
 	t.Parallel()
 	app := newTestApp(t)
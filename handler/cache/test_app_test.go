@@ -95,6 +95,7 @@ func newTestAppFromMap(t testing.TB, fsmap map[string]string) *testApp {
 	loc.Logger = newStdLogger()
 	loc.CacheKey = "test"
 	loc.CacheKeyIncludesQuery = false
+	loc.Stats = new(types.LocationStats)
 
 	path, cleanup := testutils.GetTestFolder(t)
 
@@ -0,0 +1,165 @@
+// Package loglevel contains a handler which temporarily changes the log level
+// of a virtual host or a location.
+package loglevel
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/contexts"
+	"github.com/ironsmile/nedomi/logger"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/httputils"
+)
+
+const (
+	defaultLevel    = "debug"
+	defaultDuration = 10 * time.Minute
+	maxDuration     = 24 * time.Hour
+)
+
+// Handler lists and changes the log level overrides of the locations.
+type Handler struct {
+	logger types.Logger
+}
+
+type overrideRequest struct {
+	VHost    string `json:"vhost"`
+	Location string `json:"location"`
+	Level    string `json:"level"`
+	Duration uint32 `json:"duration"` // seconds
+}
+
+type override struct {
+	VHost    string    `json:"vhost"`
+	Location string    `json:"location"`
+	Level    string    `json:"level"`
+	Until    time.Time `json:"until"`
+}
+
+// ServeHTTP lists the overrides on GET, overrides the level of a location on
+// POST and reverts it on DELETE.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var l = logger.FromContext(r.Context(), h.logger)
+	//!TODO authentication
+	var app, ok = contexts.GetApp(r.Context())
+	if !ok {
+		httputils.Error(w, http.StatusInternalServerError)
+		l.Errorf("no app in context")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "POST", "DELETE":
+		var req overrideRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			l.Errorf("error on parsing request %s", err)
+			return
+		}
+		status, err := h.change(app, r.Method, req)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		l.Logf("log level of %s %s changed with %s to %q", req.VHost, req.Location,
+			r.Method, req.Level)
+	default:
+		httputils.Error(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(overrides(app)); err != nil {
+		l.Errorf("error while encoding response %s", err)
+	}
+}
+
+// change applies the override request and returns the status code for the
+// response if it fails.
+func (h *Handler) change(app types.App, method string, req overrideRequest) (int, error) {
+	var location = findLocation(app, req.VHost, req.Location)
+	if location == nil {
+		return http.StatusNotFound, fmt.Errorf("no location %q in virtual host %q",
+			req.Location, req.VHost)
+	}
+	o, ok := location.Logger.(*logger.Overridable)
+	if !ok {
+		return http.StatusBadRequest, fmt.Errorf("the logger of the location can not be overridden")
+	}
+	if method == "DELETE" {
+		o.Reset()
+		return 0, nil
+	}
+
+	if req.Level == "" {
+		req.Level = defaultLevel
+	}
+	var duration = time.Duration(req.Duration) * time.Second
+	if duration == 0 {
+		duration = defaultDuration
+	}
+	if duration > maxDuration {
+		return http.StatusBadRequest, fmt.Errorf("the duration can be at most %s", maxDuration)
+	}
+	if err := o.Override(req.Level, duration); err != nil {
+		return http.StatusBadRequest, err
+	}
+	return 0, nil
+}
+
+// findLocation returns the location with the name in the virtual host. An
+// empty name or the name of the virtual host is the virtual host itself.
+func findLocation(app types.App, vhost, name string) *types.Location {
+	var locations = app.Locations()[vhost]
+	if len(locations) > 0 && (name == "" || name == vhost) {
+		return locations[0]
+	}
+	for _, location := range locations {
+		if location.Name == name {
+			return location
+		}
+	}
+	return nil
+}
+
+// overrides returns the current overrides sorted by virtual host.
+func overrides(app types.App) []override {
+	var all = app.Locations()
+	var vhosts = make([]string, 0, len(all))
+	for vhost := range all {
+		vhosts = append(vhosts, vhost)
+	}
+	sort.Strings(vhosts)
+
+	var result = make([]override, 0)
+	for _, vhost := range vhosts {
+		for _, location := range all[vhost] {
+			o, ok := location.Logger.(*logger.Overridable)
+			if !ok {
+				continue
+			}
+			if level, until, ok := o.Overridden(); ok {
+				result = append(result, override{
+					VHost:    vhost,
+					Location: location.Name,
+					Level:    level,
+					Until:    until,
+				})
+			}
+		}
+	}
+	return result
+}
+
+// New creates and returns a ready to use log level Handler.
+func New(cfg *config.Handler, l *types.Location, next http.Handler) (*Handler, error) {
+	return &Handler{
+		logger: l.Logger,
+	}, nil
+}
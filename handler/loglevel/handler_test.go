@@ -0,0 +1,119 @@
+package loglevel
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/contexts"
+	"github.com/ironsmile/nedomi/logger"
+	"github.com/ironsmile/nedomi/mock"
+	"github.com/ironsmile/nedomi/types"
+)
+
+type mockApp struct {
+	types.App
+	locations map[string][]*types.Location
+}
+
+func (m *mockApp) Locations() map[string][]*types.Location {
+	return m.locations
+}
+
+func newLocation(t *testing.T, name string) *types.Location {
+	l, err := logger.NewOverridable(config.NewLogger("std", []byte(`{"level": "error"}`)), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &types.Location{Name: name, Logger: l}
+}
+
+func serve(t *testing.T, ctx context.Context, h *Handler, method, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, "http://admin/loglevel", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req.WithContext(ctx))
+	return rec
+}
+
+func TestLogLevelOverrides(t *testing.T) {
+	t.Parallel()
+	var (
+		vhost    = newLocation(t, "example.com")
+		location = newLocation(t, `~ \.flv$`)
+		other    = newLocation(t, "example.net")
+	)
+	var app = &mockApp{locations: map[string][]*types.Location{
+		"example.com": {vhost, location},
+		"example.net": {other},
+	}}
+	var ctx = contexts.NewAppContext(context.Background(), app)
+	h, err := New(&config.Handler{}, &types.Location{Logger: mock.NewLogger()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(t, ctx, h, "POST", `{"vhost": "example.com", "location": "~ \\.flv$", "duration": 60}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected code %d: %s", rec.Code, rec.Body.String())
+	}
+	var result []override
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].VHost != "example.com" || result[0].Location != `~ \.flv$` ||
+		result[0].Level != "debug" {
+		t.Errorf("Unexpected overrides %+v", result)
+	}
+	for _, loc := range []*types.Location{vhost, other} {
+		if _, _, ok := loc.Logger.(*logger.Overridable).Overridden(); ok {
+			t.Errorf("The logger of %s was overridden", loc.Name)
+		}
+	}
+
+	if rec = serve(t, ctx, h, "GET", ""); !strings.Contains(rec.Body.String(), `"level":"debug"`) {
+		t.Errorf("Unexpected overrides %s", rec.Body.String())
+	}
+	rec = serve(t, ctx, h, "DELETE", `{"vhost": "example.com", "location": "~ \\.flv$"}`)
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("Unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+	if _, _, ok := location.Logger.(*logger.Overridable).Overridden(); ok {
+		t.Error("The override was not removed")
+	}
+}
+
+func TestLogLevelErrors(t *testing.T) {
+	t.Parallel()
+	var app = &mockApp{locations: map[string][]*types.Location{
+		"example.com": {newLocation(t, "example.com")},
+		"example.net": {{Name: "example.net", Logger: mock.NewLogger()}},
+	}}
+	var ctx = contexts.NewAppContext(context.Background(), app)
+	h, err := New(&config.Handler{}, &types.Location{Logger: mock.NewLogger()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		method, body string
+		code         int
+	}{
+		{"PUT", "", http.StatusMethodNotAllowed},
+		{"POST", "not json", http.StatusBadRequest},
+		{"POST", `{"vhost": "example.org"}`, http.StatusNotFound},
+		{"POST", `{"vhost": "example.com", "location": "/missing"}`, http.StatusNotFound},
+		{"POST", `{"vhost": "example.com", "level": "verbose"}`, http.StatusBadRequest},
+		{"POST", `{"vhost": "example.com", "duration": 1000000}`, http.StatusBadRequest},
+		{"POST", `{"vhost": "example.net"}`, http.StatusBadRequest},
+	} {
+		if rec := serve(t, ctx, h, test.method, test.body); rec.Code != test.code {
+			t.Errorf("Expected %d for %s %s but got %d", test.code, test.method, test.body, rec.Code)
+		}
+	}
+}
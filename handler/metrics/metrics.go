@@ -0,0 +1,107 @@
+// Package metrics contains a handler which exposes the metrics of the server
+// in the Prometheus text exposition format.
+package metrics
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/contexts"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/metrics"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler writes the metrics of the application, its cache zones and all
+// metrics in the default registry.
+type Handler struct {
+	loc *types.Location
+}
+
+// ServeHTTP writes the metrics.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reqID, _ := contexts.GetRequestID(r.Context())
+	app, ok := contexts.GetApp(r.Context())
+	if !ok {
+		h.loc.Logger.Errorf("[%s] could not get the App from the context", reqID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	cacheZones, _ := contexts.GetCacheZones(r.Context())
+
+	w.Header().Set("Content-Type", contentType)
+	var mw = metrics.NewWriter(w)
+	writeAppMetrics(mw, app.Stats())
+	writeCacheZoneMetrics(mw, cacheZones)
+	metrics.DefaultRegistry.Collect(mw)
+	if err := mw.Flush(); err != nil {
+		h.loc.Logger.Errorf("[%s] error while writing the metrics: %s", reqID, err)
+	}
+}
+
+func writeAppMetrics(w *metrics.Writer, stats types.AppStats) {
+	w.Header("nedomi_requests_total", "Number of received requests.", metrics.TypeCounter)
+	w.Sample("nedomi_requests_total", nil, nil, float64(stats.Requests))
+	w.Header("nedomi_requests_not_configured_total",
+		"Number of requests for hosts and paths which are not configured.", metrics.TypeCounter)
+	w.Sample("nedomi_requests_not_configured_total", nil, nil, float64(stats.NotConfigured))
+	w.Header("nedomi_requests_in_flight", "Number of requests being served.", metrics.TypeGauge)
+	w.Sample("nedomi_requests_in_flight", nil, nil,
+		float64(stats.Requests-stats.Responded-stats.NotConfigured))
+	w.Header("nedomi_open_connections", "Number of open client connections.", metrics.TypeGauge)
+	w.Sample("nedomi_open_connections", nil, nil, float64(stats.OpenConnections))
+	w.Header("nedomi_open_streams", "Number of HTTP/2 streams being served.", metrics.TypeGauge)
+	w.Sample("nedomi_open_streams", nil, nil, float64(stats.OpenStreams))
+	w.Header("nedomi_access_log_dropped_total",
+		"Number of access log lines dropped because the log queue was full.", metrics.TypeCounter)
+	w.Sample("nedomi_access_log_dropped_total", nil, nil, float64(stats.AccessLogDropped))
+}
+
+// zoneMetric is a metric which value is taken from the cache zone stats
+type zoneMetric struct {
+	name, help, typ string
+	value           func(types.CacheStats) uint64
+}
+
+var zoneMetrics = []zoneMetric{
+	{"nedomi_cache_hits_total", "Number of lookups found in the cache zone.",
+		metrics.TypeCounter, types.CacheStats.Hits},
+	{"nedomi_cache_misses_total", "Number of lookups not found in the cache zone.",
+		metrics.TypeCounter, func(s types.CacheStats) uint64 { return s.Requests() - s.Hits() }},
+	{"nedomi_cache_objects", "Number of object parts in the cache zone.",
+		metrics.TypeGauge, types.CacheStats.Objects},
+	{"nedomi_cache_bytes", "Size in bytes of the object parts in the cache zone.",
+		metrics.TypeGauge, func(s types.CacheStats) uint64 { return s.Size().Bytes() }},
+	{"nedomi_cache_admitted_total", "Number of object parts admitted in the cache zone.",
+		metrics.TypeCounter, types.CacheStats.Admitted},
+	{"nedomi_cache_rejected_total", "Number of object parts rejected by the admission filter.",
+		metrics.TypeCounter, types.CacheStats.Rejected},
+}
+
+func writeCacheZoneMetrics(w *metrics.Writer, cacheZones map[string]*types.CacheZone) {
+	var ids = make([]string, 0, len(cacheZones))
+	for id := range cacheZones {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var stats = make([]types.CacheStats, len(ids))
+	for i, id := range ids {
+		stats[i] = cacheZones[id].Algorithm.Stats()
+	}
+
+	var labels = []string{"zone"}
+	for _, metric := range zoneMetrics {
+		w.Header(metric.name, metric.help, metric.typ)
+		for i, id := range ids {
+			w.Sample(metric.name, labels, []string{id}, float64(metric.value(stats[i])))
+		}
+	}
+}
+
+// New creates and returns a ready to use metrics Handler.
+func New(cfg *config.Handler, l *types.Location, next http.Handler) (*Handler, error) {
+	return &Handler{loc: l}, nil
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ironsmile/nedomi/cache/lru"
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/contexts"
+	"github.com/ironsmile/nedomi/mock"
+	"github.com/ironsmile/nedomi/types"
+)
+
+type mockApp struct {
+	types.App
+	stats types.AppStats
+}
+
+func (m *mockApp) Stats() types.AppStats {
+	return m.stats
+}
+
+func TestMetricsHandler(t *testing.T) {
+	t.Parallel()
+	cz := &config.CacheZone{
+		ID:             "zone1",
+		Path:           "/does/not/matter",
+		PartSize:       1024,
+		StorageObjects: 100,
+	}
+	algorithm := lru.New(cz, func(*types.ObjectIndex) error { return nil }, mock.NewLogger())
+	idx := &types.ObjectIndex{ObjID: types.NewObjectID("key", "/path"), Part: 0}
+	algorithm.Lookup(idx)
+	if err := algorithm.AddObject(idx, 512); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	algorithm.Lookup(idx)
+
+	ctx := contexts.NewAppContext(context.Background(), &mockApp{stats: types.AppStats{
+		Requests:         10,
+		Responded:        7,
+		NotConfigured:    1,
+		OpenConnections:  3,
+		OpenStreams:      5,
+		AccessLogDropped: 4,
+	}})
+	ctx = contexts.NewCacheZonesContext(ctx, map[string]*types.CacheZone{
+		"zone1": {ID: "zone1", Algorithm: algorithm},
+	})
+
+	loc := &types.Location{Logger: mock.NewLogger()}
+	handler, err := New(&config.Handler{}, loc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("GET", "http://example.com/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req.WithContext(ctx))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Unexpected response code %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != contentType {
+		t.Errorf("Unexpected content type %s", ct)
+	}
+	for _, expected := range []string{
+		"nedomi_requests_total 10\n",
+		"nedomi_requests_in_flight 2\n",
+		"nedomi_open_connections 3\n",
+		"nedomi_open_streams 5\n",
+		"nedomi_access_log_dropped_total 4\n",
+		`nedomi_cache_hits_total{zone="zone1"} 1` + "\n",
+		`nedomi_cache_misses_total{zone="zone1"} 1` + "\n",
+		`nedomi_cache_objects{zone="zone1"} 1` + "\n",
+		`nedomi_cache_bytes{zone="zone1"} 512` + "\n",
+		"# TYPE nedomi_cache_hits_total counter\n",
+	} {
+		if !strings.Contains(rec.Body.String(), expected) {
+			t.Errorf("Expected %q in the metrics:\n%s", expected, rec.Body.String())
+		}
+	}
+}
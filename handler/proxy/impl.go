@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/ironsmile/nedomi/contexts"
 	"github.com/ironsmile/nedomi/types"
@@ -53,7 +54,7 @@ func (c *runOnFirstRead) Read(bs []byte) (int, error) {
 	return c.Reader.Read(bs)
 }
 
-func (p *ReverseProxy) getOutRequest(reqID types.RequestID, rw http.ResponseWriter, req *http.Request, upstream types.Upstream) (*http.Request, error) {
+func (p *ReverseProxy) getOutRequest(reqID types.RequestID, rw http.ResponseWriter, req *http.Request, upstream types.Upstream, upAddr *types.UpstreamAddress) *http.Request {
 	outreq := new(http.Request)
 	*outreq = *req
 	url := *req.URL
@@ -69,11 +70,9 @@ func (p *ReverseProxy) getOutRequest(reqID types.RequestID, rw http.ResponseWrit
 	outreq.ProtoMinor = 1
 	outreq.Close = false
 
-	upAddr, err := upstream.GetAddress(p.Settings.UpstreamHashPrefix + req.URL.Path)
-	if err != nil {
-		return nil, fmt.Errorf("[%s] Proxy handler could not get an upstream address: %v", reqID, err)
-	}
 	p.Logger.Debugf("[%s] Using upstream %s (%s) to proxy request", reqID, upAddr, upAddr.OriginalURL)
+	info, _ := contexts.GetAccessInfo(req.Context())
+	info.AddUpstreamAddr(upAddr.Host)
 	outreq.URL.Scheme = upAddr.Scheme
 	outreq.URL.Host = upAddr.Host
 	outreq.URL.User = upAddr.User
@@ -117,17 +116,36 @@ func (p *ReverseProxy) getOutRequest(reqID types.RequestID, rw http.ResponseWrit
 		}
 	}
 
-	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
-		// If we aren't the first proxy retain prior
-		// X-Forwarded-For information as a comma+space
-		// separated list and fold multiple headers into one.
-		if prior, ok := outreq.Header["X-Forwarded-For"]; ok {
-			clientIP = strings.Join(prior, ", ") + ", " + clientIP
-		}
-		outreq.Header.Set("X-Forwarded-For", clientIP)
+	if forwardedFor := getForwardedFor(req, outreq.Header["X-Forwarded-For"]); forwardedFor != "" {
+		outreq.Header.Set("X-Forwarded-For", forwardedFor)
 	}
 
-	return outreq, nil
+	return outreq
+}
+
+// getForwardedFor returns the X-Forwarded-For value for the request - the
+// prior addresses followed by the address the request came from. When the
+// client address was taken from a header sent by a trusted proxy, the request
+// came from the proxy and the client is added before it if there are no prior
+// addresses.
+func getForwardedFor(req *http.Request, prior []string) string {
+	from, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return strings.Join(prior, ", ")
+	}
+	var addresses = prior
+	if peerAddr, ok := contexts.GetPeerAddr(req.Context()); ok {
+		if len(prior) == 0 {
+			addresses = []string{from}
+		}
+		if from, _, err = net.SplitHostPort(peerAddr); err != nil {
+			return strings.Join(addresses, ", ")
+		}
+	}
+	// If we aren't the first proxy retain prior
+	// X-Forwarded-For information as a comma+space
+	// separated list and fold multiple headers into one.
+	return strings.Join(append(addresses[:len(addresses):len(addresses)], from), ", ")
 }
 
 func (p *ReverseProxy) doRequestFor(
@@ -136,12 +154,52 @@ func (p *ReverseProxy) doRequestFor(
 	req *http.Request,
 	upstream types.Upstream,
 ) (*http.Response, error) {
-	outreq, err := p.getOutRequest(reqID, rw, req, upstream)
+	var path = p.Settings.UpstreamHashPrefix + req.URL.Path
+	upAddr, err := upstream.GetAddress(path)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("[%s] Proxy handler could not get an upstream address: %v", reqID, err)
+	}
+
+	upstream.Requested()
+	var tried []string
+	for retries := 0; ; retries++ {
+		res, err := upstream.Do(p.getOutRequest(reqID, rw, req, upstream, upAddr))
+		if err == nil || !isIdempotent(req) || req.Context().Err() != nil {
+			return res, err
+		}
+		tried = append(tried, upAddr.Host)
+		next, addrErr := upstream.GetAddressExcluding(path, tried)
+		if addrErr != nil {
+			return nil, err
+		}
+		delay, ok := upstream.Retry(err, retries)
+		if !ok {
+			return nil, err
+		}
+		p.Logger.Logf("[%s] Retrying the request to %s with %s in %s after: %v",
+			reqID, upAddr.Host, next.Host, delay, err)
+		info, _ := contexts.GetAccessInfo(req.Context())
+		info.AddUpstreamRetry()
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, err
+		}
+		upAddr = next
 	}
+}
 
-	return upstream.Do(outreq)
+// isIdempotent returns whether the request can be sent again after an error.
+// Only the requests without a body are retried as it is already read.
+func isIdempotent(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody {
+		return false
+	}
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
 }
 
 func (p *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
@@ -300,3 +300,106 @@ func TestSimpleRetryWithNilUpstream(t *testing.T) {
 		t.Errorf("Unexpected response %#v", resp2)
 	}
 }
+
+func newRetryingUpstream(t *testing.T, addresses ...string) types.Upstream {
+	var cfg = &config.Upstream{
+		ID:          "retrying",
+		Balancing:   "unweighted-roundrobin",
+		Settings:    config.GetDefaultUpstreamSettings(),
+		HealthCheck: config.GetDefaultUpstreamHealthCheck(),
+	}
+	cfg.Settings.ResolveAddresses = false
+	cfg.Settings.Retries, cfg.Settings.RetryBackoff = 2, 1
+	for _, address := range addresses {
+		u, err := url.Parse(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Addresses = append(cfg.Addresses, config.UpstreamAddress{URL: u, Weight: 1})
+	}
+	up, err := upstream.New(cfg, mock.NewLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return up
+}
+
+func TestRetriesOnConnectionErrors(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello world")
+	}))
+	defer ts.Close()
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close() // the connections to it are refused
+
+	for _, test := range []struct {
+		method    string
+		addresses []string
+		failed    int
+		retried   bool
+	}{
+		{"GET", []string{dead.URL, ts.URL}, 0, true},
+		{"HEAD", []string{ts.URL, dead.URL}, 0, true},
+		{"POST", []string{dead.URL, ts.URL}, 2, false},
+		{"GET", []string{dead.URL}, 4, false}, // no other address
+	} {
+		var up = newRetryingUpstream(t, test.addresses...)
+		proxy, err := New(&config.Handler{}, &types.Location{
+			Name:     "test",
+			Logger:   mock.NewLogger(),
+			Upstream: up,
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var failed int
+		var retries uint32
+		for i := 0; i < 4; i++ {
+			req, err := http.NewRequest(test.method, "http://www.somewhere.com/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var info = new(types.AccessInfo)
+			req = req.WithContext(contexts.NewAccessInfoContext(context.Background(), info))
+			resp := httptest.NewRecorder()
+			proxy.ServeHTTP(resp, req)
+			if resp.Code != 200 {
+				failed++
+			}
+			retries += info.UpstreamRetries()
+		}
+		if failed != test.failed || (retries > 0) != test.retried {
+			t.Errorf("expected %d failed requests and retried %t for %s to %v got %d and %d retries",
+				test.failed, test.retried, test.method, test.addresses, failed, retries)
+		}
+		up.Stop()
+	}
+}
+
+func TestGetForwardedFor(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		remoteAddr, peerAddr string
+		prior                []string
+		expected             string
+	}{
+		{remoteAddr: "1.2.3.4:80", expected: "1.2.3.4"},
+		{remoteAddr: "1.2.3.4:80", prior: []string{"5.6.7.8", "9.9.9.9"},
+			expected: "5.6.7.8, 9.9.9.9, 1.2.3.4"},
+		{remoteAddr: "1.2.3.4:80", peerAddr: "10.0.0.1:80", prior: []string{"5.6.7.8, 1.2.3.4"},
+			expected: "5.6.7.8, 1.2.3.4, 10.0.0.1"},
+		{remoteAddr: "1.2.3.4:80", peerAddr: "10.0.0.1:80",
+			expected: "1.2.3.4, 10.0.0.1"},
+		{remoteAddr: "not an address", prior: []string{"5.6.7.8"}, expected: "5.6.7.8"},
+	}
+	for _, test := range tests {
+		var req = &http.Request{RemoteAddr: test.remoteAddr}
+		if test.peerAddr != "" {
+			req = req.WithContext(contexts.NewPeerAddrContext(context.Background(), test.peerAddr))
+		}
+		if got := getForwardedFor(req, test.prior); got != test.expected {
+			t.Errorf("expected `%s` for %+v got `%s`", test.expected, test, got)
+		}
+	}
+}
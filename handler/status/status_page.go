@@ -80,33 +80,41 @@ func newStatistics(app types.App, cacheZones map[string]*types.CacheZone) statis
 			Objects:     stats.Objects(),
 			CacheHitPrc: stats.CacheHitPrc(),
 			Size:        stats.Size().Bytes(),
+			Admitted:    stats.Admitted(),
+			Rejected:    stats.Rejected(),
 		})
 	}
 
 	var appStats = app.Stats()
 	return statisticsRoot{
-		Requests:      appStats.Requests,
-		Responded:     appStats.Responded,
-		NotConfigured: appStats.NotConfigured,
-		InFlight:      appStats.Requests - appStats.Responded - appStats.NotConfigured,
-		CacheZones:    zones,
-		Started:       app.Started(),
-		Version:       versionFromAppVersion(app.Version()),
-		CGOCalls:      uint64(runtime.NumCgoCall()),
-		Goroutines:    uint64(runtime.NumGoroutine()),
+		Locations:        newLocationStats(app.Locations()),
+		Upstreams:        newUpstreamStats(app.Upstreams()),
+		Requests:         appStats.Requests,
+		Responded:        appStats.Responded,
+		NotConfigured:    appStats.NotConfigured,
+		InFlight:         appStats.Requests - appStats.Responded - appStats.NotConfigured,
+		AccessLogDropped: appStats.AccessLogDropped,
+		CacheZones:       zones,
+		Started:          app.Started(),
+		Version:          versionFromAppVersion(app.Version()),
+		CGOCalls:         uint64(runtime.NumCgoCall()),
+		Goroutines:       uint64(runtime.NumGoroutine()),
 	}
 }
 
 type statisticsRoot struct {
-	Requests      uint64    `json:"requests"`
-	Responded     uint64    `json:"responded"`
-	NotConfigured uint64    `json:"not_configured"`
-	InFlight      uint64    `json:"in_flight"`
-	Version       version   `json:"version"`
-	Started       time.Time `json:"started"`
-	CacheZones    zoneStats `json:"zones"`
-	CGOCalls      uint64    `json:"cgo_calls"`
-	Goroutines    uint64    `json:"goroutines"`
+	Requests         uint64         `json:"requests"`
+	Responded        uint64         `json:"responded"`
+	NotConfigured    uint64         `json:"not_configured"`
+	InFlight         uint64         `json:"in_flight"`
+	AccessLogDropped uint64         `json:"access_log_dropped"`
+	Version          version        `json:"version"`
+	Started          time.Time      `json:"started"`
+	CacheZones       zoneStats      `json:"zones"`
+	Locations        []locationStat `json:"locations"`
+	Upstreams        []upstreamStat `json:"upstreams"`
+	CGOCalls         uint64         `json:"cgo_calls"`
+	Goroutines       uint64         `json:"goroutines"`
 }
 
 type version struct {
@@ -134,6 +142,89 @@ type zoneStat struct {
 	Objects     uint64 `json:"objects"`
 	CacheHitPrc string `json:"hit_percentage"`
 	Size        uint64 `json:"size"`
+	Admitted    uint64 `json:"admitted"`
+	Rejected    uint64 `json:"rejected"`
+}
+
+type locationStat struct {
+	VirtualHost   string `json:"vhost"`
+	Name          string `json:"name"`
+	Requests      uint64 `json:"requests"`
+	Bytes         uint64 `json:"bytes"`
+	CacheBytes    uint64 `json:"cache_bytes"`
+	UpstreamBytes uint64 `json:"upstream_bytes"`
+	CacheHitPrc   string `json:"hit_percentage"`
+	Status1xx     uint64 `json:"status_1xx"`
+	Status2xx     uint64 `json:"status_2xx"`
+	Status3xx     uint64 `json:"status_3xx"`
+	Status4xx     uint64 `json:"status_4xx"`
+	Status5xx     uint64 `json:"status_5xx"`
+}
+
+// newLocationStats returns the stats of the locations sorted by virtual host
+// and in their configuration order inside each virtual host.
+func newLocationStats(vhosts map[string][]*types.Location) []locationStat {
+	var names = make([]string, 0, len(vhosts))
+	for name := range vhosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result = make([]locationStat, 0, len(vhosts))
+	for _, name := range names {
+		for _, location := range vhosts[name] {
+			var stats = location.Stats
+			result = append(result, locationStat{
+				VirtualHost:   name,
+				Name:          location.Name,
+				Requests:      stats.Requests(),
+				Bytes:         stats.Bytes(),
+				CacheBytes:    stats.CacheBytes(),
+				UpstreamBytes: stats.UpstreamBytes(),
+				CacheHitPrc:   stats.CacheHitPrc(),
+				Status1xx:     stats.StatusClass(1),
+				Status2xx:     stats.StatusClass(2),
+				Status3xx:     stats.StatusClass(3),
+				Status4xx:     stats.StatusClass(4),
+				Status5xx:     stats.StatusClass(5),
+			})
+		}
+	}
+	return result
+}
+
+type upstreamStat struct {
+	ID        string    `json:"id"`
+	Address   string    `json:"address"`
+	Healthy   bool      `json:"healthy"`
+	Fails     uint32    `json:"fails"`
+	Changed   time.Time `json:"changed"`
+	LastError string    `json:"last_error"`
+}
+
+// newUpstreamStats returns the health of the addresses of the upstreams
+// sorted by upstream id.
+func newUpstreamStats(upstreams map[string]types.Upstream) []upstreamStat {
+	var ids = make([]string, 0, len(upstreams))
+	for id := range upstreams {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var result = make([]upstreamStat, 0, len(upstreams))
+	for _, id := range ids {
+		for _, health := range upstreams[id].Health() {
+			result = append(result, upstreamStat{
+				ID:        id,
+				Address:   health.Address,
+				Healthy:   health.Healthy,
+				Fails:     health.Fails,
+				Changed:   health.Changed,
+				LastError: health.LastError,
+			})
+		}
+	}
+	return result
 }
 
 // New creates and returns a ready to used ServerStatusHandler.
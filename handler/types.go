@@ -13,6 +13,8 @@ import (
 	"github.com/ironsmile/nedomi/handler/dir"
 	"github.com/ironsmile/nedomi/handler/flv"
 	"github.com/ironsmile/nedomi/handler/headers"
+	"github.com/ironsmile/nedomi/handler/loglevel"
+	"github.com/ironsmile/nedomi/handler/metrics"
 	"github.com/ironsmile/nedomi/handler/mp4"
 	"github.com/ironsmile/nedomi/handler/pprof"
 	"github.com/ironsmile/nedomi/handler/proxy"
@@ -40,6 +42,14 @@ var handlerTypes = map[string]newHandlerFunc{
 		return headers.New(cfg, l, next)
 	},
 
+	"loglevel": func(cfg *config.Handler, l *types.Location, next http.Handler) (http.Handler, error) {
+		return loglevel.New(cfg, l, next)
+	},
+
+	"metrics": func(cfg *config.Handler, l *types.Location, next http.Handler) (http.Handler, error) {
+		return metrics.New(cfg, l, next)
+	},
+
 	"mp4": func(cfg *config.Handler, l *types.Location, next http.Handler) (http.Handler, error) {
 		return mp4.New(cfg, l, next)
 	},
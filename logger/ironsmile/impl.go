@@ -3,57 +3,84 @@ package ironsmile
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 
 	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/utils"
+	"github.com/ironsmile/nedomi/utils/logfile"
 
 	"github.com/ironsmile/logger"
 )
 
-const (
-	logFileFlags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
-	logFilePerms = 0660
-)
+const logFilePerms = 0660
+
+// Logger is an ironsmile logger which closes its files when it is closed.
+type Logger struct {
+	*logger.Logger
+	files []*logfile.File
+}
+
+// Close closes the files of the logger.
+func (l *Logger) Close() error {
+	var errs = new(utils.CompositeError)
+	for _, f := range l.files {
+		errs.AppendError(f.Close())
+	}
+	l.files = nil
+	if errs.Empty() {
+		return nil
+	}
+	return errs
+}
 
 // New returns configured ironsmile™ logger that is ready to use.
 // Configuration:
 // 	error	a path to a file to log calls to Errorf?
 // 	log	a path to a file to log calls to Logf?
 // 	debug	a path to a file to log calls to Debugf?
+// 	rotation	built-in rotation settings for all of the files
 //
 // If debug is set but log not, debug's file will be used for log.
 // If log is set(either through the configuration or copied from  debug),
 // but error is not, error will be set to log's file.
-// The files are appended to if existing, not truncated.
-func New(cfg *config.Logger) (*logger.Logger, error) {
+// The files are appended to if existing, not truncated and they are closed
+// when the logger is closed.
+func New(cfg *config.Logger) (_ *Logger, err error) {
 	if len(cfg.Settings) < 1 {
 		return nil, fmt.Errorf("logger 'settings' key is missing")
 	}
 
 	l := logger.New()
+	var files []*logfile.File
+	defer func() {
+		if err != nil {
+			_ = (&Logger{files: files}).Close()
+		}
+	}()
 	var s settings
-	err := json.Unmarshal(cfg.Settings, &s)
+	err = json.Unmarshal(cfg.Settings, &s)
 	if err != nil {
 		return nil, fmt.Errorf("error while parsing logger settings: %s", err)
 	}
 
-	var errorOutput, debugOutput, logOutput *os.File
+	var errorOutput, debugOutput, logOutput *logfile.File
 
 	if s.DebugFile != "" {
-		debugOutput, err = os.OpenFile(s.DebugFile, logFileFlags, logFilePerms)
+		debugOutput, err = logfile.Open(s.DebugFile, logFilePerms, s.Rotation)
 		if err != nil {
 			return nil, fmt.Errorf("error while opening file [%s] for debug output: %s",
 				s.DebugFile, err)
 		}
+		files = append(files, debugOutput)
 		l.SetDebugOutput(debugOutput)
 	}
 
 	if s.LogFile != "" {
-		logOutput, err = os.OpenFile(s.LogFile, logFileFlags, logFilePerms)
+		logOutput, err = logfile.Open(s.LogFile, logFilePerms, s.Rotation)
 		if err != nil {
 			return nil, fmt.Errorf("error while opening file [%s] for log output: %s",
 				s.LogFile, err)
 		}
+		files = append(files, logOutput)
 	} else if debugOutput != nil {
 		logOutput = debugOutput
 	}
@@ -62,11 +89,12 @@ func New(cfg *config.Logger) (*logger.Logger, error) {
 		l.SetLogOutput(logOutput)
 	}
 	if s.ErrorFile != "" {
-		errorOutput, err = os.OpenFile(s.ErrorFile, logFileFlags, logFilePerms)
+		errorOutput, err = logfile.Open(s.ErrorFile, logFilePerms, s.Rotation)
 		if err != nil {
 			return nil, fmt.Errorf("Error while opening file [%s] for error output: %s",
 				s.ErrorFile, err)
 		}
+		files = append(files, errorOutput)
 	} else if logOutput != nil {
 		errorOutput = logOutput
 	}
@@ -84,11 +112,13 @@ func New(cfg *config.Logger) (*logger.Logger, error) {
 		return nil, fmt.Errorf("ironsmile logger needs at least one file to log to")
 	}
 
-	return l, nil
+	return &Logger{Logger: l, files: files}, nil
 }
 
 type settings struct {
 	LogFile   string `json:"log"`
 	ErrorFile string `json:"error"`
 	DebugFile string `json:"debug"`
+
+	Rotation config.LogRotation `json:"rotation"`
 }
@@ -0,0 +1,131 @@
+// Package jsonlog contains a logger which writes its messages as JSON objects,
+// one per line.
+package jsonlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/utils/logfile"
+	"github.com/ironsmile/nedomi/utils/logrecord"
+)
+
+const (
+	logFilePerms = 0660
+	timeFormat   = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+type settings struct {
+	Level   string `json:"level"`
+	File    string `json:"file"`
+	Network string `json:"network"`
+	Address string `json:"address"`
+
+	Rotation config.LogRotation `json:"rotation"`
+}
+
+// New returns a logger which writes every message as a JSON object on a
+// separate line with the fields time, level and msg followed by the fields
+// attached to the logger like request_id and location.
+// Configuration:
+//
+//	level	the highest logged level - 'no_log', 'fatal', 'error', 'info' or 'debug'
+//	file	a path to a file to which the lines are appended
+//	rotation	built-in rotation settings for the file
+//	network	'tcp' or 'unix' for sending the lines to a remote collector
+//	address	the address of the remote collector
+//
+// Either a file or an address can be set. The lines are written to the
+// standard error when neither is. Closing the logger closes the file or the
+// connection.
+func New(cfg *config.Logger) (*logrecord.Logger, error) {
+	var s settings
+	if len(cfg.Settings) > 0 {
+		if err := json.Unmarshal(cfg.Settings, &s); err != nil {
+			return nil, fmt.Errorf("error on parsing settings for 'jsonlog' logger: %s", err)
+		}
+	}
+	level, err := logrecord.ParseLevel(s.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		w      = &writer{w: os.Stderr}
+		closer io.Closer
+	)
+	switch {
+	case s.File != "" && s.Address != "":
+		return nil, fmt.Errorf("the 'jsonlog' logger can have a file or an address but not both")
+	case s.File != "":
+		file, err := logfile.Open(s.File, logFilePerms, s.Rotation)
+		if err != nil {
+			return nil, fmt.Errorf("error while opening file [%s] for the 'jsonlog' logger: %s",
+				s.File, err)
+		}
+		w.w, closer = file, file
+	case s.Address != "":
+		if s.Network == "" {
+			s.Network = "tcp"
+		}
+		if s.Network != "tcp" && s.Network != "unix" {
+			return nil, fmt.Errorf("unsupported network '%s' for the 'jsonlog' logger", s.Network)
+		}
+		var conn = logrecord.NewConn(s.Network, s.Address)
+		w.w, closer = conn, conn
+	}
+	return logrecord.NewLogger(level, w.emit, closer), nil
+}
+
+var bufPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+type writer struct {
+	w io.Writer
+}
+
+func (w *writer) emit(r *logrecord.Record) {
+	var buf = bufPool.Get().(*bytes.Buffer)
+	defer bufPool.Put(buf)
+	buf.Reset()
+	var enc = json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+
+	// the fields are written in order so the object is put together by hand
+	buf.WriteString(`{"time":"`)
+	buf.WriteString(r.Time.Format(timeFormat))
+	buf.WriteString(`","level":"`)
+	buf.WriteString(r.Level.String())
+	buf.WriteString(`","msg":`)
+	encodeValue(buf, enc, r.Message)
+	for _, field := range r.Fields {
+		buf.WriteByte(',')
+		encodeValue(buf, enc, field.Key)
+		buf.WriteByte(':')
+		encodeValue(buf, enc, field.Value)
+	}
+	buf.WriteString("}\n")
+	if _, err := w.w.Write(buf.Bytes()); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing log message - %s\n", err)
+	}
+}
+
+// encodeValue writes the value in buf, which is the buffer of enc, without
+// the new line which the encoder adds after it. Numbers and booleans are
+// written as they are and everything else as a string.
+func encodeValue(buf *bytes.Buffer, enc *json.Encoder, value interface{}) {
+	switch value.(type) {
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+	default:
+		value = logrecord.FieldString(value)
+	}
+	if err := enc.Encode(value); err != nil { // only NaN and infinities
+		_ = enc.Encode(logrecord.FieldString(value))
+	}
+	buf.Truncate(buf.Len() - 1)
+}
@@ -0,0 +1,75 @@
+package jsonlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/testutils"
+)
+
+func TestJSONLinesToFile(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+	var path = filepath.Join(dir, "nedomi.log")
+
+	l, err := New(config.NewLogger("jsonlog", []byte(fmt.Sprintf(
+		`{"level": "debug", "file": %q}`, path))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Debugf("[%s] <debug> & more", "reqid")
+	l.With(types.LogField{Key: types.LogFieldLocation, Value: "example.com"},
+		types.LogField{Key: "attempt", Value: 2}).Error("failed", 2)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []map[string]interface{}
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Invalid line %q - %s", scanner.Text(), err)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, record["time"].(string)); err != nil {
+			t.Errorf("Invalid time in %q - %s", scanner.Text(), err)
+		}
+		delete(record, "time")
+		records = append(records, record)
+	}
+
+	var expected = []map[string]interface{}{
+		{"level": "debug", "msg": "<debug> & more", "request_id": "reqid"},
+		{"level": "error", "msg": "failed 2", "location": "example.com", "attempt": 2.0},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records but got %v", len(expected), records)
+	}
+	for i := range expected {
+		if fmt.Sprint(records[i]) != fmt.Sprint(expected[i]) {
+			t.Errorf("Expected record %v but got %v", expected[i], records[i])
+		}
+	}
+}
+
+func TestJSONSettingsErrors(t *testing.T) {
+	t.Parallel()
+	for _, settings := range []string{
+		`{"level": "verbose"}`,
+		`{"file": "/tmp/file.log", "address": "localhost:514"}`,
+		`{"network": "udp", "address": "localhost:514"}`,
+	} {
+		if _, err := New(config.NewLogger("jsonlog", []byte(settings))); err == nil {
+			t.Errorf("Expected an error for the settings %s", settings)
+		}
+	}
+}
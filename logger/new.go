@@ -5,6 +5,7 @@ package logger
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/ironsmile/nedomi/config"
 	"github.com/ironsmile/nedomi/types"
@@ -24,3 +25,24 @@ func New(cfg *config.Logger) (types.Logger, error) {
 
 	return loggerFunc(cfg)
 }
+
+// NewForLocation returns a new Logger as New does. If the logger type is
+// structured the name of the location is attached to all of its messages.
+func NewForLocation(cfg *config.Logger, location string) (types.Logger, error) {
+	l, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if sl, ok := l.(types.StructuredLogger); ok {
+		return sl.With(types.LogField{Key: types.LogFieldLocation, Value: location}), nil
+	}
+	return l, nil
+}
+
+// Close closes the files or the connections of the logger if it has any.
+func Close(l types.Logger) error {
+	if c, ok := l.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
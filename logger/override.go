@@ -0,0 +1,274 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/logrecord"
+)
+
+// Overridable is the logger of a location which can be temporarily replaced
+// by a logger of the same type and settings but with a different level.
+type Overridable struct {
+	cfg      config.Logger
+	location string
+	base     types.Logger
+
+	mutex    sync.RWMutex
+	override types.Logger
+	level    string
+	until    time.Time
+	timer    *time.Timer
+}
+
+// NewOverridable returns a new logger for the location as NewForLocation
+// does which level can be overridden.
+func NewOverridable(cfg *config.Logger, location string) (*Overridable, error) {
+	base, err := NewForLocation(cfg, location)
+	if err != nil {
+		return nil, err
+	}
+	return &Overridable{cfg: *cfg, location: location, base: base}, nil
+}
+
+// Override replaces the logger with one with the level for the duration. A
+// previous override is replaced and closed. The messages logged through o
+// and the loggers returned by its With method never use a closed override.
+func (o *Overridable) Override(level string, duration time.Duration) error {
+	cfg, err := withLevel(&o.cfg, level)
+	if err != nil {
+		return err
+	}
+	l, err := NewForLocation(cfg, o.location)
+	if err != nil {
+		return err
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+	o.closeOverride()
+	o.override, o.level, o.until = l, level, time.Now().Add(duration)
+	var timer *time.Timer
+	timer = time.AfterFunc(duration, func() {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		if o.timer == timer { // not replaced in the meantime
+			o.reset()
+		}
+	})
+	o.timer = timer
+	return nil
+}
+
+// Reset reverts the logger to its configured level and closes the override.
+func (o *Overridable) Reset() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+	o.reset()
+}
+
+func (o *Overridable) reset() {
+	o.closeOverride()
+	o.override, o.level, o.until, o.timer = nil, "", time.Time{}, nil
+}
+
+// closeOverride closes the files or the connection of the current override.
+// It must be called with the mutex held.
+func (o *Overridable) closeOverride() {
+	if o.override == nil {
+		return
+	}
+	if err := Close(o.override); err != nil {
+		o.base.Errorf("error closing the overriding logger - %s", err)
+	}
+}
+
+// Close reverts the logger to its configured level and closes it.
+func (o *Overridable) Close() error {
+	o.Reset()
+	return Close(o.base)
+}
+
+// Overridden returns the level of the current override and when it ends. ok
+// is false if the logger is not overridden.
+func (o *Overridable) Overridden() (level string, until time.Time, ok bool) {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+	return o.level, o.until, o.override != nil
+}
+
+// Current returns the logger currently in use. It may be closed by a later
+// override or reset, use the methods of o to log with it instead.
+func (o *Overridable) Current() types.Logger {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+	return o.current()
+}
+
+func (o *Overridable) current() types.Logger {
+	if o.override != nil {
+		return o.override
+	}
+	return o.base
+}
+
+// use calls f with the current logger. The logger is not closed before f
+// returns.
+func (o *Overridable) use(f func(types.Logger)) {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+	f(o.current())
+}
+
+// With returns a logger with the fields which logs with the current logger
+// of o at the time of each message. It is used for the whole request so the
+// later overrides apply to the requests in progress too and they never log
+// with an override which is already closed.
+func (o *Overridable) With(fields ...types.LogField) types.StructuredLogger {
+	return &overridableWith{o: o, fields: fields}
+}
+
+// Log logs with the current logger.
+func (o *Overridable) Log(args ...interface{}) {
+	o.use(func(l types.Logger) { l.Log(args...) })
+}
+
+// Logf logs with the current logger.
+func (o *Overridable) Logf(format string, args ...interface{}) {
+	o.use(func(l types.Logger) { l.Logf(format, args...) })
+}
+
+// Debug logs with the current logger.
+func (o *Overridable) Debug(args ...interface{}) {
+	o.use(func(l types.Logger) { l.Debug(args...) })
+}
+
+// Debugf logs with the current logger.
+func (o *Overridable) Debugf(format string, args ...interface{}) {
+	o.use(func(l types.Logger) { l.Debugf(format, args...) })
+}
+
+// Error logs with the current logger.
+func (o *Overridable) Error(args ...interface{}) {
+	o.use(func(l types.Logger) { l.Error(args...) })
+}
+
+// Errorf logs with the current logger.
+func (o *Overridable) Errorf(format string, args ...interface{}) {
+	o.use(func(l types.Logger) { l.Errorf(format, args...) })
+}
+
+// Fatal logs with the current logger.
+func (o *Overridable) Fatal(args ...interface{}) {
+	o.use(func(l types.Logger) { l.Fatal(args...) })
+}
+
+// Fatalf logs with the current logger.
+func (o *Overridable) Fatalf(format string, args ...interface{}) {
+	o.use(func(l types.Logger) { l.Fatalf(format, args...) })
+}
+
+// overridableWith is the logger with fields returned by Overridable.With.
+type overridableWith struct {
+	o      *Overridable
+	fields []types.LogField
+
+	mutex  sync.Mutex
+	parent types.Logger           // the logger of o for which child was made
+	child  types.StructuredLogger // parent with the fields
+}
+
+func (w *overridableWith) With(fields ...types.LogField) types.StructuredLogger {
+	return &overridableWith{o: w.o, fields: logrecord.MergeFields(w.fields, fields...)}
+}
+
+// use calls f with the current logger of o with the fields. The child logger
+// is made again only after the current logger changes.
+func (w *overridableWith) use(f func(types.StructuredLogger)) {
+	w.o.use(func(l types.Logger) {
+		w.mutex.Lock()
+		if w.parent != l {
+			w.parent, w.child = l, Structured(l).With(w.fields...)
+		}
+		var child = w.child
+		w.mutex.Unlock()
+		f(child)
+	})
+}
+
+func (w *overridableWith) Log(args ...interface{}) {
+	w.use(func(l types.StructuredLogger) { l.Log(args...) })
+}
+
+func (w *overridableWith) Logf(format string, args ...interface{}) {
+	w.use(func(l types.StructuredLogger) { l.Logf(format, args...) })
+}
+
+func (w *overridableWith) Debug(args ...interface{}) {
+	w.use(func(l types.StructuredLogger) { l.Debug(args...) })
+}
+
+func (w *overridableWith) Debugf(format string, args ...interface{}) {
+	w.use(func(l types.StructuredLogger) { l.Debugf(format, args...) })
+}
+
+func (w *overridableWith) Error(args ...interface{}) {
+	w.use(func(l types.StructuredLogger) { l.Error(args...) })
+}
+
+func (w *overridableWith) Errorf(format string, args ...interface{}) {
+	w.use(func(l types.StructuredLogger) { l.Errorf(format, args...) })
+}
+
+func (w *overridableWith) Fatal(args ...interface{}) {
+	w.use(func(l types.StructuredLogger) { l.Fatal(args...) })
+}
+
+func (w *overridableWith) Fatalf(format string, args ...interface{}) {
+	w.use(func(l types.StructuredLogger) { l.Fatalf(format, args...) })
+}
+
+// withLevel returns a copy of the logger configuration with the level. The
+// ironsmile logger has no level setting and can only be made to log debug
+// messages in its log file.
+func withLevel(cfg *config.Logger, level string) (*config.Logger, error) {
+	if _, err := logrecord.ParseLevel(level); err != nil || level == "" {
+		return nil, fmt.Errorf("unsupported log level '%s'", level)
+	}
+	var settings = make(map[string]interface{})
+	if len(cfg.Settings) > 0 {
+		if err := json.Unmarshal(cfg.Settings, &settings); err != nil {
+			return nil, fmt.Errorf("error while parsing logger settings: %s", err)
+		}
+	}
+	switch cfg.Type {
+	case "nillogger":
+		return nil, fmt.Errorf("the level of the 'nillogger' logger can not be changed")
+	case "ironsmile":
+		if level != "debug" {
+			return nil, fmt.Errorf("the 'ironsmile' logger can only be overridden with 'debug'")
+		}
+		if settings["debug"] == nil {
+			if settings["debug"] = settings["log"]; settings["debug"] == nil {
+				settings["debug"] = settings["error"]
+			}
+		}
+	default:
+		settings["level"] = level
+	}
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	return config.NewLogger(cfg.Type, b), nil
+}
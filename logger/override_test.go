@@ -0,0 +1,183 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/testutils"
+)
+
+func TestOverridable(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+	var path = filepath.Join(dir, "nedomi.log")
+	var cfg = config.NewLogger("jsonlog", []byte(fmt.Sprintf(`{"level": "error", "file": %q}`, path)))
+
+	o, err := NewOverridable(cfg, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Debug("before")
+	if err := o.Override("debug", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if level, until, ok := o.Overridden(); !ok || level != "debug" || until.Before(time.Now()) {
+		t.Errorf("Unexpected override %s until %s, %t", level, until, ok)
+	}
+	o.Debug("during")
+	o.With().Debug("child")
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, _, ok := o.Overridden(); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("The override was not reverted")
+		}
+	}
+	o.Debug("after")
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log = string(b)
+	if strings.Count(log, "\n") != 2 || !strings.Contains(log, `"msg":"during"`) ||
+		!strings.Contains(log, `"msg":"child"`) || !strings.Contains(log, `"location":"example.com"`) {
+		t.Errorf("Unexpected log:\n%s", log)
+	}
+}
+
+func TestOverridableWithFollowsOverrides(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+	var path = filepath.Join(dir, "nedomi.log")
+	var cfg = config.NewLogger("jsonlog", []byte(fmt.Sprintf(`{"level": "error", "file": %q}`, path)))
+
+	o, err := NewOverridable(cfg, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	// a request which started before the override and ends after it
+	var request = o.With(types.LogField{Key: "request", Value: 1})
+	request.Debug("before")
+	if err := o.Override("debug", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	request.Debug("during")
+	request.With(types.LogField{Key: "child", Value: true}).Debug("child")
+	o.Reset()
+	request.Debug("after")
+	request.Error("error")
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines = strings.Split(strings.TrimSpace(string(b)), "\n")
+	var expected = []string{`"msg":"during"`, `"msg":"child"`, `"msg":"error"`}
+	if len(lines) != len(expected) {
+		t.Fatalf("Unexpected log:\n%s", b)
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, expected[i]) || !strings.Contains(line, `"request":1`) {
+			t.Errorf("Expected %s with the request field but got %s", expected[i], line)
+		}
+	}
+	if !strings.Contains(lines[1], `"child":true`) {
+		t.Errorf("Expected the field of the child logger in %s", lines[1])
+	}
+}
+
+func TestOverridableReset(t *testing.T) {
+	t.Parallel()
+	o, err := NewOverridable(config.NewLogger("std", []byte(`{"level": "info"}`)), "loc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var base = o.Current()
+	if err := o.Override("debug", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if o.Current() == base {
+		t.Error("The logger was not overridden")
+	}
+	o.Reset()
+	if _, _, ok := o.Overridden(); ok || o.Current() != base {
+		t.Error("The logger was not reset")
+	}
+
+	for _, level := range []string{"", "verbose"} {
+		if err := o.Override(level, time.Hour); err == nil {
+			t.Errorf("Expected an error for level %q", level)
+		}
+	}
+	nillogger, err := NewOverridable(config.NewLogger("nillogger", nil), "loc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nillogger.Override("debug", time.Hour); err == nil {
+		t.Error("Expected an error for overriding the nillogger")
+	}
+}
+
+func TestOverridableClosesOverride(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+	var path = filepath.Join(dir, "log.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var cfg = config.NewLogger("jsonlog", []byte(fmt.Sprintf(
+		`{"level": "error", "network": "unix", "address": %q}`, path)))
+	o, err := NewOverridable(cfg, "loc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	// only the overriding loggers log and connect
+	var overrideAndLog = func(message string, duration time.Duration) net.Conn {
+		if err := o.Override("debug", duration); err != nil {
+			t.Fatal(err)
+		}
+		o.Debug(message)
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	var expectClosed = func(conn net.Conn, message string) {
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		b, err := ioutil.ReadAll(conn)
+		if err != nil && err != io.EOF {
+			t.Errorf("Expected the connection of %s to be closed but got %s", message, err)
+		}
+		if !strings.Contains(string(b), `"msg":"`+message+`"`) {
+			t.Errorf("Unexpected log %q", b)
+		}
+	}
+
+	var replaced = overrideAndLog("replaced", time.Hour)
+	var reset = overrideAndLog("reset", time.Hour)
+	expectClosed(replaced, "replaced")
+	o.Reset()
+	expectClosed(reset, "reset")
+	expectClosed(overrideAndLog("expired", 50*time.Millisecond), "expired")
+}
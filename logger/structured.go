@@ -0,0 +1,98 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ironsmile/nedomi/contexts"
+	"github.com/ironsmile/nedomi/logger/nillogger"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/logrecord"
+)
+
+// Structured returns l if it is a structured logger or an adapter which
+// writes the fields in the messages of l otherwise. The request ID is written
+// before the message as "[request-id] " and the rest of the fields after it
+// as key=value pairs.
+func Structured(l types.Logger) types.StructuredLogger {
+	if sl, ok := l.(types.StructuredLogger); ok {
+		return sl
+	}
+	if l == nil {
+		l = &nillogger.Nil{}
+	}
+	return &adapter{Logger: l}
+}
+
+// FromContext returns the logger for the request from its context. If there
+// is none in it fallback is used with the request ID from the context.
+func FromContext(ctx context.Context, fallback types.Logger) types.StructuredLogger {
+	if l, ok := contexts.GetLogger(ctx); ok {
+		return l
+	}
+	var l = Structured(fallback)
+	if reqID, ok := contexts.GetRequestID(ctx); ok {
+		return l.With(types.LogField{Key: types.LogFieldRequestID, Value: reqID})
+	}
+	return l
+}
+
+// adapter is a types.StructuredLogger which formats its fields in the
+// messages of a types.Logger.
+type adapter struct {
+	types.Logger
+	fields         []types.LogField
+	prefix, suffix string
+}
+
+func (a *adapter) With(fields ...types.LogField) types.StructuredLogger {
+	var result = &adapter{Logger: a.Logger, fields: logrecord.MergeFields(a.fields, fields...)}
+	var rest = make([]types.LogField, 0, len(result.fields))
+	for _, field := range result.fields {
+		if field.Key == types.LogFieldRequestID {
+			result.prefix = "[" + logrecord.FieldString(field.Value) + "] "
+		} else {
+			rest = append(rest, field)
+		}
+	}
+	if len(rest) > 0 {
+		result.suffix = string(logrecord.AppendFields([]byte{' '}, rest))
+	}
+	return result
+}
+
+func (a *adapter) format(message string) string {
+	return a.prefix + message + a.suffix
+}
+
+func (a *adapter) Log(args ...interface{}) {
+	a.Logger.Log(a.format(logrecord.Sprintln(args...)))
+}
+
+func (a *adapter) Logf(format string, args ...interface{}) {
+	a.Logger.Log(a.format(fmt.Sprintf(format, args...)))
+}
+
+func (a *adapter) Debug(args ...interface{}) {
+	a.Logger.Debug(a.format(logrecord.Sprintln(args...)))
+}
+
+func (a *adapter) Debugf(format string, args ...interface{}) {
+	a.Logger.Debug(a.format(fmt.Sprintf(format, args...)))
+}
+
+func (a *adapter) Error(args ...interface{}) {
+	a.Logger.Error(a.format(logrecord.Sprintln(args...)))
+}
+
+func (a *adapter) Errorf(format string, args ...interface{}) {
+	a.Logger.Error(a.format(fmt.Sprintf(format, args...)))
+}
+
+func (a *adapter) Fatal(args ...interface{}) {
+	a.Logger.Fatal(a.format(logrecord.Sprintln(args...)))
+}
+
+func (a *adapter) Fatalf(format string, args ...interface{}) {
+	a.Logger.Fatal(a.format(fmt.Sprintf(format, args...)))
+}
@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ironsmile/nedomi/contexts"
+	"github.com/ironsmile/nedomi/mock"
+	"github.com/ironsmile/nedomi/types"
+)
+
+func TestStructuredAdapter(t *testing.T) {
+	t.Parallel()
+	var ml = mock.NewLogger()
+	var l = Structured(ml).With(
+		types.LogField{Key: types.LogFieldLocation, Value: "example.com"},
+		types.LogField{Key: types.LogFieldRequestID, Value: types.RequestID("reqid")},
+	)
+	l.Logf("served %d", 5)
+	l.With(types.LogField{Key: types.LogFieldClientAddr, Value: "127.0.0.1"},
+		types.LogField{Key: types.LogFieldLocation, Value: "other location"}).Error("failed")
+	Structured(ml).Debug("plain")
+
+	var expected = []string{
+		mock.LogPrefix + "[reqid] served 5 location=example.com",
+		mock.ErrorPrefix + `[reqid] failed client_addr=127.0.0.1 location="other location"`,
+		mock.DebugPrefix + "plain",
+	}
+	if logged := ml.Logged(); !reflect.DeepEqual(logged, expected) {
+		t.Errorf("Expected %q but got %q", expected, logged)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	t.Parallel()
+	var ml = mock.NewLogger()
+	var ctx = contexts.NewIDContext(context.Background(), types.RequestID("reqid"))
+	FromContext(ctx, ml).Log("fallback")
+
+	var requestLogger = Structured(ml).With(types.LogField{Key: "from", Value: "context"})
+	FromContext(contexts.NewLoggerContext(ctx, requestLogger), nil).Log("request")
+
+	FromContext(context.Background(), nil).Log("nowhere")
+
+	var expected = []string{
+		mock.LogPrefix + "[reqid] fallback",
+		mock.LogPrefix + "request from=context",
+	}
+	if logged := ml.Logged(); !reflect.DeepEqual(logged, expected) {
+		t.Errorf("Expected %q but got %q", expected, logged)
+	}
+}
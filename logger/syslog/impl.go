@@ -0,0 +1,172 @@
+// Package syslog contains a logger which sends its messages to a syslog
+// server in the RFC 5424 format.
+package syslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/utils/logrecord"
+)
+
+const (
+	defaultNetwork  = "unixgram"
+	defaultAddress  = "/dev/log"
+	defaultFacility = "daemon"
+	defaultAppName  = "nedomi"
+	timeFormat      = "2006-01-02T15:04:05.000000Z07:00"
+
+	// the structured data ID with the example private enterprise number from
+	// https://tools.ietf.org/html/rfc5424#section-7.2.2
+	sdID         = "nedomi@32473"
+	maxSDNameLen = 32
+)
+
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// The syslog severities of the log levels
+var severities = map[logrecord.Level]int{
+	logrecord.Fatal: 2, // critical
+	logrecord.Error: 3,
+	logrecord.Info:  6,
+	logrecord.Debug: 7,
+}
+
+type settings struct {
+	Level    string `json:"level"`
+	Network  string `json:"network"`
+	Address  string `json:"address"`
+	Facility string `json:"facility"`
+	AppName  string `json:"app_name"`
+}
+
+// New returns a logger which sends RFC 5424 messages to a syslog server.
+// Configuration:
+//
+//	level	the highest logged level - 'no_log', 'fatal', 'error', 'info' or 'debug'
+//	network	'udp', 'tcp', 'unix' or 'unixgram', the default is 'unixgram'
+//	address	the address of the server, the default is /dev/log
+//	facility	the syslog facility name, the default is 'daemon'
+//	app_name	the APP-NAME of the messages, the default is 'nedomi'
+//
+// The messages sent over stream networks are framed with octet counting as
+// described in RFC 6587. Closing the logger closes its connection.
+func New(cfg *config.Logger) (*logrecord.Logger, error) {
+	var s settings
+	if len(cfg.Settings) > 0 {
+		if err := json.Unmarshal(cfg.Settings, &s); err != nil {
+			return nil, fmt.Errorf("error on parsing settings for 'syslog' logger: %s", err)
+		}
+	}
+	level, err := logrecord.ParseLevel(s.Level)
+	if err != nil {
+		return nil, err
+	}
+	if s.Network == "" && s.Address == "" {
+		s.Network, s.Address = defaultNetwork, defaultAddress
+	}
+	switch s.Network {
+	case "udp", "tcp", "unix", "unixgram":
+	default:
+		return nil, fmt.Errorf("unsupported network '%s' for the 'syslog' logger", s.Network)
+	}
+	if s.Address == "" {
+		return nil, fmt.Errorf("no address for the 'syslog' logger")
+	}
+	if s.Facility == "" {
+		s.Facility = defaultFacility
+	}
+	facility, ok := facilities[s.Facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility '%s'", s.Facility)
+	}
+	if s.AppName == "" {
+		s.AppName = defaultAppName
+	}
+
+	var w = &writer{
+		conn:     logrecord.NewConn(s.Network, s.Address),
+		facility: facility,
+		hostname: "-",
+		appName:  s.AppName,
+		procID:   strconv.Itoa(os.Getpid()),
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		w.hostname = hostname
+	}
+	return logrecord.NewLogger(level, w.emit, w.conn), nil
+}
+
+type writer struct {
+	conn     *logrecord.Conn
+	facility int
+	hostname string
+	appName  string
+	procID   string
+}
+
+func (w *writer) emit(r *logrecord.Record) {
+	var msg = w.format(r)
+	if w.conn.Stream() {
+		var framed = strconv.AppendInt(make([]byte, 0, len(msg)+8), int64(len(msg)), 10)
+		msg = append(append(framed, ' '), msg...)
+	}
+	if _, err := w.conn.Write(msg); err != nil {
+		fmt.Fprintf(os.Stderr, "error sending log message to syslog - %s\n", err)
+	}
+}
+
+// format returns the record as a syslog message with the request ID and the
+// location in its structured data.
+func (w *writer) format(r *logrecord.Record) []byte {
+	var buf = make([]byte, 0, 128+len(r.Message))
+	buf = append(buf, '<')
+	buf = strconv.AppendInt(buf, int64(w.facility*8+severities[r.Level]), 10)
+	buf = append(buf, ">1 "...)
+	buf = r.Time.AppendFormat(buf, timeFormat)
+	buf = append(buf, ' ')
+	buf = append(buf, w.hostname...)
+	buf = append(buf, ' ')
+	buf = append(buf, w.appName...)
+	buf = append(buf, ' ')
+	buf = append(buf, w.procID...)
+	buf = append(buf, " - "...)
+	if len(r.Fields) == 0 {
+		buf = append(buf, '-')
+	} else {
+		buf = append(buf, "["+sdID...)
+		for _, field := range r.Fields {
+			buf = appendParam(buf, field.Key, logrecord.FieldString(field.Value))
+		}
+		buf = append(buf, ']')
+	}
+	buf = append(buf, ' ')
+	return append(buf, r.Message...)
+}
+
+var paramEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// appendParam appends an SD-PARAM. The characters not allowed in an SD-NAME
+// are left out of the name.
+func appendParam(buf []byte, name, value string) []byte {
+	buf = append(buf, ' ')
+	var nameLen int
+	for i := 0; i < len(name) && nameLen < maxSDNameLen; i++ {
+		if c := name[i]; c > ' ' && c < 127 && c != '=' && c != ']' && c != '"' {
+			buf = append(buf, c)
+			nameLen++
+		}
+	}
+	buf = append(buf, `="`...)
+	buf = append(buf, paramEscaper.Replace(value)...)
+	return append(buf, '"')
+}
@@ -0,0 +1,102 @@
+package syslog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/logrecord"
+)
+
+func newLogger(t *testing.T, settings string) *logrecord.Logger {
+	l, err := New(config.NewLogger("syslog", []byte(settings)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestSyslogUDP(t *testing.T) {
+	t.Parallel()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var l = newLogger(t, fmt.Sprintf(
+		`{"level": "info", "network": "udp", "address": %q, "facility": "local0"}`,
+		conn.LocalAddr().String()))
+	l.With(types.LogField{Key: types.LogFieldLocation, Value: `example.com ~ "quoted"]`}).Errorf("[%s] Something %s", "reqid", "failed")
+	l.Debug("not logged")
+
+	var buf = make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected = regexp.MustCompile(`^<131>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}\S+ \S+ nedomi ` +
+		fmt.Sprint(os.Getpid()) + ` - \[nedomi@32473 request_id="reqid" ` +
+		`location="example.com ~ \\"quoted\\"\\]"\] Something failed$`)
+	if !expected.Match(buf[:n]) {
+		t.Errorf("Unexpected message %q", buf[:n])
+	}
+}
+
+func TestSyslogTCPFraming(t *testing.T) {
+	t.Parallel()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var l = newLogger(t, fmt.Sprintf(`{"network": "tcp", "address": %q, "app_name": "test"}`,
+		listener.Addr().String()))
+	l.Log("first")
+	l.Log("second")
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var r = bufio.NewReader(conn)
+	for _, message := range []string{"first", "second"} {
+		var length int
+		if _, err := fmt.Fscanf(r, "%d ", &length); err != nil {
+			t.Fatal(err)
+		}
+		var buf = make([]byte, length)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(`^<30>1 .* test \d+ - - ` + message + `$`).Match(buf) {
+			t.Errorf("Unexpected message %q", buf)
+		}
+	}
+}
+
+func TestSyslogSettingsErrors(t *testing.T) {
+	t.Parallel()
+	for _, settings := range []string{
+		`{"level": "verbose"}`,
+		`{"network": "http", "address": "localhost:80"}`,
+		`{"network": "udp"}`,
+		`{"facility": "local9"}`,
+		`{"level": 5}`,
+	} {
+		if _, err := New(config.NewLogger("syslog", []byte(settings))); err == nil {
+			t.Errorf("Expected an error for the settings %s", settings)
+		}
+	}
+}
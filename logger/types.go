@@ -11,9 +11,13 @@ import (
 
 	"github.com/ironsmile/nedomi/logger/ironsmile"
 
+	"github.com/ironsmile/nedomi/logger/jsonlog"
+
 	"github.com/ironsmile/nedomi/logger/nillogger"
 
 	"github.com/ironsmile/nedomi/logger/std"
+
+	"github.com/ironsmile/nedomi/logger/syslog"
 )
 
 type newLoggerFunc func(cfg *config.Logger) (types.Logger, error)
@@ -24,6 +28,10 @@ var loggerTypes = map[string]newLoggerFunc{
 		return ironsmile.New(cfg)
 	},
 
+	"jsonlog": func(cfg *config.Logger) (types.Logger, error) {
+		return jsonlog.New(cfg)
+	},
+
 	"nillogger": func(cfg *config.Logger) (types.Logger, error) {
 		return nillogger.New(cfg)
 	},
@@ -31,4 +39,8 @@ var loggerTypes = map[string]newLoggerFunc{
 	"std": func(cfg *config.Logger) (types.Logger, error) {
 		return std.New(cfg)
 	},
+
+	"syslog": func(cfg *config.Logger) (types.Logger, error) {
+		return syslog.New(cfg)
+	},
 }
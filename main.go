@@ -147,5 +147,9 @@ func main() {
 
 	flag.Parse()
 
+	if flag.Arg(0) == fsckCommand {
+		os.Exit(runFsck(flag.Args()[1:]))
+	}
+
 	os.Exit(run())
 }
@@ -50,7 +50,7 @@ func (c *CacheAlgorithm) ShouldKeep(o *types.ObjectIndex) bool {
 }
 
 // AddObject returns the specified (if present for this index) or default error
-func (c *CacheAlgorithm) AddObject(o *types.ObjectIndex) error {
+func (c *CacheAlgorithm) AddObject(o *types.ObjectIndex, _ types.BytesSize) error {
 	if found, ok := c.Mapping[*o]; ok && found.AddObject != nil {
 		return found.AddObject(o)
 	}
@@ -51,7 +51,7 @@ func TestSettingFakeReplies(t *testing.T) {
 		AddObject:     func(*types.ObjectIndex) error { return errors.New("pa") },
 		PromoteObject: func(*types.ObjectIndex) { promotedByDefault = true },
 	})
-	if !ca.Lookup(idx) || ca.ShouldKeep(idx) || ca.AddObject(idx) == nil {
+	if !ca.Lookup(idx) || ca.ShouldKeep(idx) || ca.AddObject(idx, 0) == nil {
 		t.Error("Unexpected mock replies")
 	}
 	if ca.PromoteObject(idx); !promotedByDefault {
@@ -67,7 +67,7 @@ func TestSettingFakeReplies(t *testing.T) {
 		},
 	}
 	ca.SetFakeReplies(idx, fakeReplies)
-	if ca.Lookup(idx) || !ca.ShouldKeep(idx) || ca.AddObject(idx) == nil {
+	if ca.Lookup(idx) || !ca.ShouldKeep(idx) || ca.AddObject(idx, 0) == nil {
 		t.Error("Unexpected mock replies after setting the fakes")
 	}
 	if ca.PromoteObject(idx); promotedByDefault || !promotedByCustom {
@@ -0,0 +1,139 @@
+package disk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FsckReport contains the problems found by Fsck in the disk storage. Every
+// problem is identified by the path of the offending file or directory.
+type FsckReport struct {
+	Path           string   `json:"path"`
+	Objects        uint64   `json:"objects"`
+	Parts          uint64   `json:"parts"`
+	OrphanedParts  []string `json:"orphaned_parts"`
+	BrokenMetadata []string `json:"broken_metadata"`
+	OversizedParts []string `json:"oversized_parts"`
+	TempFiles      []string `json:"temp_files"`
+	Repaired       bool     `json:"repaired"`
+	Errors         []string `json:"errors"`
+}
+
+// Problems returns the number of problems found in the storage.
+func (r *FsckReport) Problems() int {
+	return len(r.OrphanedParts) + len(r.BrokenMetadata) +
+		len(r.OversizedParts) + len(r.TempFiles)
+}
+
+func (r *FsckReport) addError(err error) {
+	r.Errors = append(r.Errors, err.Error())
+}
+
+// Fsck walks the storage directory the same way as Iterate and checks it for
+// parts without metadata, metadata which could not be parsed, parts bigger
+// than the part size and temporary files left from interrupted saves or
+// discards. If repair is true the offending files are deleted. Objects with
+// missing or broken metadata are deleted as a whole as their parts can not be
+// used anyway. Object directories whose metadata could not be read, for
+// example because of its permissions, are only reported as errors.
+//
+// Fsck is meant to be used while the storage is not used by a running server.
+// Otherwise it will report the temporary files of the saves in progress and
+// repairing will interfere with them.
+func (s *Disk) Fsck(repair bool) (*FsckReport, error) {
+	var report = &FsckReport{
+		Path:     s.path,
+		Repaired: repair,
+	}
+
+	err := s.walkObjectDirs(s.iterateGlob(), func(rootDir string, entry os.FileInfo) bool {
+		var entryPath = filepath.Join(rootDir, entry.Name())
+		if hasRandomSuffix(entry.Name()) {
+			report.TempFiles = append(report.TempFiles, entryPath)
+			s.fsckRemove(report, repair, entryPath)
+		} else if entry.IsDir() {
+			s.fsckObjectDir(report, repair, entryPath)
+		}
+		return true
+	})
+
+	return report, err
+}
+
+func (s *Disk) fsckObjectDir(report *FsckReport, repair bool, objectDirPath string) {
+	files, err := ioutil.ReadDir(objectDirPath)
+	if err != nil {
+		report.addError(err)
+		return
+	}
+
+	var metadataPath = filepath.Join(objectDirPath, objectMetadataFileName)
+	var metadataErr = checkObjectMetadata(metadataPath)
+	switch {
+	case metadataErr == nil:
+		report.Objects++
+	case os.IsNotExist(metadataErr):
+	case isReadError(metadataErr):
+		// The metadata may be fine, it just could not be read
+		report.addError(metadataErr)
+		return
+	default:
+		report.BrokenMetadata = append(report.BrokenMetadata, metadataPath)
+	}
+
+	for _, file := range files {
+		var filePath = filepath.Join(objectDirPath, file.Name())
+		if hasRandomSuffix(file.Name()) {
+			report.TempFiles = append(report.TempFiles, filePath)
+			s.fsckRemove(report, repair && metadataErr == nil, filePath)
+			continue
+		}
+
+		if _, err := s.getPartNumberFromFile(file.Name()); err != nil {
+			continue
+		}
+
+		report.Parts++
+		if os.IsNotExist(metadataErr) {
+			report.OrphanedParts = append(report.OrphanedParts, filePath)
+		} else if uint64(file.Size()) > s.partSize {
+			report.OversizedParts = append(report.OversizedParts, filePath)
+			s.fsckRemove(report, repair && metadataErr == nil, filePath)
+		}
+	}
+
+	if metadataErr != nil {
+		// Without metadata the parts are useless, so the whole object goes
+		s.fsckRemove(report, repair, objectDirPath)
+	}
+}
+
+// checkObjectMetadata returns the error from opening or decoding the metadata
+// file.
+func checkObjectMetadata(metadataPath string) error {
+	f, err := os.Open(metadataPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = decodeObjectMetadata(metadataPath, f)
+	return err
+}
+
+// isReadError returns whether the error is from opening or reading a file
+// like a permission or an I/O error and not from its contents.
+func isReadError(err error) bool {
+	_, ok := err.(*os.PathError)
+	return ok
+}
+
+func (s *Disk) fsckRemove(report *FsckReport, repair bool, path string) {
+	if !repair {
+		return
+	}
+	s.GetLogger().Debugf("[DiskStorage] fsck is removing %s", path)
+	if err := os.RemoveAll(path); err != nil {
+		report.addError(err)
+	}
+}
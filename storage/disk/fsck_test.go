@@ -0,0 +1,173 @@
+package disk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/mock"
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/testutils"
+)
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestFsck(t *testing.T) {
+	t.Parallel()
+	d, _, cleanup := getTestDiskStorage(t, 10)
+	defer cleanup()
+
+	if report, err := d.Fsck(false); err != nil {
+		t.Fatalf("Unexpected error on empty storage: %s", err)
+	} else if report.Problems() != 0 || report.Objects != 0 {
+		t.Errorf("Expected clean report for empty storage, got %+v", report)
+	}
+
+	// A healthy object with one part
+	saveMetadata(t, d, obj1)
+	savePart(t, d, &types.ObjectIndex{ObjID: obj1.ID, Part: 0}, "0123456789")
+
+	// An object with a part which is bigger than the part size
+	saveMetadata(t, d, obj2)
+	var oversized = d.getObjectIndexPath(&types.ObjectIndex{ObjID: obj2.ID, Part: 1})
+	if err := ioutil.WriteFile(oversized, []byte("0123456789abc"), d.filePermissions); err != nil {
+		t.Fatal(err)
+	}
+	var temp = appendRandomSuffix(d.getObjectIndexPath(&types.ObjectIndex{ObjID: obj2.ID, Part: 2}))
+	if err := ioutil.WriteFile(temp, []byte("01234"), d.filePermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	// An object whose metadata was lost
+	saveMetadata(t, d, obj3)
+	var orphan = d.getObjectIndexPath(&types.ObjectIndex{ObjID: obj3.ID, Part: 0})
+	if err := ioutil.WriteFile(orphan, []byte("0123456789"), d.filePermissions); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(d.getObjectMetadataPath(obj3.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A discarded object directory which was not removed
+	var discarded = appendRandomSuffix(d.getObjectIDPath(types.NewObjectID("testkey", "/discarded")))
+	if err := os.MkdirAll(discarded, d.dirPermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := d.Fsck(false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if report.Objects != 2 || report.Parts != 3 {
+		t.Errorf("Expected 2 objects and 3 parts, got %d and %d", report.Objects, report.Parts)
+	}
+	if len(report.OrphanedParts) != 1 || report.OrphanedParts[0] != orphan {
+		t.Errorf("Expected orphaned part %s, got %v", orphan, report.OrphanedParts)
+	}
+	if len(report.OversizedParts) != 1 || report.OversizedParts[0] != oversized {
+		t.Errorf("Expected oversized part %s, got %v", oversized, report.OversizedParts)
+	}
+	if len(report.TempFiles) != 2 {
+		t.Errorf("Expected 2 temporary files, got %v", report.TempFiles)
+	}
+	if !fileExists(orphan) || !fileExists(oversized) || !fileExists(temp) || !fileExists(discarded) {
+		t.Error("Fsck without repair should not delete anything")
+	}
+
+	if _, err := d.Fsck(true); err != nil {
+		t.Fatalf("Unexpected error while repairing: %s", err)
+	}
+	if fileExists(filepath.Dir(orphan)) || fileExists(oversized) || fileExists(temp) || fileExists(discarded) {
+		t.Error("Fsck with repair should have deleted the problematic files")
+	}
+	checkFile(t, d, d.getObjectIndexPath(&types.ObjectIndex{ObjID: obj1.ID, Part: 0}), "0123456789")
+
+	if report, err := d.Fsck(false); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	} else if report.Problems() != 0 || report.Objects != 2 || report.Parts != 1 {
+		t.Errorf("Expected clean report after repair, got %+v", report)
+	}
+}
+
+func TestFsckBrokenMetadata(t *testing.T) {
+	t.Parallel()
+	d, _, cleanup := getTestDiskStorage(t, 10)
+	defer cleanup()
+
+	saveMetadata(t, d, obj1)
+	savePart(t, d, &types.ObjectIndex{ObjID: obj1.ID, Part: 0}, "0123456789")
+	var metadataPath = d.getObjectMetadataPath(obj1.ID)
+	if err := ioutil.WriteFile(metadataPath, []byte("wrong json!"), d.filePermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := d.Fsck(true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(report.BrokenMetadata) != 1 || report.BrokenMetadata[0] != metadataPath {
+		t.Errorf("Expected broken metadata %s, got %v", metadataPath, report.BrokenMetadata)
+	}
+	if fileExists(d.getObjectIDPath(obj1.ID)) {
+		t.Error("The object with broken metadata should have been deleted")
+	}
+}
+
+func TestFsckUnreadableMetadata(t *testing.T) {
+	t.Parallel()
+	d, _, cleanup := getTestDiskStorage(t, 10)
+	defer cleanup()
+
+	saveMetadata(t, d, obj1)
+	savePart(t, d, &types.ObjectIndex{ObjID: obj1.ID, Part: 0}, "0123456789")
+	// a directory in place of the metadata can be opened but not read
+	var metadataPath = d.getObjectMetadataPath(obj1.ID)
+	if err := os.Remove(metadataPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(metadataPath, d.dirPermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := d.Fsck(true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if report.Problems() != 0 || len(report.Errors) != 1 {
+		t.Errorf("Expected only an error for the unreadable metadata, got %+v", report)
+	}
+	if !fileExists(d.getObjectIndexPath(&types.ObjectIndex{ObjID: obj1.ID, Part: 0})) {
+		t.Error("The object with unreadable metadata should not have been deleted")
+	}
+}
+
+func TestFsckStorageIsReadOnly(t *testing.T) {
+	t.Parallel()
+	diskPath, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+
+	var cfg = &config.CacheZone{Path: diskPath, PartSize: 10}
+	d, err := NewReadOnly(cfg, mock.NewLogger())
+	if err != nil {
+		t.Fatalf("Could not create storage: %s", err)
+	}
+	if fileExists(filepath.Join(diskPath, diskSettingsFileName)) {
+		t.Error("The read only storage should not save its settings")
+	}
+	if _, err := d.Fsck(false); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if _, err := New(cfg, mock.NewLogger()); err != nil {
+		t.Fatal(err)
+	}
+	cfg.PartSize = 20
+	if _, err := NewReadOnly(cfg, mock.NewLogger()); err == nil {
+		t.Error("Expected an error for a different part size than the saved one")
+	}
+}
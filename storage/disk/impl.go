@@ -145,38 +145,67 @@ func (s *Disk) DiscardPart(idx *types.ObjectIndex) error {
 // disk and passes them to the supplied callback function. If the callback
 // function returns false, the iteration stops.
 func (s *Disk) Iterate(callback func(*types.ObjectMetadata, ...*types.ObjectIndex) bool) error {
+	return s.iterateObjects(s.iterateGlob(), callback)
+}
+
+// Partitions implements part of types.PartitionedStorage. The objects are
+// partitioned by the first level of the hash directories.
+func (s *Disk) Partitions() int {
+	return diskPartitions
+}
+
+// IteratePartition implements part of types.PartitionedStorage. It is the same
+// as Iterate but only for the objects in a single first level hash directory.
+func (s *Disk) IteratePartition(partition int, callback func(*types.ObjectMetadata, ...*types.ObjectIndex) bool) error {
+	if partition < 0 || partition >= diskPartitions {
+		return fmt.Errorf("invalid partition %d", partition)
+	}
+	return s.iterateObjects(s.partitionGlob(partition), callback)
+}
+
+func (s *Disk) iterateObjects(glob string, callback func(*types.ObjectMetadata, ...*types.ObjectIndex) bool) error {
+	//!TODO: should we delete the offending folder if we detect an error? maybe just in some cases?
+	return s.walkObjectDirs(glob, func(rootDir string, objectDir os.FileInfo) bool {
+		objectDirPath := filepath.Join(rootDir, objectDir.Name(), objectMetadataFileName)
+		//!TODO: continue on os.ErrNotExist, delete on other errors?
+		obj, err := s.getObjectMetadata(objectDirPath)
+		if err != nil {
+			s.GetLogger().Errorf(
+				"[DiskStorage] error on getting metadata from %s - %s",
+				objectDirPath, err)
+			return true
+		}
+		parts, err := s.GetAvailableParts(obj.ID)
+		if err != nil {
+			s.GetLogger().Errorf(
+				"[DiskStorage] error on getting parts from %s - %s",
+				objectDirPath, err)
+			return true
+		}
+		return callback(obj, parts...)
+	})
+}
+
+// walkObjectDirs calls the callback for every entry in the directories which
+// match the glob and contain the object directories. The entries are normally object directories
+// but may also be leftovers from interrupted writes or discards. If the
+// callback returns false, the walking stops.
+func (s *Disk) walkObjectDirs(glob string, callback func(rootDir string, entry os.FileInfo) bool) error {
 	// At most count(cacheKeys)*256*256 directories
-	rootDirs, err := filepath.Glob(s.path + s.iterateGlob())
+	rootDirs, err := filepath.Glob(s.path + glob)
 	if err != nil {
 		return err
 	}
 
-	//!TODO: should we delete the offending folder if we detect an error? maybe just in some cases?
 	for _, rootDir := range rootDirs {
 		//TODO: stat dirs little by little?
-		objectDirs, err := ioutil.ReadDir(rootDir)
+		entries, err := ioutil.ReadDir(rootDir)
 		if err != nil {
 			return err
 		}
 
-		for _, objectDir := range objectDirs {
-			objectDirPath := filepath.Join(rootDir, objectDir.Name(), objectMetadataFileName)
-			//!TODO: continue on os.ErrNotExist, delete on other errors?
-			obj, err := s.getObjectMetadata(objectDirPath)
-			if err != nil {
-				s.GetLogger().Errorf(
-					"[DiskStorage] error on getting metadata from %s - %s",
-					objectDirPath, err)
-				continue
-			}
-			parts, err := s.GetAvailableParts(obj.ID)
-			if err != nil {
-				s.GetLogger().Errorf(
-					"[DiskStorage] error on getting parts from %s - %s",
-					objectDirPath, err)
-				continue
-			}
-			if !callback(obj, parts...) {
+		for _, entry := range entries {
+			if !callback(rootDir, entry) {
 				return nil
 			}
 		}
@@ -186,6 +215,25 @@ func (s *Disk) Iterate(callback func(*types.ObjectMetadata, ...*types.ObjectInde
 
 // New returns a new disk storage that ready for use.
 func New(cfg *config.CacheZone, log types.Logger) (*Disk, error) {
+	s, err := newDisk(cfg, log)
+	if err != nil {
+		return nil, err
+	}
+	return s, s.saveSettingsOnDisk(cfg)
+}
+
+// NewReadOnly returns a disk storage for offline checks like Fsck. Unlike
+// New it only compares the settings with the ones saved on the disk and does
+// not write them, so the storage directory is left as it is.
+func NewReadOnly(cfg *config.CacheZone, log types.Logger) (*Disk, error) {
+	s, err := newDisk(cfg, log)
+	if err != nil {
+		return nil, err
+	}
+	return s, s.checkPreviousDiskSettings(cfg)
+}
+
+func newDisk(cfg *config.CacheZone, log types.Logger) (*Disk, error) {
 	if cfg == nil || log == nil {
 		return nil, fmt.Errorf("nil constructor parameters")
 	}
@@ -210,12 +258,15 @@ func New(cfg *config.CacheZone, log types.Logger) (*Disk, error) {
 	}
 	s.SetLogger(log)
 
-	return s, s.saveSettingsOnDisk(cfg)
+	return s, nil
 }
 
 const (
 	skipKeyIterateGlob = "/[0-9a-f][0-9a-f]/[0-9a-f][0-9a-f]"
 	withKeyIterateGlob = "/*/[0-9a-f][0-9a-f]/[0-9a-f][0-9a-f]"
+
+	// The number of possible first level hash directories
+	diskPartitions = 256
 )
 
 func (s *Disk) iterateGlob() string {
@@ -224,3 +275,11 @@ func (s *Disk) iterateGlob() string {
 	}
 	return withKeyIterateGlob
 }
+
+func (s *Disk) partitionGlob(partition int) string {
+	var glob = fmt.Sprintf("/%02x/[0-9a-f][0-9a-f]", partition)
+	if s.skipCacheKeyInPath {
+		return glob
+	}
+	return "/*" + glob
+}
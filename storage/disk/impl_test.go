@@ -2,6 +2,7 @@ package disk
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
@@ -280,6 +281,40 @@ func TestIterationSkipKeyInPath(t *testing.T) {
 	}
 }
 
+func TestPartitionIteration(t *testing.T) {
+	t.Parallel()
+	d, _, cleanup := getTestDiskStorage(t, 10)
+	defer cleanup()
+
+	saveMetadata(t, d, obj1)
+	saveMetadata(t, d, obj2)
+	saveMetadata(t, d, obj3)
+
+	var found = make(map[types.ObjectIDHash]int)
+	for i := 0; i < d.Partitions(); i++ {
+		err := d.IteratePartition(i, func(obj *types.ObjectMetadata, _ ...*types.ObjectIndex) bool {
+			if expected := obj.ID.StrHash()[0:2]; expected != fmt.Sprintf("%02x", i) {
+				t.Errorf("Object %s found in partition %d", obj.ID, i)
+			}
+			found[obj.ID.Hash()]++
+			return true
+		})
+		if err != nil {
+			t.Errorf("Received an unexpected error when iterating partition %d: %s", i, err)
+		}
+	}
+
+	for _, obj := range []*types.ObjectMetadata{obj1, obj2, obj3} {
+		if found[obj.ID.Hash()] != 1 {
+			t.Errorf("Expected %s to be found once but it was found %d times", obj.ID, found[obj.ID.Hash()])
+		}
+	}
+
+	if err := d.IteratePartition(d.Partitions(), nil); err == nil {
+		t.Error("Expected an error for an invalid partition")
+	}
+}
+
 func TestIterationErrors(t *testing.T) {
 	t.Parallel()
 	d, _, cleanup := getTestDiskStorage(t, 10)
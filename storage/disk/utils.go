@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -17,6 +18,9 @@ import (
 const (
 	objectMetadataFileName = "objID"
 	diskSettingsFileName   = ".nedomi-cache-storage"
+
+	// How many random bytes are hex encoded in the suffix of temporary files
+	randomSuffixBytes = 16
 )
 
 func getPartFilename(part uint32) string {
@@ -25,7 +29,7 @@ func getPartFilename(part uint32) string {
 }
 
 func appendRandomSuffix(path string) string {
-	randBytes := make([]byte, 16)
+	randBytes := make([]byte, randomSuffixBytes)
 	if _, err := rand.Read(randBytes); err != nil {
 		panic(fmt.Sprintf("Could not read random data: %s", err))
 	}
@@ -33,6 +37,18 @@ func appendRandomSuffix(path string) string {
 	return path + "_" + hex.EncodeToString(randBytes)
 }
 
+// hasRandomSuffix checks whether the name looks like it was generated by
+// appendRandomSuffix. Such files and directories are only supposed to exist
+// for the short time before they are renamed or removed.
+func hasRandomSuffix(name string) bool {
+	const suffixLen = 1 + 2*randomSuffixBytes
+	if len(name) <= suffixLen || name[len(name)-suffixLen] != '_' {
+		return false
+	}
+	_, err := hex.DecodeString(name[len(name)-suffixLen+1:])
+	return err == nil
+}
+
 func (s *Disk) getObjectIDPath(id *types.ObjectID) string {
 	// !TODO redo this with more []byte appending(we know how big it will be)
 	// less string contamination
@@ -92,19 +108,34 @@ func (s *Disk) getObjectMetadata(objPath string) (*types.ObjectMetadata, error)
 		return nil, err
 	}
 
-	obj := &types.ObjectMetadata{}
-	if err := json.NewDecoder(f).Decode(&obj); err != nil {
+	obj, err := decodeObjectMetadata(objPath, f)
+	if err != nil {
 		return nil, utils.NewCompositeError(err, f.Close())
 	}
 
+	return obj, f.Close()
+}
+
+// decodeObjectMetadata reads and validates the metadata of the object at
+// objPath. The errors while reading r are returned as they are, so they can
+// be told apart from the broken metadata.
+func decodeObjectMetadata(objPath string, r io.Reader) (*types.ObjectMetadata, error) {
+	obj := &types.ObjectMetadata{}
+	if err := json.NewDecoder(r).Decode(&obj); err != nil {
+		return nil, err
+	}
+
+	if obj.ID == nil {
+		return nil, fmt.Errorf("The metadata in %s has no object ID", objPath)
+	}
+
 	if filepath.Base(filepath.Dir(objPath)) != obj.ID.StrHash() {
-		err := fmt.Errorf("The object %s was in the wrong directory: %s", obj.ID, objPath)
-		return nil, utils.NewCompositeError(err, f.Close())
+		return nil, fmt.Errorf("The object %s was in the wrong directory: %s", obj.ID, objPath)
 	}
 	//!TODO: add more validation? ex. compare the cache key as well? also the
 	// data itself may be corrupted or from an old app version
 
-	return obj, f.Close()
+	return obj, nil
 }
 
 func (s *Disk) checkPreviousDiskSettings(newSettings *config.CacheZone) error {
@@ -0,0 +1,103 @@
+package types
+
+import "sync"
+
+// AccessInfo is filled in by the handlers with details about how a response
+// was served which are written in the access log. It is safe for concurrent
+// use and all of its methods can be called on a nil *AccessInfo.
+type AccessInfo struct {
+	mutex           sync.Mutex
+	cacheStatus     CacheStatus
+	cacheBytes      uint64
+	upstreamAddrs   []string
+	upstreamRetries uint32
+}
+
+// SetCacheStatus sets how the response was served by the cache handler.
+func (ai *AccessInfo) SetCacheStatus(status CacheStatus) {
+	if ai == nil {
+		return
+	}
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	ai.cacheStatus = status
+}
+
+// CacheStatus returns how the response was served by the cache handler. It is
+// empty if the response did not go through one.
+func (ai *AccessInfo) CacheStatus() CacheStatus {
+	if ai == nil {
+		return ""
+	}
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	return ai.cacheStatus
+}
+
+// AddCacheBytes adds to the number of bytes sent from the cache storage.
+func (ai *AccessInfo) AddCacheBytes(bytes uint64) {
+	if ai == nil {
+		return
+	}
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	ai.cacheBytes += bytes
+}
+
+// CacheBytes returns the number of bytes sent from the cache storage.
+func (ai *AccessInfo) CacheBytes() uint64 {
+	if ai == nil {
+		return 0
+	}
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	return ai.cacheBytes
+}
+
+// AddUpstreamAddr records an upstream address which was used for the request.
+// Each address is recorded once.
+func (ai *AccessInfo) AddUpstreamAddr(addr string) {
+	if ai == nil {
+		return
+	}
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	for _, a := range ai.upstreamAddrs {
+		if a == addr {
+			return
+		}
+	}
+	ai.upstreamAddrs = append(ai.upstreamAddrs, addr)
+}
+
+// UpstreamAddrs returns the upstream addresses which were used for the
+// request in the order of their first use.
+func (ai *AccessInfo) UpstreamAddrs() []string {
+	if ai == nil {
+		return nil
+	}
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	return append([]string(nil), ai.upstreamAddrs...)
+}
+
+// AddUpstreamRetry records that a request to the upstream was retried.
+func (ai *AccessInfo) AddUpstreamRetry() {
+	if ai == nil {
+		return
+	}
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	ai.upstreamRetries++
+}
+
+// UpstreamRetries returns how many times the requests to the upstreams were
+// retried.
+func (ai *AccessInfo) UpstreamRetries() uint32 {
+	if ai == nil {
+		return 0
+	}
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	return ai.upstreamRetries
+}
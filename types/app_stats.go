@@ -19,13 +19,30 @@ type App interface {
 	// GetLocationFor returns the Location that mathes the provided host and path
 	GetLocationFor(host, path string) *Location
 
+	// Locations returns the locations of all virtual hosts keyed by the
+	// virtual host name. The first location of each is the virtual host itself.
+	Locations() map[string][]*Location
+
 	// GetUpstream gets an upstream by it's id, nil is returned if no such is defined
 	GetUpstream(id string) Upstream
+
+	// Upstreams returns all upstreams keyed by their id
+	Upstreams() map[string]Upstream
 }
 
 // AppStats are stats for the whole application
 type AppStats struct {
 	Requests, Responded, NotConfigured uint64
+
+	// The number of currently open client connections
+	OpenConnections uint64
+
+	// The number of HTTP/2 streams being served
+	OpenStreams uint64
+
+	// The number of access log lines dropped because the queues of the
+	// buffered access logs were full
+	AccessLogDropped uint64
 }
 
 // AppVersion is struct representing an App version
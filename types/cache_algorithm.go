@@ -11,9 +11,9 @@ type CacheAlgorithm interface {
 	// ShouldKeep is called to signal that this ObjectIndex has been stored
 	ShouldKeep(*ObjectIndex) bool
 
-	// AddObject adds this ObjectIndex to the cache. Returns an error when
-	// the object is in the cache already.
-	AddObject(*ObjectIndex) error
+	// AddObject adds this ObjectIndex with the supplied size in bytes to the
+	// cache. Returns an error when the object is in the cache already.
+	AddObject(*ObjectIndex, BytesSize) error
 
 	// PromoteObject is called every time this part of a file has been used
 	// to satisfy a client request
@@ -38,6 +38,23 @@ type CacheAlgorithm interface {
 	SetLogger(Logger)
 }
 
+// CacheSnapshotter is a CacheAlgorithm which can save its state and use it
+// when it is restored from the storage after a restart.
+type CacheSnapshotter interface {
+	CacheAlgorithm
+
+	// SaveSnapshot saves the current state of the cache algorithm.
+	SaveSnapshot() error
+
+	// LoadSnapshot loads the last saved state. The objects which are added
+	// after that are placed where they were when the snapshot was saved.
+	LoadSnapshot() error
+
+	// RestoreFinished is called after all of the objects from the storage are
+	// added to the cache algorithm.
+	RestoreFinished()
+}
+
 // Exported errors
 var (
 	ErrAlreadyInCache = errors.New("Object already in cache")
@@ -25,4 +25,12 @@ type CacheStats interface {
 
 	// Size returns the consumed space in bytes for this cache
 	Size() BytesSize
+
+	// Admitted returns the number of objects which were allowed in the cache
+	// by its admission filter
+	Admitted() uint64
+
+	// Rejected returns the number of objects which were not allowed in the
+	// cache by its admission filter
+	Rejected() uint64
 }
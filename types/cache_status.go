@@ -0,0 +1,21 @@
+package types
+
+// CacheStatus is the classification of how a response was served by the
+// caching handler. It is written in the access log.
+type CacheStatus string
+
+// The possible cache statuses.
+const (
+	// CacheStatusHit is for responses fully served from the cache.
+	CacheStatusHit CacheStatus = "hit"
+	// CacheStatusPartial is for responses served from the cache with some
+	// of their parts fetched from the upstream.
+	CacheStatusPartial CacheStatus = "partial"
+	// CacheStatusMiss is for responses which were not in the cache or which
+	// could not be served from it.
+	CacheStatusMiss CacheStatus = "miss"
+	// CacheStatusStale is for responses which were in the cache but had expired.
+	CacheStatusStale CacheStatus = "stale"
+	// CacheStatusBypass is for requests which the cache does not handle.
+	CacheStatusBypass CacheStatus = "bypass"
+)
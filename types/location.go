@@ -16,6 +16,7 @@ type Location struct {
 	Cache                 *CacheZone //!TODO: move to the cache handler settings (plus all Cache* settings)
 	Upstream              Upstream
 	Logger                Logger
+	Stats                 *LocationStats
 }
 
 func (l *Location) String() string {
@@ -0,0 +1,91 @@
+package types
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// LocationStats counts the requests served by a location and the bytes sent
+// in their responses. It is safe for concurrent use and all of its methods
+// can be called on a nil *LocationStats.
+type LocationStats struct {
+	requests   uint64
+	bytes      uint64
+	cacheBytes uint64
+	statuses   [5]uint64 // 1xx to 5xx
+}
+
+// Responded counts a served request with its status code and the number of
+// bytes sent in the response body.
+func (s *LocationStats) Responded(status int, bytes uint64) {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.requests, 1)
+	atomic.AddUint64(&s.bytes, bytes)
+	if class := status / 100; class >= 1 && class <= len(s.statuses) {
+		atomic.AddUint64(&s.statuses[class-1], 1)
+	}
+}
+
+// ServedFromCache counts bytes which were sent to the client from the cache
+// storage instead of from the upstream.
+func (s *LocationStats) ServedFromCache(bytes uint64) {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.cacheBytes, bytes)
+}
+
+// Requests returns the number of served requests.
+func (s *LocationStats) Requests() uint64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&s.requests)
+}
+
+// Bytes returns the number of bytes sent in the response bodies.
+func (s *LocationStats) Bytes() uint64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&s.bytes)
+}
+
+// CacheBytes returns the number of bytes sent from the cache storage.
+func (s *LocationStats) CacheBytes() uint64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&s.cacheBytes)
+}
+
+// UpstreamBytes returns the number of bytes sent which did not come from the
+// cache storage.
+func (s *LocationStats) UpstreamBytes() uint64 {
+	var bytes, cacheBytes = s.Bytes(), s.CacheBytes()
+	if cacheBytes > bytes { // the cache bytes of a request are counted before its total
+		return 0
+	}
+	return bytes - cacheBytes
+}
+
+// StatusClass returns the number of responses with status codes in the
+// class - 1 for 1xx, 2 for 2xx and so on up to 5.
+func (s *LocationStats) StatusClass(class int) uint64 {
+	if s == nil || class < 1 || class > len(s.statuses) {
+		return 0
+	}
+	return atomic.LoadUint64(&s.statuses[class-1])
+}
+
+// CacheHitPrc returns the percentage of the sent bytes which came from the
+// cache storage.
+func (s *LocationStats) CacheHitPrc() string {
+	var bytes = s.Bytes()
+	if bytes == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.f%%", (float64(bytes-s.UpstreamBytes())/float64(bytes))*100)
+}
@@ -0,0 +1,37 @@
+package types
+
+import "testing"
+
+func TestLocationStats(t *testing.T) {
+	t.Parallel()
+	var stats = new(LocationStats)
+	stats.Responded(200, 100)
+	stats.Responded(206, 50)
+	stats.Responded(404, 10)
+	stats.Responded(0, 0)
+	stats.ServedFromCache(120)
+
+	if stats.Requests() != 4 {
+		t.Errorf("Expected 4 requests but got %d", stats.Requests())
+	}
+	if stats.Bytes() != 160 || stats.CacheBytes() != 120 || stats.UpstreamBytes() != 40 {
+		t.Errorf("Wrong bytes: total %d, from cache %d, from upstream %d",
+			stats.Bytes(), stats.CacheBytes(), stats.UpstreamBytes())
+	}
+	if stats.CacheHitPrc() != "75%" {
+		t.Errorf("Expected 75%% hit percentage but got %s", stats.CacheHitPrc())
+	}
+	for class, expected := range []uint64{0, 0, 2, 0, 1, 0, 0} {
+		if stats.StatusClass(class) != expected {
+			t.Errorf("Expected %d responses with class %d but got %d",
+				expected, class, stats.StatusClass(class))
+		}
+	}
+
+	var nilStats *LocationStats
+	nilStats.Responded(200, 10)
+	nilStats.ServedFromCache(10)
+	if nilStats.Requests() != 0 || nilStats.CacheHitPrc() != "" {
+		t.Error("Expected nil stats to be empty")
+	}
+}
@@ -26,3 +26,28 @@ type Logger interface {
 	// Fatalf is similar to Fatal but supports formatting. Support fmt.Printf formating.
 	Fatalf(format string, v ...interface{})
 }
+
+// The keys of the fields which are attached to the messages logged while
+// serving a request.
+const (
+	LogFieldRequestID  = "request_id"
+	LogFieldLocation   = "location"
+	LogFieldClientAddr = "client_addr"
+)
+
+// LogField is a key-value pair attached to log messages.
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// StructuredLogger is a Logger which can attach key-value fields to its
+// messages.
+type StructuredLogger interface {
+	Logger
+
+	// With returns a logger which attaches the fields to all messages in
+	// addition to the fields of this one. A field replaces the field of this
+	// logger with the same key.
+	With(fields ...LogField) StructuredLogger
+}
@@ -42,4 +42,18 @@ type Storage interface {
 	SetLogger(Logger)
 }
 
+// PartitionedStorage is a Storage which contents are split in partitions that
+// can be iterated independently of each other. It is used for restoring the
+// state in parallel.
+type PartitionedStorage interface {
+	Storage
+
+	// Partitions returns the number of partitions of the storage.
+	Partitions() int
+
+	// IteratePartition is the same as Iterate but only goes over the objects in
+	// the partition with the supplied index.
+	IteratePartition(partition int, callback func(*ObjectMetadata, ...*ObjectIndex) bool) error
+}
+
 //!TODO: use custom error type instead of os.ErrNotExist?
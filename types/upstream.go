@@ -1,6 +1,9 @@
 package types
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
 // Upstream represents an object that is used by the proxy handler for making
 // requests to the configured upstream server or servers.
@@ -10,4 +13,28 @@ type Upstream interface {
 	CancelRequest(*http.Request)
 
 	GetAddress(string) (*UpstreamAddress, error)
+
+	// GetAddressExcluding returns an address for the path other than the
+	// excluded ones. It is used for choosing the address of a retry.
+	GetAddressExcluding(path string, excluded []string) (*UpstreamAddress, error)
+
+	// Requested is called once for every client request before it is sent
+	// to the upstream for the first time. The retries are limited to a
+	// percent of these requests.
+	Requested()
+
+	// Retry returns whether a request which failed with err after the given
+	// number of retries can be retried and after what delay.
+	Retry(err error, retries int) (time.Duration, bool)
+
+	// Health returns the health of the upstream addresses.
+	Health() []UpstreamAddressHealth
+
+	// SetLogger changes the logger of the upstream. It is called for the
+	// upstreams kept on reload.
+	SetLogger(Logger)
+
+	// Stop stops the health checks and closes the pooled connections which
+	// are not in use. It is called for the upstreams replaced on reload.
+	Stop()
 }
@@ -3,6 +3,7 @@ package types
 import (
 	"fmt"
 	"net/url"
+	"time"
 )
 
 // UpstreamAddress represents a resolved upstream address
@@ -17,3 +18,15 @@ type UpstreamAddress struct {
 func (ua *UpstreamAddress) String() string {
 	return fmt.Sprintf("%s|%d (%s)", ua.URL.String(), ua.Weight, ua.OriginalURL)
 }
+
+// UpstreamAddressHealth is the health of a single upstream address.
+type UpstreamAddressHealth struct {
+	Address string
+	Healthy bool
+	// Fails is the number of consecutive failed requests or probes.
+	Fails uint32
+	// Changed is the last time the address became healthy or unhealthy.
+	Changed time.Time
+	// LastError describes the last failure.
+	LastError string
+}
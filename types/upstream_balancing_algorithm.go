@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 // UpstreamBalancingAlgorithm encapulates thread-safe methods that are used for
 // balancing user requests between a set of upstream addresses. That is done
 // according to the specific balancing algorithm implementation.
@@ -12,3 +14,18 @@ type UpstreamBalancingAlgorithm interface {
 	// Get returns a specific address, according to the supplied path.
 	Get(string) (*UpstreamAddress, error)
 }
+
+// UpstreamBalancingFeedback is implemented by the balancing algorithms which
+// take the load of the upstream addresses into account. They are told about
+// every request to the addresses they choose from.
+type UpstreamBalancingFeedback interface {
+
+	// Started is called before a request is sent to the address with the
+	// supplied host.
+	Started(host string)
+
+	// Finished is called when the request to the address is done - its
+	// response body is closed or it failed with err. The latency is the time
+	// until the response headers were received.
+	Finished(host string, latency time.Duration, err error)
+}
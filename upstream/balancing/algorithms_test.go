@@ -149,7 +149,7 @@ func TestConsistentHashAlgorithms(t *testing.T) {
 	t.Parallel()
 	wg := sync.WaitGroup{}
 
-	algorithmsToTest := []string{"ketama", "legacyketama", "rendezvous"}
+	algorithmsToTest := []string{"ketama", "legacyketama", "rendezvous", "boundedload"}
 	for _, id := range algorithmsToTest {
 		for i := 0; i < 3; i++ {
 			wg.Add(1)
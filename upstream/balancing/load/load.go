@@ -0,0 +1,184 @@
+// Package load keeps track of the load of the upstream addresses for the
+// balancing algorithms which take it into account. The algorithms choose
+// between two random addresses the less loaded one - the "power of two
+// choices" - which is almost as good as choosing the least loaded of all
+// addresses without herding all requests to the same address.
+package load
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/utils/randutils"
+)
+
+const (
+	// decayTime is the time in which the latency average forgets most of
+	// the older latencies.
+	decayTime = 10 * time.Second
+	// failurePenalty is added to the latency of the failed requests so that
+	// the addresses which fail fast do not look faster than the others.
+	failurePenalty = time.Second
+)
+
+// Address is an upstream address with its load.
+type Address struct {
+	*types.UpstreamAddress
+	pending int64
+
+	mutex   sync.Mutex
+	latency float64 // the moving average in nanoseconds
+	updated time.Time
+}
+
+// Pending returns the number of requests to the address in progress.
+func (a *Address) Pending() int64 {
+	if pending := atomic.LoadInt64(&a.pending); pending > 0 {
+		return pending
+	}
+	return 0
+}
+
+// Latency returns the exponentially weighted moving average of the latency of
+// the address in nanoseconds. It jumps to every latency higher than the
+// average - the peak - and decays slowly after it.
+func (a *Address) Latency() float64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.latency
+}
+
+func (a *Address) observe(latency time.Duration) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	var now = time.Now()
+	if value := float64(latency); value > a.latency {
+		a.latency = value
+	} else {
+		var weight = math.Exp(-float64(now.Sub(a.updated)) / float64(decayTime))
+		a.latency = a.latency*weight + value*(1-weight)
+	}
+	a.updated = now
+}
+
+// Addresses are the addresses an algorithm chooses from. It is safe for
+// concurrent use.
+type Addresses struct {
+	sync.RWMutex
+	buckets     []*Address
+	totalWeight int
+	// all the addresses ever set by host so that the requests which started
+	// before an address was removed and added again are counted correctly
+	byHost map[string]*Address
+	rnd    *rand.Rand
+}
+
+// NewAddresses returns empty Addresses.
+func NewAddresses() *Addresses {
+	return &Addresses{
+		byHost: make(map[string]*Address),
+		rnd:    rand.New(randutils.NewThreadSafeSource()),
+	}
+}
+
+// Set implements the balancing algorithm interface. The load of the
+// addresses which were set before is kept.
+func (a *Addresses) Set(upstreams []*types.UpstreamAddress) {
+	a.Lock()
+	defer a.Unlock()
+	a.buckets = make([]*Address, len(upstreams))
+	a.totalWeight = 0
+	for i, upstream := range upstreams {
+		var address, ok = a.byHost[upstream.Host]
+		if !ok {
+			address = new(Address)
+			a.byHost[upstream.Host] = address
+		}
+		address.UpstreamAddress = upstream
+		a.buckets[i] = address
+		a.totalWeight += int(upstream.Weight)
+	}
+}
+
+// Get returns the address with the lower cost of two addresses chosen at
+// random according to their weights. The first one is returned when their
+// costs are equal so without any load the addresses are chosen randomly.
+func (a *Addresses) Get(cost func(*Address) float64) (*types.UpstreamAddress, error) {
+	a.RLock()
+	defer a.RUnlock()
+	if a.totalWeight <= 0 {
+		return nil, errors.New("No configured upstreams or upstream weights")
+	}
+	var first = a.pick(-1)
+	if len(a.buckets) == 1 {
+		return a.buckets[first].UpstreamAddress, nil
+	}
+	var second = a.pick(first)
+	if cost(a.buckets[second]) < cost(a.buckets[first]) {
+		return a.buckets[second].UpstreamAddress, nil
+	}
+	return a.buckets[first].UpstreamAddress, nil
+}
+
+// pick returns the index of a random address other than the excluded one
+// chosen according to the weights.
+func (a *Addresses) pick(excluded int) int {
+	var totalWeight = a.totalWeight
+	if excluded >= 0 {
+		totalWeight -= int(a.buckets[excluded].Weight)
+	}
+	if totalWeight <= 0 {
+		return (excluded + 1 + a.rnd.Intn(len(a.buckets)-1)) % len(a.buckets)
+	}
+	var chosen = a.rnd.Intn(totalWeight)
+	for i, bucket := range a.buckets {
+		if i == excluded {
+			continue
+		}
+		if chosen -= int(bucket.Weight); chosen < 0 {
+			return i
+		}
+	}
+	return len(a.buckets) - 1
+}
+
+// Started implements the balancing feedback interface.
+func (a *Addresses) Started(host string) {
+	if address := a.Address(host); address != nil {
+		atomic.AddInt64(&address.pending, 1)
+	}
+}
+
+// Finished implements the balancing feedback interface.
+func (a *Addresses) Finished(host string, latency time.Duration, err error) {
+	var address = a.Address(host)
+	if address == nil {
+		return
+	}
+	atomic.AddInt64(&address.pending, -1)
+	if err != nil {
+		latency += failurePenalty
+	}
+	address.observe(latency)
+}
+
+// Address returns the address with the host if it was ever set.
+func (a *Addresses) Address(host string) *Address {
+	a.RLock()
+	defer a.RUnlock()
+	return a.byHost[host]
+}
+
+// PerWeight returns the value divided by the weight of the address so that
+// the addresses with higher weights can have proportionally higher load.
+func (a *Address) PerWeight(value float64) float64 {
+	if a.Weight == 0 {
+		return value
+	}
+	return value / float64(a.Weight)
+}
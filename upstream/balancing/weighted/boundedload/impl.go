@@ -0,0 +1,127 @@
+package boundedload
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/upstream/balancing/load"
+)
+
+const (
+	pointsPerServer = 160
+	pointsPerHash   = md5.Size / 4
+
+	// DefaultLoadFactor is the load factor of new balancers.
+	DefaultLoadFactor = 1.25
+)
+
+type point struct {
+	upstream *types.UpstreamAddress
+	load     *load.Address
+	hash     uint32
+}
+
+// BoundedLoad implements upstream balancing based on consistent hashing with
+// bounded loads. Every path goes to the address after its hash on a ring of
+// weighted points like with ketama, unless that address has more than its
+// share of the requests in progress - the load factor multiplied by the
+// requests per weight. Then the next address on the ring with less than its
+// share is used, so a popular file spills to a few more addresses instead of
+// overloading one.
+type BoundedLoad struct {
+	*load.Addresses // keeps the requests in progress
+
+	mutex       sync.RWMutex
+	ring        []point
+	addresses   []*load.Address
+	totalWeight float64
+	loadFactor  float64
+}
+
+func hashes(key string) [pointsPerHash]uint32 {
+	var digest = md5.Sum([]byte(key))
+	var result [pointsPerHash]uint32
+	for i := range result {
+		result[i] = binary.LittleEndian.Uint32(digest[i*4:])
+	}
+	return result
+}
+
+// Set implements the balancing algorithm interface.
+func (b *BoundedLoad) Set(upstreams []*types.UpstreamAddress) {
+	b.Addresses.Set(upstreams)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var totalWeight uint32
+	for _, u := range upstreams {
+		totalWeight += u.Weight
+	}
+	var maxPoints = uint32(len(upstreams)) * pointsPerServer
+	b.ring = make([]point, 0, maxPoints)
+	b.addresses = make([]*load.Address, 0, len(upstreams))
+	b.totalWeight = float64(totalWeight)
+	if totalWeight == 0 {
+		return
+	}
+	for _, u := range upstreams {
+		var address = b.Addresses.Address(u.Host)
+		b.addresses = append(b.addresses, address)
+		var points = (u.Weight * maxPoints) / totalWeight
+		for i := uint32(0); i < points/pointsPerHash; i++ {
+			for _, hash := range hashes(u.Host + "-" + strconv.Itoa(int(i))) {
+				b.ring = append(b.ring, point{upstream: u, load: address, hash: hash})
+			}
+		}
+	}
+	sort.Slice(b.ring, func(i, j int) bool { return b.ring[i].hash < b.ring[j].hash })
+}
+
+// Get implements the balancing algorithm interface.
+func (b *BoundedLoad) Get(path string) (*types.UpstreamAddress, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	if len(b.ring) == 0 {
+		return nil, errors.New("No configured upstreams or upstream weights")
+	}
+
+	var hash = hashes(path)[0]
+	var start = sort.Search(len(b.ring), func(i int) bool { return b.ring[i].hash >= hash })
+	var total int64
+	for _, address := range b.addresses {
+		total += address.Pending()
+	}
+	// the shares add up to more than the requests in progress with this one
+	// so there is always an address with less than its share
+	var perWeight = b.loadFactor * float64(total+1) / b.totalWeight
+	for i := 0; i < len(b.ring); i++ {
+		var p = b.ring[(start+i)%len(b.ring)]
+		if float64(p.load.Pending()) < math.Ceil(perWeight*float64(p.upstream.Weight)) {
+			return p.upstream, nil
+		}
+	}
+	return b.ring[start%len(b.ring)].upstream, nil
+}
+
+// SetLoadFactor sets how many times the average requests in progress per
+// weight an address can have before the paths hashed to it spill over to the
+// next addresses. It must be at least 1.
+func (b *BoundedLoad) SetLoadFactor(loadFactor float64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.loadFactor = loadFactor
+}
+
+// New creates a new consistent hashing with bounded loads upstream balancer.
+func New() *BoundedLoad {
+	return &BoundedLoad{
+		Addresses:  load.NewAddresses(),
+		loadFactor: DefaultLoadFactor,
+	}
+}
@@ -0,0 +1,72 @@
+package boundedload
+
+import (
+	"testing"
+
+	"github.com/ironsmile/nedomi/types"
+)
+
+func TestBoundedLoads(t *testing.T) {
+	t.Parallel()
+
+	bl := New()
+	if _, err := bl.Get("test"); err == nil {
+		t.Error("Expected get with no upstreams to return an error")
+	}
+
+	h1 := &types.UpstreamAddress{Hostname: "host1", Weight: 1}
+	h2 := &types.UpstreamAddress{Hostname: "host2", Weight: 1}
+	h3 := &types.UpstreamAddress{Hostname: "host3", Weight: 2}
+	h1.Host, h2.Host, h3.Host = "host1:80", "host2:80", "host3:80"
+	bl.Set([]*types.UpstreamAddress{h1, h2, h3})
+
+	// without load the same path always goes to the same address
+	first, err := bl.Get("popular")
+	if err != nil {
+		t.Fatalf("Received an unexpected error: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		if res, _ := bl.Get("popular"); res != first {
+			t.Errorf("Expected %s for the same path but got %s", first.Host, res.Host)
+		}
+	}
+
+	// a popular path spills to other addresses when its address is loaded
+	var pending = map[string]int{}
+	for i := 0; i < 40; i++ {
+		res, _ := bl.Get("popular")
+		bl.Started(res.Host)
+		pending[res.Host]++
+	}
+	if len(pending) < 2 {
+		t.Errorf("Expected the requests to spill over to other addresses but got %v", pending)
+	}
+	for _, h := range []*types.UpstreamAddress{h1, h2, h3} {
+		var limit = 1.25*40*float64(h.Weight)/4 + 1
+		if float64(pending[h.Host]) > limit {
+			t.Errorf("Expected at most %.0f requests to %s but there are %d", limit, h.Host, pending[h.Host])
+		}
+	}
+
+	// the path goes back to its address when the requests finish
+	for host, count := range pending {
+		for i := 0; i < count; i++ {
+			bl.Finished(host, 0, nil)
+		}
+	}
+	if res, _ := bl.Get("popular"); res != first {
+		t.Errorf("Expected %s after the requests finished but got %s", first.Host, res.Host)
+	}
+
+	// with the lowest load factor the load follows the weights
+	bl.SetLoadFactor(1)
+	pending = map[string]int{}
+	for i := 0; i < 40; i++ {
+		res, _ := bl.Get("popular")
+		bl.Started(res.Host)
+		pending[res.Host]++
+	}
+	if pending[h3.Host] != 20 || pending[h1.Host] != 10 || pending[h2.Host] != 10 {
+		t.Errorf("Expected the requests to be split by weight but got %v", pending)
+	}
+}
@@ -0,0 +1,26 @@
+package leastconn
+
+import (
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/upstream/balancing/load"
+)
+
+// LeastConn balances requests to the addresses with the least requests in
+// progress relative to their weights.
+type LeastConn struct {
+	*load.Addresses
+}
+
+// Get implements the balancing algorithm interface.
+func (lc *LeastConn) Get(_ string) (*types.UpstreamAddress, error) {
+	return lc.Addresses.Get(cost)
+}
+
+func cost(a *load.Address) float64 {
+	return a.PerWeight(float64(a.Pending()))
+}
+
+// New creates a new least connections upstream balancer.
+func New() *LeastConn {
+	return &LeastConn{Addresses: load.NewAddresses()}
+}
@@ -0,0 +1,51 @@
+package leastconn
+
+import (
+	"testing"
+
+	"github.com/ironsmile/nedomi/types"
+)
+
+func TestLeastConnections(t *testing.T) {
+	t.Parallel()
+
+	lc := New()
+	if _, err := lc.Get("test"); err == nil {
+		t.Error("Expected get with no upstreams to return an error")
+	}
+
+	h1 := &types.UpstreamAddress{Hostname: "host1", Weight: 1}
+	h2 := &types.UpstreamAddress{Hostname: "host2", Weight: 3}
+	h1.Host, h2.Host = "host1:80", "host2:80"
+	lc.Set([]*types.UpstreamAddress{h1, h2})
+
+	// host2 has three times the weight so it gets three times the requests
+	var pending = map[string]int{}
+	for i := 0; i < 40; i++ {
+		res, err := lc.Get("somepath")
+		if err != nil {
+			t.Fatalf("Received an unexpected error: %s", err)
+		}
+		lc.Started(res.Host)
+		pending[res.Host]++
+	}
+	if pending[h1.Host] < 8 || pending[h1.Host] > 12 {
+		t.Errorf("Expected about 10 requests to %s but there are %d", h1.Host, pending[h1.Host])
+	}
+
+	// only host2 is chosen while it has less requests per weight
+	for i := 0; i < pending[h2.Host]; i++ {
+		lc.Finished(h2.Host, 0, nil)
+	}
+	for i := 0; i < 10; i++ {
+		if res, _ := lc.Get("somepath"); res != h2 {
+			t.Errorf("Expected %s after the requests to it finished but got %s", h2.Host, res.Host)
+		}
+	}
+
+	// the load is kept when the addresses are set again
+	lc.Set([]*types.UpstreamAddress{h2, h1})
+	if res, _ := lc.Get("somepath"); res != h2 {
+		t.Errorf("Expected %s after set but got %s", h2.Host, res.Host)
+	}
+}
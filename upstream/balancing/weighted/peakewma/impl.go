@@ -0,0 +1,28 @@
+package peakewma
+
+import (
+	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/upstream/balancing/load"
+)
+
+// PeakEWMA balances requests to the addresses with the lowest latency
+// multiplied by the number of requests in progress, relative to their
+// weights. The latency is a moving average which jumps to the peaks so that
+// the addresses which slow down get less requests right away.
+type PeakEWMA struct {
+	*load.Addresses
+}
+
+// Get implements the balancing algorithm interface.
+func (p *PeakEWMA) Get(_ string) (*types.UpstreamAddress, error) {
+	return p.Addresses.Get(cost)
+}
+
+func cost(a *load.Address) float64 {
+	return a.PerWeight(a.Latency() * float64(a.Pending()+1))
+}
+
+// New creates a new peak EWMA upstream balancer.
+func New() *PeakEWMA {
+	return &PeakEWMA{Addresses: load.NewAddresses()}
+}
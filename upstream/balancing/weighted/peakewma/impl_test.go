@@ -0,0 +1,54 @@
+package peakewma
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ironsmile/nedomi/types"
+)
+
+func TestPeakEWMA(t *testing.T) {
+	t.Parallel()
+
+	p := New()
+	if _, err := p.Get("test"); err == nil {
+		t.Error("Expected get with no upstreams to return an error")
+	}
+
+	fast := &types.UpstreamAddress{Hostname: "fast", Weight: 1}
+	slow := &types.UpstreamAddress{Hostname: "slow", Weight: 1}
+	fast.Host, slow.Host = "fast:80", "slow:80"
+	p.Set([]*types.UpstreamAddress{fast, slow})
+
+	var expect = func(expected *types.UpstreamAddress, when string) {
+		for i := 0; i < 10; i++ {
+			if res, err := p.Get("somepath"); err != nil {
+				t.Fatalf("Received an unexpected error: %s", err)
+			} else if res != expected {
+				t.Fatalf("Expected %s %s but got %s", expected.Host, when, res.Host)
+			}
+		}
+	}
+
+	for _, host := range []string{fast.Host, slow.Host} {
+		p.Started(host)
+	}
+	p.Finished(fast.Host, 10*time.Millisecond, nil)
+	p.Finished(slow.Host, 100*time.Millisecond, nil)
+	expect(fast, "with lower latency")
+
+	// the cost grows with the requests in progress
+	for i := 0; i < 10; i++ {
+		p.Started(fast.Host)
+	}
+	expect(slow, "with less requests in progress")
+	for i := 0; i < 10; i++ {
+		p.Finished(fast.Host, 10*time.Millisecond, nil)
+	}
+
+	// a failure is a latency peak
+	p.Started(fast.Host)
+	p.Finished(fast.Host, time.Millisecond, errors.New("connection refused"))
+	expect(slow, "after a failure of the other")
+}
@@ -6,8 +6,11 @@ package weighted
 
 import (
 	"github.com/ironsmile/nedomi/types"
+	"github.com/ironsmile/nedomi/upstream/balancing/weighted/boundedload"
 	"github.com/ironsmile/nedomi/upstream/balancing/weighted/ketama"
+	"github.com/ironsmile/nedomi/upstream/balancing/weighted/leastconn"
 	"github.com/ironsmile/nedomi/upstream/balancing/weighted/legacyketama"
+	"github.com/ironsmile/nedomi/upstream/balancing/weighted/peakewma"
 	"github.com/ironsmile/nedomi/upstream/balancing/weighted/random"
 	"github.com/ironsmile/nedomi/upstream/balancing/weighted/rendezvous"
 )
@@ -15,14 +18,26 @@ import (
 // Algorithms contains all weighted upstream balancing algorithm implementations.
 var Algorithms = map[string]func() types.UpstreamBalancingAlgorithm{
 
+	"boundedload": func() types.UpstreamBalancingAlgorithm {
+		return boundedload.New()
+	},
+
 	"ketama": func() types.UpstreamBalancingAlgorithm {
 		return ketama.New()
 	},
 
+	"leastconn": func() types.UpstreamBalancingAlgorithm {
+		return leastconn.New()
+	},
+
 	"legacyketama": func() types.UpstreamBalancingAlgorithm {
 		return legacyketama.New()
 	},
 
+	"peakewma": func() types.UpstreamBalancingAlgorithm {
+		return peakewma.New()
+	},
+
 	"random": func() types.UpstreamBalancingAlgorithm {
 		return random.New()
 	},
@@ -7,7 +7,7 @@ import (
 )
 
 func (u *Upstream) initDNSResolver(
-	algo types.UpstreamBalancingAlgorithm,
+	health *healthChecker,
 	upstreams []*types.UpstreamAddress,
 	logger types.Logger,
 ) {
@@ -37,6 +37,6 @@ func (u *Upstream) initDNSResolver(
 		}
 	}
 
-	algo.Set(result)
+	health.set(result)
 	logger.Logf("Finished resolving the upstream IPs for %s; found %d", u.config.ID, len(result))
 }
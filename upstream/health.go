@@ -0,0 +1,265 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+)
+
+// maxProbeBodySize is how much of the body of a probe response is read so
+// that its connection can be reused.
+const maxProbeBodySize = 64 * 1024
+
+// healthChecker keeps the health of the upstream addresses. Only the healthy
+// addresses are given to the balancing algorithm, or all of them when none
+// is healthy as it is better to try a dead address than not to try at all.
+type healthChecker struct {
+	sync.Mutex
+	id        string
+	cfg       config.UpstreamHealthCheck
+	algo      types.UpstreamBalancingAlgorithm
+	logger    types.Logger
+	addresses []*types.UpstreamAddress
+	states    map[string]*addressHealth
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+type addressHealth struct {
+	down      bool
+	fails     uint32
+	passes    uint32
+	changed   time.Time
+	lastError string
+}
+
+func newHealthChecker(id string, cfg config.UpstreamHealthCheck,
+	algo types.UpstreamBalancingAlgorithm, logger types.Logger) *healthChecker {
+	return &healthChecker{
+		id:     id,
+		cfg:    cfg,
+		algo:   algo,
+		logger: logger,
+		states: make(map[string]*addressHealth),
+		stop:   make(chan struct{}),
+	}
+}
+
+func (h *healthChecker) setLogger(logger types.Logger) {
+	h.Lock()
+	defer h.Unlock()
+	h.logger = logger
+}
+
+// set changes the addresses which are checked. The health of the addresses
+// which were already checked is kept.
+func (h *healthChecker) set(addresses []*types.UpstreamAddress) {
+	h.Lock()
+	defer h.Unlock()
+	var states = make(map[string]*addressHealth, len(addresses))
+	for _, addr := range addresses {
+		if state, ok := h.states[addr.Host]; ok {
+			states[addr.Host] = state
+		} else {
+			states[addr.Host] = new(addressHealth)
+		}
+	}
+	h.addresses, h.states = addresses, states
+	h.apply()
+}
+
+// apply gives the healthy addresses to the balancing algorithm. It must be
+// called with the lock held.
+func (h *healthChecker) apply() {
+	h.algo.Set(h.healthy())
+}
+
+// healthy returns the healthy addresses or all of them if none is healthy.
+// It must be called with the lock held.
+func (h *healthChecker) healthy() []*types.UpstreamAddress {
+	var healthy = make([]*types.UpstreamAddress, 0, len(h.addresses))
+	for _, addr := range h.addresses {
+		if !h.states[addr.Host].down {
+			healthy = append(healthy, addr)
+		}
+	}
+	if len(healthy) == 0 {
+		return h.addresses
+	}
+	return healthy
+}
+
+// candidates returns the addresses which the balancing algorithm chooses
+// from.
+func (h *healthChecker) candidates() []*types.UpstreamAddress {
+	h.Lock()
+	defer h.Unlock()
+	return h.healthy()
+}
+
+// report records the result of a request to the address.
+func (h *healthChecker) report(address string, resp *http.Response, err error) {
+	if h.cfg.MaxFails == 0 {
+		return
+	}
+	switch {
+	case err != nil:
+		h.fail(address, h.cfg.MaxFails, err.Error())
+	case resp.StatusCode >= 500:
+		h.fail(address, h.cfg.MaxFails, resp.Status)
+	default:
+		h.pass(address, 1)
+	}
+}
+
+// fail records a failure for the address and marks it unhealthy if it is
+// the maxFails consecutive one.
+func (h *healthChecker) fail(address string, maxFails uint32, reason string) {
+	h.Lock()
+	defer h.Unlock()
+	var state, ok = h.states[address]
+	if !ok {
+		return
+	}
+	state.fails++
+	state.passes = 0
+	state.lastError = reason
+	if state.down || state.fails < maxFails {
+		return
+	}
+	state.down = true
+	state.changed = time.Now()
+	h.logger.Errorf("Upstream %s address %s is unhealthy after %d failures, the last one: %s",
+		h.id, address, state.fails, reason)
+	h.apply()
+	if h.cfg.Path == "" {
+		var changed = state.changed
+		time.AfterFunc(time.Duration(h.cfg.FailTimeout)*time.Second, func() {
+			h.recover(address, changed)
+		})
+	}
+}
+
+// pass records a success for the address and marks it healthy if it is the
+// passes consecutive one.
+func (h *healthChecker) pass(address string, passes uint32) {
+	h.Lock()
+	defer h.Unlock()
+	var state, ok = h.states[address]
+	if !ok {
+		return
+	}
+	state.fails = 0
+	state.passes++
+	if state.down && state.passes >= passes {
+		h.markHealthy(address, state)
+	}
+}
+
+// recover marks the address healthy after the fail timeout if it has not
+// changed since it was marked unhealthy.
+func (h *healthChecker) recover(address string, changed time.Time) {
+	h.Lock()
+	defer h.Unlock()
+	if state, ok := h.states[address]; ok && state.down && state.changed.Equal(changed) {
+		h.markHealthy(address, state)
+	}
+}
+
+// markHealthy must be called with the lock held.
+func (h *healthChecker) markHealthy(address string, state *addressHealth) {
+	state.down = false
+	state.fails = 0
+	state.changed = time.Now()
+	h.logger.Logf("Upstream %s address %s is healthy again", h.id, address)
+	h.apply()
+}
+
+// health returns the health of all the addresses.
+func (h *healthChecker) health() []types.UpstreamAddressHealth {
+	h.Lock()
+	defer h.Unlock()
+	var result = make([]types.UpstreamAddressHealth, 0, len(h.addresses))
+	for _, addr := range h.addresses {
+		var state = h.states[addr.Host]
+		result = append(result, types.UpstreamAddressHealth{
+			Address:   addr.Host,
+			Healthy:   !state.down,
+			Fails:     state.fails,
+			Changed:   state.changed,
+			LastError: state.lastError,
+		})
+	}
+	return result
+}
+
+// run probes the addresses every interval until the checker is stopped.
+func (h *healthChecker) run(client *http.Client) {
+	var ticker = time.NewTicker(time.Duration(h.cfg.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			h.probeAll(client)
+		}
+	}
+}
+
+func (h *healthChecker) probeAll(client *http.Client) {
+	h.Lock()
+	var addresses = h.addresses
+	h.Unlock()
+	var maxFails = h.cfg.MaxFails
+	if maxFails == 0 {
+		maxFails = 1
+	}
+	var wg sync.WaitGroup
+	for _, addr := range addresses {
+		wg.Add(1)
+		go func(addr *types.UpstreamAddress) {
+			defer wg.Done()
+			if err := h.probe(client, addr); err != nil {
+				h.fail(addr.Host, maxFails, err.Error())
+			} else {
+				h.pass(addr.Host, h.cfg.Passes)
+			}
+		}(addr)
+	}
+	wg.Wait()
+}
+
+// probe requests the health check path from the address. Only 2xx and 3xx
+// responses are successful.
+func (h *healthChecker) probe(client *http.Client, addr *types.UpstreamAddress) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(h.cfg.Timeout)*time.Second)
+	defer cancel()
+	req, err := http.NewRequest("GET", addr.Scheme+"://"+addr.Host+h.cfg.Path, nil)
+	if err != nil {
+		return err
+	}
+	req.Host = addr.OriginalURL.Host
+	req.Header.Set("User-Agent", "nedomi health check")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxProbeBodySize))
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("health check %s returned %s", h.cfg.Path, resp.Status)
+	}
+	return nil
+}
+
+func (h *healthChecker) stopChecks() {
+	h.stopOnce.Do(func() { close(h.stop) })
+}
@@ -0,0 +1,152 @@
+package upstream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/mock"
+)
+
+func newHealthTestUpstream(t *testing.T, hc config.UpstreamHealthCheck, servers ...*httptest.Server) *Upstream {
+	var cfg = &config.Upstream{
+		ID:          "test",
+		Balancing:   "unweighted-roundrobin",
+		Settings:    config.GetDefaultUpstreamSettings(),
+		HealthCheck: hc,
+	}
+	cfg.Settings.ResolveAddresses = false
+	for _, server := range servers {
+		u, err := url.Parse(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Addresses = append(cfg.Addresses, config.UpstreamAddress{URL: u, Weight: 1})
+	}
+	up, err := New(cfg, mock.NewLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return up
+}
+
+func (u *Upstream) testGet(t *testing.T, path string) (string, int) {
+	addr, err := u.GetAddress(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("GET", addr.Scheme+"://"+addr.Host+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := u.Do(req)
+	if err != nil {
+		return addr.Host, 0
+	}
+	_ = resp.Body.Close()
+	return addr.Host, resp.StatusCode
+}
+
+func (u *Upstream) healthOf(t *testing.T, address string) bool {
+	for _, health := range u.Health() {
+		if health.Address == address {
+			return health.Healthy
+		}
+	}
+	t.Fatalf("no health for %s in %+v", address, u.Health())
+	return false
+}
+
+func TestPassiveHealthChecks(t *testing.T) {
+	t.Parallel()
+	var failing int32 = 1
+	var good = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer good.Close()
+	var bad = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer bad.Close()
+	var badHost = bad.Listener.Addr().String()
+
+	var hc = config.GetDefaultUpstreamHealthCheck()
+	hc.MaxFails, hc.FailTimeout = 2, 3600
+	var up = newHealthTestUpstream(t, hc, good, bad)
+	defer up.Stop()
+
+	var badResponses int
+	for i := 0; i < 10; i++ {
+		if host, code := up.testGet(t, "/"); code != http.StatusOK {
+			if host != badHost {
+				t.Errorf("unexpected %d from %s", code, host)
+			}
+			badResponses++
+		}
+	}
+	if badResponses != 2 {
+		t.Errorf("expected the bad address to be used until it fails twice but it failed %d times", badResponses)
+	}
+	if up.healthOf(t, badHost) {
+		t.Errorf("expected %s to be unhealthy", badHost)
+	}
+
+	// with all addresses unhealthy all of them are used
+	good.Close()
+	atomic.StoreInt32(&failing, 0)
+	for i := 0; i < 6; i++ {
+		up.testGet(t, "/")
+	}
+	if !up.healthOf(t, badHost) {
+		t.Errorf("expected %s to be healthy after a successful request", badHost)
+	}
+}
+
+func TestActiveHealthChecks(t *testing.T) {
+	t.Parallel()
+	var healthy int32 = 1
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+		} else if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	var other = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+	var host = server.Listener.Addr().String()
+
+	var hc = config.GetDefaultUpstreamHealthCheck()
+	hc.Path, hc.Interval, hc.Passes = "/health", 3600, 2
+	var up = newHealthTestUpstream(t, hc, server, other)
+	defer up.Stop()
+
+	for i, test := range []struct {
+		healthy  int32
+		expected bool
+	}{
+		{1, true},
+		{0, false},
+		{1, false}, // needs two passes
+		{1, true},
+		{1, true},
+	} {
+		atomic.StoreInt32(&healthy, test.healthy)
+		up.health.probeAll(up.probeClient)
+		if result := up.healthOf(t, host); result != test.expected {
+			t.Errorf("expected healthy to be %t after probe %d got %t", test.expected, i, result)
+		}
+	}
+
+	atomic.StoreInt32(&healthy, 0)
+	up.health.probeAll(up.probeClient)
+	for i := 0; i < 4; i++ {
+		if addr, code := up.testGet(t, "/"); addr == host {
+			t.Errorf("unexpected request %d with %d to the unhealthy %s", i, code, addr)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package upstream
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ironsmile/nedomi/utils/metrics"
+)
+
+var (
+	upstreamDuration = metrics.NewHistogramVec("nedomi_upstream_request_duration_seconds",
+		"Time until the response headers are received from the upstream addresses.",
+		metrics.DefaultBuckets, "upstream", "address")
+	upstreamErrors = metrics.NewCounterVec("nedomi_upstream_errors_total",
+		"Number of requests to the upstream addresses which failed without a response.",
+		"upstream", "address")
+)
+
+func init() {
+	metrics.DefaultRegistry.Register(upstreamDuration)
+	metrics.DefaultRegistry.Register(upstreamErrors)
+}
+
+// instrumentedClient is an upClient which records the latencies and the
+// errors of the requests for every upstream address.
+type instrumentedClient struct {
+	upClient
+	id string
+}
+
+func newInstrumentedClient(id string, base upClient) upClient {
+	return &instrumentedClient{upClient: base, id: id}
+}
+
+func (c *instrumentedClient) Do(req *http.Request) (*http.Response, error) {
+	var start = time.Now()
+	resp, err := c.upClient.Do(req)
+	if err != nil {
+		upstreamErrors.Inc(c.id, req.URL.Host)
+	} else {
+		upstreamDuration.Observe(time.Since(start).Seconds(), c.id, req.URL.Host)
+	}
+	return resp, err
+}
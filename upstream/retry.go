@@ -0,0 +1,84 @@
+package upstream
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// minRetryBudget is the number of retries available to an upstream
+	// before it had any requests so that upstreams with little traffic can
+	// still retry.
+	minRetryBudget = 10
+	// maxRetryBudget is the most retries which can be saved in quiet times
+	// and used in a burst.
+	maxRetryBudget = 100
+)
+
+// retryBudget limits the retries to a percent of the requests. Every request
+// deposits the percent of a retry and every retry withdraws a whole one.
+type retryBudget struct {
+	sync.Mutex
+	ratio   float64
+	balance float64
+}
+
+func newRetryBudget(percent uint32) *retryBudget {
+	return &retryBudget{
+		ratio:   float64(percent) / 100,
+		balance: minRetryBudget,
+	}
+}
+
+func (b *retryBudget) deposit() {
+	b.Lock()
+	defer b.Unlock()
+	if b.balance += b.ratio; b.balance > maxRetryBudget {
+		b.balance = maxRetryBudget
+	}
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.Lock()
+	defer b.Unlock()
+	if b.balance < 1 {
+		return false
+	}
+	b.balance--
+	return true
+}
+
+// isRetryable returns whether the request error is a connection error or a
+// timeout after which the request can be sent to another address.
+func isRetryable(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Requested implements the Upstream interface. Only the client requests and
+// not their retries deposit in the retry budget so that the retries can not
+// fund themselves when the upstream fails.
+func (u *Upstream) Requested() {
+	if u.budget != nil {
+		u.budget.deposit()
+	}
+}
+
+// Retry implements the Upstream interface
+func (u *Upstream) Retry(err error, retries int) (time.Duration, bool) {
+	if u.config == nil || retries >= int(u.config.Settings.Retries) ||
+		!isRetryable(err) || !u.budget.withdraw() {
+		return 0, false
+	}
+	return time.Duration(u.config.Settings.RetryBackoff) * time.Millisecond << uint(retries), true
+}
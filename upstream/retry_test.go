@@ -0,0 +1,102 @@
+package upstream
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+	var cfg = &config.Upstream{Settings: config.GetDefaultUpstreamSettings()}
+	cfg.Settings.Retries, cfg.Settings.RetryBackoff, cfg.Settings.RetryBudget = 2, 10, 50
+	var up = &Upstream{config: cfg, budget: newRetryBudget(cfg.Settings.RetryBudget)}
+	var dialErr = &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	var resetErr = &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+	for _, test := range []struct {
+		err     error
+		retries int
+		delay   time.Duration
+		ok      bool
+	}{
+		{dialErr, 0, 10 * time.Millisecond, true},
+		{resetErr, 1, 20 * time.Millisecond, true},
+		{timeoutError{}, 0, 10 * time.Millisecond, true},
+		{dialErr, 2, 0, false}, // too many retries
+		{errors.New("malformed response"), 0, 0, false},
+	} {
+		delay, ok := up.Retry(test.err, test.retries)
+		if delay != test.delay || ok != test.ok {
+			t.Errorf("expected %s, %t for %v after %d retries got %s, %t",
+				test.delay, test.ok, test.err, test.retries, delay, ok)
+		}
+	}
+
+	// the budget is exhausted after the retries available at the start
+	var retried int
+	for i := 0; i < 2*minRetryBudget; i++ {
+		if _, ok := up.Retry(dialErr, 0); ok {
+			retried++
+		}
+	}
+	if expected := minRetryBudget - 3; retried != expected {
+		t.Errorf("expected %d retries from the initial budget got %d", expected, retried)
+	}
+	for i := 0; i < 4; i++ {
+		up.Requested()
+	}
+	for i := 0; i < 3; i++ {
+		if _, ok := up.Retry(dialErr, 0); ok != (i < 2) {
+			t.Errorf("expected retry %d after 4 requests with 50%% budget to be %t", i, i < 2)
+		}
+	}
+}
+
+func TestRetryBudgetInBurstOfFailures(t *testing.T) {
+	t.Parallel()
+	var dead = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close() // the connections to it are refused
+	var up = newHealthTestUpstream(t, config.GetDefaultUpstreamHealthCheck(), dead, dead)
+	defer up.Stop()
+	up.config.Settings.Retries = 2
+
+	// every request is sent and retried as the proxy handler does it
+	const requests = 200
+	var retried int
+	for i := 0; i < requests; i++ {
+		up.Requested()
+		for retries := 0; ; retries++ {
+			addr, err := up.GetAddress("/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, err := http.NewRequest("GET", addr.Scheme+"://"+addr.Host+"/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := up.Do(req); err == nil {
+				t.Fatal("expected the requests to fail")
+			} else if _, ok := up.Retry(err, retries); !ok {
+				break
+			}
+			retried++
+		}
+	}
+	var ratio = float64(up.config.Settings.RetryBudget) / 100
+	if max := minRetryBudget + int(ratio*requests); retried > max {
+		t.Errorf("expected at most %d retries for %d failed requests got %d", max, requests, retried)
+	}
+}
@@ -2,9 +2,13 @@ package upstream
 
 import (
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ironsmile/nedomi/config"
@@ -18,6 +22,10 @@ type client http.Client
 func (c *client) Do(req *http.Request) (*http.Response, error) {
 	return ((*http.Client)(c)).Do(req)
 }
+func (c *client) CloseIdleConnections() {
+	((*http.Client)(c)).CloseIdleConnections()
+}
+
 func (c *client) CancelRequest(req *http.Request) {
 	t := c.Transport
 	if t == nil {
@@ -34,6 +42,7 @@ func (c *client) CancelRequest(req *http.Request) {
 type upClient interface {
 	Do(req *http.Request) (*http.Response, error)
 	CancelRequest(*http.Request)
+	CloseIdleConnections()
 }
 
 // Upstream implements the http.RoundTripper interface and is used for requests
@@ -42,6 +51,10 @@ type Upstream struct {
 	upClient
 	config        *config.Upstream
 	addressGetter func(string) (*types.UpstreamAddress, error)
+	health        *healthChecker
+	probeClient   *http.Client
+	budget        *retryBudget
+	feedback      types.UpstreamBalancingFeedback
 }
 
 // GetAddress implements the Upstream interface
@@ -49,22 +62,129 @@ func (u *Upstream) GetAddress(uri string) (*types.UpstreamAddress, error) {
 	return u.addressGetter(uri)
 }
 
+// maxRehashes is how many times the path is hashed again to find an address
+// which was not tried before falling back to any address.
+const maxRehashes = 4
+
+// GetAddressExcluding implements the Upstream interface. The path is hashed
+// again with a suffix so that the hashing algorithms choose the same other
+// address for the same path.
+func (u *Upstream) GetAddressExcluding(path string, excluded []string) (*types.UpstreamAddress, error) {
+	for i := 1; i <= maxRehashes; i++ {
+		addr, err := u.addressGetter(path + "#" + strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+		if !contains(excluded, addr.Host) {
+			return addr, nil
+		}
+	}
+	if u.health != nil {
+		for _, addr := range u.health.candidates() {
+			if !contains(excluded, addr.Host) {
+				return addr, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no upstream addresses other than %s", strings.Join(excluded, ", "))
+}
+
+func contains(addresses []string, address string) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// Do implements the Upstream interface. The results of the requests are used
+// by the passive health checks and the balancing algorithms which take the
+// load of the addresses into account.
+func (u *Upstream) Do(req *http.Request) (*http.Response, error) {
+	var start = time.Now()
+	if u.feedback != nil {
+		u.feedback.Started(req.URL.Host)
+	}
+	resp, err := u.upClient.Do(req)
+	if u.feedback != nil {
+		var latency = time.Since(start)
+		if err != nil {
+			u.feedback.Finished(req.URL.Host, latency, err)
+		} else {
+			resp.Body = &finishingBody{ReadCloser: resp.Body, finish: func() {
+				u.feedback.Finished(req.URL.Host, latency, nil)
+			}}
+		}
+	}
+	if u.health != nil && (err == nil || req.Context().Err() == nil) { // not cancelled
+		u.health.report(req.URL.Host, resp, err)
+	}
+	return resp, err
+}
+
+// finishingBody is a response body which calls finish once when it is
+// closed.
+type finishingBody struct {
+	io.ReadCloser
+	once   sync.Once
+	finish func()
+}
+
+func (b *finishingBody) Close() error {
+	var err = b.ReadCloser.Close()
+	b.once.Do(b.finish)
+	return err
+}
+
+// Health implements the Upstream interface
+func (u *Upstream) Health() []types.UpstreamAddressHealth {
+	if u.health == nil {
+		return nil
+	}
+	return u.health.health()
+}
+
+// SetLogger implements the Upstream interface
+func (u *Upstream) SetLogger(logger types.Logger) {
+	if u.health != nil {
+		u.health.setLogger(logger)
+	}
+}
+
+// Stop implements the Upstream interface
+func (u *Upstream) Stop() {
+	if u.health != nil {
+		u.health.stopChecks()
+	}
+	if u.probeClient != nil {
+		u.probeClient.CloseIdleConnections()
+	}
+	u.CloseIdleConnections()
+}
+
+func newTransport(settings config.UpstreamSettings) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   seconds(settings.ConnectTimeout),
+			KeepAlive: seconds(settings.KeepAlive),
+		}).DialContext,
+		TLSHandshakeTimeout:   seconds(settings.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: seconds(settings.ResponseHeaderTimeout),
+		IdleConnTimeout:       seconds(settings.IdleTimeout),
+		DisableKeepAlives:     settings.DisableKeepAlives,
+		DisableCompression:    true,
+		MaxIdleConns:          int(settings.MaxIdleConnections),
+		MaxIdleConnsPerHost:   int(settings.MaxIdleConnectionsPerServer),
+	}
+}
+
 func getClient(settings config.UpstreamSettings) upClient {
-	//!TODO: get all of these hardcoded values from the config
 	//!TODO: use the facebook retryable transport
-	//!TODO: investigate transport timeouts for active connections
 	c := (*client)(&http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			Dial: (&net.Dialer{
-				Timeout:   10 * time.Second,
-				KeepAlive: 10 * time.Second,
-			}).Dial,
-			TLSHandshakeTimeout: 5 * time.Second,
-			DisableKeepAlives:   false,
-			DisableCompression:  true,
-			MaxIdleConnsPerHost: 5,
-		},
+		Transport: newTransport(settings),
+		Timeout:   seconds(settings.Timeout),
 	})
 
 	if settings.MaxConnectionsPerServer > 0 {
@@ -73,6 +193,16 @@ func getClient(settings config.UpstreamSettings) upClient {
 	return c
 }
 
+func seconds(s uint32) time.Duration {
+	return time.Duration(s) * time.Second
+}
+
+// loadFactorSetter is implemented by the balancing algorithms which limit the
+// load of every address to a factor of the average.
+type loadFactorSetter interface {
+	SetLoadFactor(float64)
+}
+
 // New creates a new RoundTripper from the supplied upstream config
 func New(conf *config.Upstream, logger types.Logger) (*Upstream, error) {
 
@@ -82,9 +212,15 @@ func New(conf *config.Upstream, logger types.Logger) (*Upstream, error) {
 	}
 
 	up := &Upstream{
-		upClient:      getClient(conf.Settings),
+		upClient:      newInstrumentedClient(conf.ID, getClient(conf.Settings)),
 		config:        conf,
 		addressGetter: balancingAlgo.Get,
+		health:        newHealthChecker(conf.ID, conf.HealthCheck, balancingAlgo, logger),
+		budget:        newRetryBudget(conf.Settings.RetryBudget),
+	}
+	up.feedback, _ = balancingAlgo.(types.UpstreamBalancingFeedback)
+	if setter, ok := balancingAlgo.(loadFactorSetter); ok && conf.Settings.LoadFactor != 0 {
+		setter.SetLoadFactor(conf.Settings.LoadFactor)
 	}
 
 	// Feed the unresolved addresses while waiting for DNS resolver
@@ -103,11 +239,21 @@ func New(conf *config.Upstream, logger types.Logger) (*Upstream, error) {
 			Weight:      addr.Weight,
 		}
 	}
-	balancingAlgo.Set(unresolved)
+	up.health.set(unresolved)
 
 	if conf.Settings.ResolveAddresses {
 		//!TODO: get app cancel channel to the dns resolver
-		go up.initDNSResolver(balancingAlgo, unresolved, logger)
+		go up.initDNSResolver(up.health, unresolved, logger)
+	}
+
+	if conf.HealthCheck.Path != "" {
+		up.probeClient = &http.Client{
+			Transport: newTransport(conf.Settings),
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		go up.health.run(up.probeClient)
 	}
 
 	return up, nil
@@ -130,7 +276,7 @@ func NewSimple(url *url.URL) (*Upstream, error) {
 	}
 
 	return &Upstream{
-		upClient: getClient(config.GetDefaultUpstreamSettings()),
+		upClient: newInstrumentedClient(url.String(), getClient(config.GetDefaultUpstreamSettings())),
 		addressGetter: func(_ string) (*types.UpstreamAddress, error) {
 			// Always return the same single url - no balancing needed
 			return up, nil
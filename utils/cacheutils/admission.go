@@ -0,0 +1,125 @@
+package cacheutils
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+)
+
+const (
+	// The number of counters for every object in the counting bloom filter
+	admissionHashes = 4
+
+	// How many counters per cached object there are in the filter
+	admissionCountersPerObject = 4
+
+	// The maximum size of the filter. It does not have to be as big as the
+	// cache as it only tracks the requests in the admission window.
+	admissionMaxCounters = 1 << 24
+)
+
+// AdmissionFilter decides which objects are worth caching. An object is
+// admitted only after it is requested a minimum number of times within a time
+// window. The requests are counted in a counting bloom filter which is
+// cleared when the window passes. The counts may be overestimated but never
+// underestimated.
+type AdmissionFilter struct {
+	mutex       sync.Mutex
+	minRequests uint64
+	window      time.Duration
+	windowEnd   time.Time
+	counters    []uint8
+	mask        uint64
+
+	admitted uint64
+	rejected uint64
+}
+
+// NewAdmissionFilter returns an AdmissionFilter configured with the admission
+// settings of the cache zone. If AdmissionMinRequests is not more than 1
+// every object is admitted and only the stats are tracked.
+func NewAdmissionFilter(cz *config.CacheZone) *AdmissionFilter {
+	var f = &AdmissionFilter{
+		minRequests: cz.AdmissionMinRequests,
+		window:      time.Duration(cz.AdmissionWindow) * time.Second,
+	}
+	if f.minRequests <= 1 {
+		return f
+	}
+	if f.minRequests > 255 {
+		f.minRequests = 255
+	}
+
+	var size uint64 = 1024
+	for size < cz.StorageObjects*admissionCountersPerObject && size < admissionMaxCounters {
+		size <<= 1
+	}
+	f.counters = make([]uint8, size)
+	f.mask = size - 1
+	f.windowEnd = time.Now().Add(f.window)
+	return f
+}
+
+// Admit records a request for an object which is not in the cache and returns
+// whether it should be cached.
+func (f *AdmissionFilter) Admit(oi *types.ObjectIndex) bool {
+	if f.counters == nil {
+		atomic.AddUint64(&f.admitted, 1)
+		return true
+	}
+
+	var admit = f.increment(oi.Hash()) >= f.minRequests
+	if admit {
+		atomic.AddUint64(&f.admitted, 1)
+	} else {
+		atomic.AddUint64(&f.rejected, 1)
+	}
+	return admit
+}
+
+// increment adds a request for the hash and returns the estimated number of
+// requests for it in the current window.
+func (f *AdmissionFilter) increment(h types.ObjectIndexHash) uint64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.window > 0 {
+		if now := time.Now(); now.After(f.windowEnd) {
+			for i := range f.counters {
+				f.counters[i] = 0
+			}
+			f.windowEnd = now.Add(f.window)
+		}
+	}
+
+	var (
+		// The object hash is a sha1 so parts of it are good enough as hashes
+		h1     = binary.BigEndian.Uint64(h[0:8])
+		h2     = binary.BigEndian.Uint64(h[8:16]) ^ uint64(binary.BigEndian.Uint32(h[types.ObjectIDHashSize:]))
+		result = uint8(255)
+	)
+	for i := uint64(0); i < admissionHashes; i++ {
+		var index = (h1 + i*h2) & f.mask
+		if f.counters[index] < 255 {
+			f.counters[index]++
+		}
+		if f.counters[index] < result {
+			result = f.counters[index]
+		}
+	}
+	return uint64(result)
+}
+
+// Admitted returns the number of admitted objects
+func (f *AdmissionFilter) Admitted() uint64 {
+	return atomic.LoadUint64(&f.admitted)
+}
+
+// Rejected returns the number of rejected objects
+func (f *AdmissionFilter) Rejected() uint64 {
+	return atomic.LoadUint64(&f.rejected)
+}
@@ -0,0 +1,75 @@
+package cacheutils
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+)
+
+func admissionObject(i int) *types.ObjectIndex {
+	return &types.ObjectIndex{
+		ObjID: types.NewObjectID("admission", "/object/"+strconv.Itoa(i)),
+		Part:  uint32(i % 3),
+	}
+}
+
+func TestAdmissionFilterDisabled(t *testing.T) {
+	t.Parallel()
+	var f = NewAdmissionFilter(&config.CacheZone{StorageObjects: 100})
+	for i := 0; i < 10; i++ {
+		if !f.Admit(admissionObject(i)) {
+			t.Errorf("Object %d was not admitted by a disabled filter", i)
+		}
+	}
+	if f.Admitted() != 10 || f.Rejected() != 0 {
+		t.Errorf("Expected 10 admitted and 0 rejected but got %d and %d",
+			f.Admitted(), f.Rejected())
+	}
+}
+
+func TestAdmissionFilterMinRequests(t *testing.T) {
+	t.Parallel()
+	var f = NewAdmissionFilter(&config.CacheZone{
+		StorageObjects:       100,
+		AdmissionMinRequests: 3,
+		AdmissionWindow:      3600,
+	})
+	for i := 0; i < 50; i++ {
+		var oi = admissionObject(i)
+		if f.Admit(oi) || f.Admit(oi) {
+			t.Errorf("Object %d was admitted before its third request", i)
+		}
+		if !f.Admit(oi) {
+			t.Errorf("Object %d was not admitted on its third request", i)
+		}
+	}
+	if f.Admitted() != 50 || f.Rejected() != 100 {
+		t.Errorf("Expected 50 admitted and 100 rejected but got %d and %d",
+			f.Admitted(), f.Rejected())
+	}
+}
+
+func TestAdmissionFilterWindow(t *testing.T) {
+	t.Parallel()
+	var f = NewAdmissionFilter(&config.CacheZone{
+		StorageObjects:       100,
+		AdmissionMinRequests: 2,
+		AdmissionWindow:      3600,
+	})
+	var oi = admissionObject(1)
+	if f.Admit(oi) {
+		t.Error("The object was admitted on its first request")
+	}
+
+	// the window passes so the first request is forgotten
+	f.windowEnd = time.Now().Add(-time.Second)
+	if f.Admit(oi) {
+		t.Error("The object was admitted on its first request in a new window")
+	}
+	if !f.Admit(oi) {
+		t.Error("The object was not admitted on its second request in the window")
+	}
+}
@@ -0,0 +1,100 @@
+package cacheutils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ironsmile/nedomi/types"
+)
+
+// stats is a simple implementation of the types.CacheStats interface which
+// can be used by the cache algorithms.
+type stats struct {
+	id       string
+	hits     uint64
+	requests uint64
+	objects  uint64
+	size     types.BytesSize
+	admitted uint64
+	rejected uint64
+}
+
+// NewStats returns types.CacheStats with the supplied values and the stats
+// of the admission filter.
+func NewStats(id string, hits, requests, objects uint64, size types.BytesSize,
+	admission *AdmissionFilter) types.CacheStats {
+	return &stats{
+		id:       id,
+		hits:     hits,
+		requests: requests,
+		objects:  objects,
+		size:     size,
+		admitted: admission.Admitted(),
+		rejected: admission.Rejected(),
+	}
+}
+
+// CacheHitPrc implements part of types.CacheStats interface
+func (s *stats) CacheHitPrc() string {
+	if s.requests == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.f%%", (float32(s.hits)/float32(s.requests))*100)
+}
+
+// ID implements part of types.CacheStats interface
+func (s *stats) ID() string {
+	return s.id
+}
+
+// Hits implements part of types.CacheStats interface
+func (s *stats) Hits() uint64 {
+	return s.hits
+}
+
+// Requests implements part of types.CacheStats interface
+func (s *stats) Requests() uint64 {
+	return s.requests
+}
+
+// Objects implements part of types.CacheStats interface
+func (s *stats) Objects() uint64 {
+	return s.objects
+}
+
+// Size implements part of types.CacheStats interface
+func (s *stats) Size() types.BytesSize {
+	return s.size
+}
+
+// Admitted implements part of types.CacheStats interface
+func (s *stats) Admitted() uint64 {
+	return s.admitted
+}
+
+// Rejected implements part of types.CacheStats interface
+func (s *stats) Rejected() uint64 {
+	return s.rejected
+}
+
+// RemoveInBatches calls remove with at most count indexes at a time and waits
+// timeout milliseconds between the calls. It is used for removing the objects
+// which no longer fit in a cache algorithm after it is resized down without
+// overloading the storage. A count of 0 removes everything at once.
+func RemoveInBatches(indexes []types.ObjectIndex, count, timeout uint64,
+	remove func(...types.ObjectIndex)) {
+
+	if count == 0 {
+		count = uint64(len(indexes))
+	}
+	for i := uint64(0); i < uint64(len(indexes)); i += count {
+		if i > 0 {
+			time.Sleep(time.Duration(timeout) * time.Millisecond)
+		}
+		end := i + count
+		if end > uint64(len(indexes)) {
+			end = uint64(len(indexes))
+		}
+		remove(indexes[i:end]...)
+	}
+}
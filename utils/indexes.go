@@ -18,3 +18,17 @@ func BreakInIndexes(id *types.ObjectID, start, end, partSize uint64) []*types.Ob
 	}
 	return result
 }
+
+// PartSize returns the size in bytes of the specified part of the object. All
+// parts are partSize long except for the last one which is usually shorter.
+// When the object size is unknown partSize is returned.
+func PartSize(obj *types.ObjectMetadata, part uint32, partSize uint64) types.BytesSize {
+	var start = uint64(part) * partSize
+	if obj.Size == 0 || start+partSize <= obj.Size {
+		return types.BytesSize(partSize)
+	}
+	if start >= obj.Size {
+		return 0
+	}
+	return types.BytesSize(obj.Size - start)
+}
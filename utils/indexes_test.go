@@ -41,3 +41,26 @@ func TestBreakInIndexes(t *testing.T) {
 		}
 	}
 }
+
+func TestPartSize(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		objSize  uint64
+		part     uint32
+		expected types.BytesSize
+	}{
+		{objSize: 120, part: 0, expected: 50},
+		{objSize: 120, part: 1, expected: 50},
+		{objSize: 120, part: 2, expected: 20},
+		{objSize: 100, part: 1, expected: 50},
+		{objSize: 100, part: 2, expected: 0},
+		{objSize: 0, part: 3, expected: 50},
+	}
+	for _, test := range tests {
+		obj := &types.ObjectMetadata{Size: test.objSize}
+		if found := PartSize(obj, test.part, 50); found != test.expected {
+			t.Errorf("Expected part %d of %d bytes object to be %d bytes but it was %d",
+				test.part, test.objSize, test.expected, found)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package logfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+)
+
+const (
+	defaultFlushInterval = time.Second
+	defaultQueueSize     = 4096
+)
+
+// AsyncWriter writes to an io.Writer from its own goroutine through a buffer
+// so that the callers of Write never wait for the underlying writer. The
+// writes which do not fit in its bounded queue are dropped. Every write to the
+// underlying writer contains only whole writes to the AsyncWriter so a line
+// is never split between two files by a rotation.
+type AsyncWriter struct {
+	w       io.Writer
+	queue   chan []byte
+	done    chan struct{}
+	dropped uint64
+
+	mutex  sync.RWMutex // guards closed and sending on queue
+	closed bool
+}
+
+// NewAsyncWriter returns an AsyncWriter for w with the supplied buffering
+// settings. Zero values are replaced by defaults.
+func NewAsyncWriter(w io.Writer, cfg config.LogBuffering) *AsyncWriter {
+	var (
+		flushInterval = time.Duration(cfg.FlushInterval) * time.Millisecond
+		queueSize     = cfg.QueueSize
+	)
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	var a = &AsyncWriter{
+		w:     w,
+		queue: make(chan []byte, queueSize),
+		done:  make(chan struct{}),
+	}
+	go a.loop(bufio.NewWriterSize(w, int(cfg.Size.Bytes())), flushInterval)
+	return a
+}
+
+// Write queues a copy of p to be written. It never returns an error - if the
+// queue is full p is dropped and counted.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if a.closed {
+		atomic.AddUint64(&a.dropped, 1)
+		return len(p), nil
+	}
+	select {
+	case a.queue <- append([]byte(nil), p...):
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+	return len(p), nil
+}
+
+// Dropped returns the number of writes which were dropped because the queue
+// was full.
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Close writes everything queued and stops the writing goroutine. It does
+// not close the underlying writer.
+func (a *AsyncWriter) Close() error {
+	a.mutex.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mutex.Unlock()
+	<-a.done
+	return nil
+}
+
+func (a *AsyncWriter) loop(buf *bufio.Writer, flushInterval time.Duration) {
+	defer close(a.done)
+	var ticker = time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case p, ok := <-a.queue:
+			if !ok {
+				a.flush(buf)
+				return
+			}
+			if len(p) > buf.Available() { // flush only whole writes
+				a.flush(buf)
+			}
+			if _, err := buf.Write(p); err != nil {
+				a.reportError(err)
+			}
+		case <-ticker.C:
+			a.flush(buf)
+		}
+	}
+}
+
+func (a *AsyncWriter) flush(buf *bufio.Writer) {
+	if err := buf.Flush(); err != nil {
+		a.reportError(err)
+		buf.Reset(a.w) // drop what could not be written instead of failing forever
+	}
+}
+
+func (a *AsyncWriter) reportError(err error) {
+	fmt.Fprintf(os.Stderr, "error writing log - %s\n", err)
+}
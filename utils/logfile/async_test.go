@@ -0,0 +1,136 @@
+package logfile
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/types"
+)
+
+// blockingWriter blocks all writes until it is unblocked.
+type blockingWriter struct {
+	sync.Mutex
+	buf     bytes.Buffer
+	unblock chan struct{}
+}
+
+func (b *blockingWriter) Write(p []byte) (int, error) {
+	<-b.unblock
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *blockingWriter) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
+
+func TestAsyncWriterFlushesOnClose(t *testing.T) {
+	t.Parallel()
+	var w = &blockingWriter{unblock: make(chan struct{})}
+	close(w.unblock)
+	var a = NewAsyncWriter(w, config.LogBuffering{Size: types.BytesSize(1024), FlushInterval: 60000})
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err := a.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.String(); got != "first\nsecond\n" {
+		t.Errorf("Unexpected written data %q", got)
+	}
+	if _, err := a.Write([]byte("after close\n")); err != nil {
+		t.Fatal(err)
+	}
+	if a.Dropped() != 1 {
+		t.Errorf("Expected the write after close to be dropped but %d were", a.Dropped())
+	}
+}
+
+func TestAsyncWriterFlushesOnInterval(t *testing.T) {
+	t.Parallel()
+	var w = &blockingWriter{unblock: make(chan struct{})}
+	close(w.unblock)
+	var a = NewAsyncWriter(w, config.LogBuffering{Size: types.BytesSize(1024), FlushInterval: 10})
+	defer a.Close()
+	if _, err := a.Write([]byte("line\n")); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); w.String() == ""; {
+		if time.Now().After(deadline) {
+			t.Fatal("The buffer was not flushed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := w.String(); got != "line\n" {
+		t.Errorf("Unexpected written data %q", got)
+	}
+}
+
+func TestAsyncWriterDropsWhenFull(t *testing.T) {
+	t.Parallel()
+	var w = &blockingWriter{unblock: make(chan struct{})}
+	// a buffer of one byte makes every write go to the blocked writer
+	var a = NewAsyncWriter(w, config.LogBuffering{Size: types.BytesSize(1), QueueSize: 2})
+	var line = []byte("line\n")
+	for i := 0; i < 10; i++ {
+		if n, err := a.Write(line); err != nil || n != len(line) {
+			t.Fatalf("Unexpected write result %d, %v", n, err)
+		}
+	}
+	// at most one line is being written and two are queued
+	if dropped := a.Dropped(); dropped < 7 {
+		t.Errorf("Expected at least 7 dropped lines but got %d", dropped)
+	}
+	close(w.unblock)
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if written := uint64(bytes.Count([]byte(w.String()), []byte("\n"))); written+a.Dropped() != 10 {
+		t.Errorf("Written %d and dropped %d lines out of 10", written, a.Dropped())
+	}
+}
+
+// recordingWriter keeps every write separately.
+type recordingWriter struct {
+	sync.Mutex
+	writes []string
+}
+
+func (r *recordingWriter) Write(p []byte) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	r.writes = append(r.writes, string(p))
+	return len(p), nil
+}
+
+func TestAsyncWriterWritesWholeLines(t *testing.T) {
+	t.Parallel()
+	var w = new(recordingWriter)
+	var a = NewAsyncWriter(w, config.LogBuffering{Size: types.BytesSize(16), FlushInterval: 60000})
+	var lines = []string{"1234567\n", "abcdefgh\n", "ABCDEFGHIJKLMNOPQRSTUVWXYZ\n", "xyz\n"}
+	for _, line := range lines {
+		if _, err := a.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the buffer is flushed before every line which does not fit in it
+	if len(w.writes) != len(lines) {
+		t.Fatalf("Expected the writes %q but got %q", lines, w.writes)
+	}
+	for i := range lines {
+		if w.writes[i] != lines[i] {
+			t.Errorf("Expected the write %q but got %q", lines[i], w.writes[i])
+		}
+	}
+}
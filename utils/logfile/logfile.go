@@ -0,0 +1,298 @@
+// Package logfile contains log files which can be reopened after they were
+// moved by an external tool like logrotate and which can rotate themselves.
+package logfile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/utils"
+)
+
+const (
+	fileFlags         = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	rotatedTimeFmt    = "20060102-150405.000"
+	rotatedCounterSep = "_"
+	compressedExt     = ".gz"
+	compressBufSize   = 64 * 1024
+)
+
+// File is a log file which is appended to. It is safe for concurrent use.
+type File struct {
+	path string
+	perm os.FileMode
+
+	refs int // the number of Open calls not yet closed, guarded by filesMutex
+
+	mutex    sync.Mutex
+	file     *os.File
+	size     int64
+	opened   time.Time
+	rotation config.LogRotation
+}
+
+var (
+	filesMutex sync.Mutex
+	files      = make(map[string]*File)
+)
+
+// Open returns the log file for the path, opening it if it is not already
+// open. Every path is opened only once and the rotation settings of the last
+// call are used for it. Every call to Open must be followed by a call to
+// Close when the file is no longer used.
+func Open(path string, perm os.FileMode, rotation config.LogRotation) (*File, error) {
+	filesMutex.Lock()
+	defer filesMutex.Unlock()
+	if f, ok := files[path]; ok {
+		f.mutex.Lock()
+		f.rotation = rotation
+		f.mutex.Unlock()
+		f.refs++
+		return f, nil
+	}
+
+	var f = &File{path: path, perm: perm, rotation: rotation, refs: 1}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	files[path] = f
+	return f, nil
+}
+
+// ReopenAll reopens all log files. It should be called after they were moved
+// by an external log rotation tool.
+func ReopenAll() error {
+	filesMutex.Lock()
+	defer filesMutex.Unlock()
+	var errs = new(utils.CompositeError)
+	for _, f := range files {
+		errs.AppendError(f.Reopen())
+	}
+	if errs.Empty() {
+		return nil
+	}
+	return errs
+}
+
+// Close releases the file for one of the calls to Open. The file is closed
+// when it is released for all of them. After that it is not reopened by
+// ReopenAll and the next Open for its path opens it again.
+func (f *File) Close() error {
+	filesMutex.Lock()
+	if f.refs--; f.refs > 0 {
+		filesMutex.Unlock()
+		return nil
+	}
+	if files[f.path] == f {
+		delete(files, f.path)
+	}
+	filesMutex.Unlock()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.file.Close()
+}
+
+// open opens the file at the path. It must be called with the mutex held.
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, fileFlags, f.perm)
+	if err != nil {
+		return err
+	}
+	st, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, st.Size(), time.Now()
+	return nil
+}
+
+// Reopen closes the file and opens it again at its path.
+func (f *File) Reopen() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.reopen()
+}
+
+func (f *File) reopen() error {
+	var old = f.file
+	if err := f.open(); err != nil {
+		return fmt.Errorf("error reopening log file %s - %s", f.path, err)
+	}
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+// Write appends p to the file, rotating it first if it is due.
+func (f *File) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.shouldRotate(len(p)) {
+		if err := f.rotate(); err != nil {
+			// keep writing in the old file rather than losing the logs
+			fmt.Fprintf(os.Stderr, "error rotating log file %s - %s\n", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *File) shouldRotate(toWrite int) bool {
+	if f.rotation.MaxSize > 0 && f.size > 0 &&
+		uint64(f.size)+uint64(toWrite) > f.rotation.MaxSize.Bytes() {
+		return true
+	}
+	return f.rotation.MaxAge > 0 && f.size > 0 &&
+		time.Since(f.opened) > time.Duration(f.rotation.MaxAge)*time.Second
+}
+
+// rotate moves the file to a name with the current time and opens a new one.
+// The old files are compressed and removed in the background.
+func (f *File) rotate() error {
+	var rotated = rotatedName(f.path, time.Now())
+	if err := os.Rename(f.path, rotated); err != nil {
+		return err
+	}
+	if err := f.reopen(); err != nil {
+		return err
+	}
+	go f.cleanup(rotated, f.rotation)
+	return nil
+}
+
+// rotatedName returns a name for the rotated path with the time which is not
+// used by another rotated file. A counter is added after the time when there
+// is already a file rotated in the same millisecond.
+func rotatedName(path string, t time.Time) string {
+	var name = path + "." + t.Format(rotatedTimeFmt)
+	for counter := 1; ; counter++ {
+		var candidate = name
+		if counter > 1 {
+			candidate += rotatedCounterSep + strconv.Itoa(counter)
+		}
+		if !exists(candidate) && !exists(candidate+compressedExt) {
+			return candidate
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return !os.IsNotExist(err)
+}
+
+// parseRotated returns the time and the counter in the name of a file rotated
+// from path. ok is false if the name is not one of a rotated file.
+func parseRotated(path, name string) (t time.Time, counter int, ok bool) {
+	if !strings.HasPrefix(name, path+".") {
+		return t, 0, false
+	}
+	var suffix = strings.TrimSuffix(strings.TrimPrefix(name, path+"."), compressedExt)
+	counter = 1
+	if i := strings.Index(suffix, rotatedCounterSep); i >= 0 {
+		var err error
+		if counter, err = strconv.Atoi(suffix[i+len(rotatedCounterSep):]); err != nil || counter < 2 {
+			return t, 0, false
+		}
+		suffix = suffix[:i]
+	}
+	t, err := time.Parse(rotatedTimeFmt, suffix)
+	return t, counter, err == nil
+}
+
+func (f *File) cleanup(rotated string, rotation config.LogRotation) {
+	if rotation.Compress {
+		if err := compress(rotated); err != nil {
+			fmt.Fprintf(os.Stderr, "error compressing log file %s - %s\n", rotated, err)
+		}
+	}
+	if rotation.MaxBackups > 0 {
+		if err := removeBackups(f.path, rotation.MaxBackups); err != nil {
+			fmt.Fprintf(os.Stderr, "error removing old log files for %s - %s\n", f.path, err)
+		}
+	}
+}
+
+// compress gzips the file and removes the original.
+func compress(path string) (err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	st, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path+compressedExt, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, st.Mode())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(path + compressedExt)
+		}
+	}()
+
+	var gz = gzip.NewWriter(out)
+	if _, err = io.CopyBuffer(gz, in, make([]byte, compressBufSize)); err != nil {
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// removeBackups removes the oldest rotated files of path so that at most
+// maxBackups are left.
+func removeBackups(path string, maxBackups int) error {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return err
+	}
+	type backup struct {
+		name    string
+		time    time.Time
+		counter int
+	}
+	var backups = make([]backup, 0, len(matches))
+	for _, match := range matches {
+		if t, counter, ok := parseRotated(path, match); ok {
+			backups = append(backups, backup{name: match, time: t, counter: counter})
+		}
+	}
+	if len(backups) <= maxBackups {
+		return nil
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].time.Equal(backups[j].time) {
+			return backups[i].time.Before(backups[j].time)
+		}
+		return backups[i].counter < backups[j].counter
+	})
+	var errs = new(utils.CompositeError)
+	for _, backup := range backups[:len(backups)-maxBackups] {
+		errs.AppendError(os.Remove(backup.name))
+	}
+	if errs.Empty() {
+		return nil
+	}
+	return errs
+}
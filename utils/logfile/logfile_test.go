@@ -0,0 +1,197 @@
+package logfile
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ironsmile/nedomi/config"
+	"github.com/ironsmile/nedomi/utils/testutils"
+)
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func write(t *testing.T, f *File, s string) {
+	if _, err := f.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+	var path = filepath.Join(dir, "access.log")
+
+	f, err := Open(path, 0600, config.LogRotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if same, _ := Open(path, 0600, config.LogRotation{}); same != f {
+		t.Error("Expected the same file to be returned for the same path")
+	} else {
+		defer same.Close()
+	}
+	write(t, f, "first\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	write(t, f, "second\n")
+	if err := ReopenAll(); err != nil {
+		t.Fatal(err)
+	}
+	write(t, f, "third\n")
+
+	if got := readFile(t, path+".1"); got != "first\nsecond\n" {
+		t.Errorf("Unexpected contents of the moved file %q", got)
+	}
+	if got := readFile(t, path); got != "third\n" {
+		t.Errorf("Unexpected contents of the reopened file %q", got)
+	}
+}
+
+func TestCloseAfterAllOpens(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+	var path = filepath.Join(dir, "access.log")
+
+	f, err := Open(path, 0600, config.LogRotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, 0600, config.LogRotation{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	write(t, f, "still open\n")
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("closed\n")); err == nil {
+		t.Error("Expected an error when writing to the closed file")
+	}
+	filesMutex.Lock()
+	_, ok := files[path]
+	filesMutex.Unlock()
+	if ok {
+		t.Error("Expected the closed file not to be reopened by ReopenAll")
+	}
+
+	reopened, err := Open(path, 0600, config.LogRotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if reopened == f {
+		t.Error("Expected the file to be opened again after it was closed")
+	}
+	write(t, reopened, "reopened\n")
+	if got := readFile(t, path); got != "still open\nreopened\n" {
+		t.Errorf("Unexpected contents of the file %q", got)
+	}
+}
+
+func TestRotatedNames(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+	var (
+		path = filepath.Join(dir, "access.log")
+		now  = time.Now()
+	)
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		var name = rotatedName(path, now)
+		if i == 1 { // as if it was already compressed
+			name += compressedExt
+		}
+		if err := ioutil.WriteFile(name, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	var base = path + "." + now.Format(rotatedTimeFmt)
+	if names[0] != base || names[1] != base+"_2"+compressedExt || names[2] != base+"_3" {
+		t.Errorf("Unexpected names of the files rotated in the same millisecond %v", names)
+	}
+
+	var older = rotatedName(path, now.Add(-time.Second))
+	if err := ioutil.WriteFile(older, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeBackups(path, 2); err != nil {
+		t.Fatal(err)
+	}
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 || backups[0] != names[1] || backups[1] != names[2] {
+		t.Errorf("Expected only the last two rotated files to be left but got %v", backups)
+	}
+}
+
+func TestRotationBySize(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+	var path = filepath.Join(dir, "access.log")
+
+	f, err := Open(path, 0600, config.LogRotation{MaxSize: 10, MaxBackups: 1, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	write(t, f, "123456\n")
+	write(t, f, "abcdef\n") // rotates
+	if got := readFile(t, path); got != "abcdef\n" {
+		t.Errorf("Unexpected contents after the rotation %q", got)
+	}
+
+	var compressed []string
+	for i := 0; i < 100 && len(compressed) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		compressed, _ = filepath.Glob(path + ".*" + compressedExt)
+	}
+	if len(compressed) != 1 {
+		t.Fatalf("Expected one compressed file but got %v", compressed)
+	}
+	gzFile, err := os.Open(compressed[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gzFile.Close()
+	gz, err := gzip.NewReader(gzFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadAll(gz); err != nil || string(b) != "123456\n" {
+		t.Errorf("Unexpected contents of the compressed file %q: %v", b, err)
+	}
+
+	time.Sleep(5 * time.Millisecond) // make the next name different
+	write(t, f, "ghijkl\n")          // rotates again and removes the first backup
+	var backups []string
+	for i := 0; i < 100; i++ {
+		backups, _ = filepath.Glob(path + ".*")
+		if len(backups) == 1 && filepath.Ext(backups[0]) == compressedExt && backups[0] != compressed[0] {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(backups) != 1 || backups[0] == compressed[0] {
+		t.Errorf("Expected only the newest backup to be left but got %v", backups)
+	}
+}
@@ -0,0 +1,155 @@
+package logrecord
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	dialTimeout  = 5 * time.Second
+	writeTimeout = 5 * time.Second
+	minBackoff   = 100 * time.Millisecond
+	maxBackoff   = 30 * time.Second
+	maxPending   = 1024
+)
+
+var (
+	errConnClosed = errors.New("the connection is closed")
+	errDropped    = errors.New("not connected, too many messages waiting for the connection")
+)
+
+// Conn writes to a network address. It connects in the background on the
+// first write and reconnects after a failed one, waiting exponentially longer
+// between the failed attempts. The writes while it is not connected wait for
+// the connection in a bounded queue and are dropped when it is full so the
+// callers never wait for a connection. It is safe for concurrent use.
+type Conn struct {
+	network, address string
+
+	mutex   sync.Mutex
+	conn    net.Conn
+	pending [][]byte // the writes waiting for the connection
+	dialing bool
+	backoff time.Duration // the wait after the last failed attempt
+	retry   time.Time     // no attempt before it
+	closed  bool
+}
+
+// NewConn returns a Conn to the address in the network as in net.Dial.
+func NewConn(network, address string) *Conn {
+	return &Conn{network: network, address: address}
+}
+
+// Write writes p in a single write to the connection. If it is not connected
+// or the write fails p is queued to be written after connecting again.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return 0, errConnClosed
+	}
+	if c.conn != nil {
+		if n, err := c.write(p); err == nil {
+			return n, nil
+		}
+	}
+	if len(c.pending) >= maxPending {
+		c.connect()
+		return 0, errDropped
+	}
+	c.pending = append(c.pending, append([]byte(nil), p...))
+	c.connect()
+	return len(p), nil
+}
+
+// write writes p to the connection and closes it on failure. It must be
+// called with the mutex held.
+func (c *Conn) write(p []byte) (int, error) {
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	n, err := c.conn.Write(p)
+	if err != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+	return n, err
+}
+
+// connect starts connecting in the background unless it is already connected
+// or it is too early after a failed attempt. It must be called with the mutex
+// held.
+func (c *Conn) connect() {
+	if c.conn != nil || c.dialing || time.Now().Before(c.retry) {
+		return
+	}
+	c.dialing = true
+	go c.dial()
+}
+
+func (c *Conn) reconnect() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.closed {
+		c.connect()
+	}
+}
+
+func (c *Conn) dial() {
+	conn, err := net.DialTimeout(c.network, c.address, dialTimeout)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.dialing = false
+	switch {
+	case c.closed:
+		if err == nil {
+			_ = conn.Close()
+		}
+		return
+	case err != nil:
+		if c.backoff *= 2; c.backoff < minBackoff {
+			c.backoff = minBackoff
+		} else if c.backoff > maxBackoff {
+			c.backoff = maxBackoff
+		}
+		c.retry = time.Now().Add(c.backoff)
+		if len(c.pending) > 0 {
+			time.AfterFunc(c.backoff, c.reconnect)
+		}
+		return
+	}
+	c.conn, c.backoff, c.retry = conn, 0, time.Time{}
+	for len(c.pending) > 0 {
+		if _, err := c.write(c.pending[0]); err != nil {
+			return // kept for the next connection
+		}
+		c.pending[0] = nil
+		c.pending = c.pending[1:]
+	}
+	c.pending = nil
+}
+
+// Stream returns whether the network of the connection is a stream one as
+// opposed to a datagram one. Messages written in a stream need framing.
+func (c *Conn) Stream() bool {
+	switch c.network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return false
+	}
+	return true
+}
+
+// Close closes the current connection if there is one. The writes waiting
+// for a connection and all later ones are dropped.
+func (c *Conn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed, c.pending = true, nil
+	if c.conn == nil {
+		return nil
+	}
+	var err = c.conn.Close()
+	c.conn = nil
+	return err
+}
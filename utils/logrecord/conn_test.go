@@ -0,0 +1,72 @@
+package logrecord
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ironsmile/nedomi/utils/testutils"
+)
+
+func TestConnQueuesUntilConnected(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+	var path = filepath.Join(dir, "log.sock")
+
+	var c = NewConn("unix", path)
+	defer c.Close()
+	var start = time.Now()
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err := c.Write([]byte(line)); err != nil {
+			t.Fatalf("Unexpected error while not connected: %s", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the writes not to wait for the connection but they took %s", elapsed)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conn, err := listener.Accept() // after the backoff of the failed attempt
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var r = bufio.NewReader(conn)
+	for _, expected := range []string{"first\n", "second\n"} {
+		if line, err := r.ReadString('\n'); err != nil || line != expected {
+			t.Errorf("Expected %q but got %q, %v", expected, line, err)
+		}
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Write([]byte("closed\n")); err == nil {
+		t.Error("Expected an error when writing to a closed connection")
+	}
+}
+
+func TestConnDropsWhenQueueIsFull(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testutils.GetTestFolder(t)
+	defer cleanup()
+
+	var c = NewConn("unix", filepath.Join(dir, "missing.sock"))
+	defer c.Close()
+	for i := 0; i < maxPending; i++ {
+		if _, err := c.Write([]byte("line\n")); err != nil {
+			t.Fatalf("Unexpected error for write %d: %s", i, err)
+		}
+	}
+	if _, err := c.Write([]byte("line\n")); err == nil {
+		t.Error("Expected the write to be dropped when the queue is full")
+	}
+}
@@ -0,0 +1,75 @@
+package logrecord
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ironsmile/nedomi/types"
+)
+
+// MergeFields returns a new slice with the fields followed by the ones in
+// with. The fields in with replace the ones with the same key.
+func MergeFields(fields []types.LogField, with ...types.LogField) []types.LogField {
+	var result = make([]types.LogField, 0, len(fields)+len(with))
+	for _, field := range fields {
+		if indexOfField(with, field.Key) < 0 {
+			result = append(result, field)
+		}
+	}
+	for i, field := range with {
+		// the last of the fields with the same key wins
+		if indexOfField(with[i+1:], field.Key) < 0 {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+func indexOfField(fields []types.LogField, key string) int {
+	for i, field := range fields {
+		if field.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// FieldString returns the value of a field as a string. Request IDs and byte
+// slices are converted to strings, errors and fmt.Stringers are replaced by
+// their strings and everything else is formatted as with fmt.Sprint.
+func FieldString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case types.RequestID:
+		return string(v)
+	case []byte:
+		return string(v)
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+// AppendFields appends the fields to buf as space separated key=value pairs.
+// Values with spaces, quotes or equal signs are quoted.
+func AppendFields(buf []byte, fields []types.LogField) []byte {
+	for i, field := range fields {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, field.Key...)
+		buf = append(buf, '=')
+		var value = FieldString(field.Value)
+		if value == "" || strings.ContainsAny(value, " =\"\\") ||
+			strings.IndexFunc(value, func(r rune) bool { return !strconv.IsPrint(r) }) >= 0 {
+			buf = strconv.AppendQuote(buf, value)
+		} else {
+			buf = append(buf, value...)
+		}
+	}
+	return buf
+}
@@ -0,0 +1,185 @@
+// Package logrecord contains what is shared by the structured loggers - log
+// records with their level and fields, a types.Logger which creates them and
+// a writer to a remote address.
+package logrecord
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ironsmile/nedomi/types"
+)
+
+// Level is the severity of a log record. A logger with some level writes the
+// records with it and all lower levels.
+type Level int
+
+// These are the different logging levels that are supported.
+const (
+	NoLog Level = iota
+	Fatal
+	Error
+	Info
+	Debug
+)
+
+var levelNames = [...]string{
+	NoLog: "no_log",
+	Fatal: "fatal",
+	Error: "error",
+	Info:  "info",
+	Debug: "debug",
+}
+
+func (l Level) String() string {
+	if l < NoLog || int(l) >= len(levelNames) {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level with the name. The empty name is Info.
+func ParseLevel(name string) (Level, error) {
+	if name == "" {
+		return Info, nil
+	}
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return Level(level), nil
+		}
+	}
+	return NoLog, fmt.Errorf("unsupported log level %s", name)
+}
+
+// Record is a single log message with its fields.
+type Record struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  []types.LogField
+}
+
+// NewRecord returns a record for the message with the current time. If the
+// message starts with the "[request-id] " prefix which is still used by some
+// handlers the request ID is moved from it to the fields.
+func NewRecord(level Level, fields []types.LogField, message string) *Record {
+	var r = &Record{
+		Time:    time.Now(),
+		Level:   level,
+		Message: message,
+		Fields:  fields,
+	}
+	if !strings.HasPrefix(message, "[") {
+		return r
+	}
+	var end = strings.Index(message, "] ")
+	if end <= 1 || strings.ContainsAny(message[1:end], "[] ") {
+		return r
+	}
+	var reqID = message[1:end]
+	if value, ok := r.Field(types.LogFieldRequestID); !ok {
+		r.Fields = append([]types.LogField{{Key: types.LogFieldRequestID, Value: reqID}}, fields...)
+	} else if FieldString(value) != reqID {
+		return r
+	}
+	r.Message = message[end+2:]
+	return r
+}
+
+// Field returns the value of the field with the key.
+func (r *Record) Field(key string) (interface{}, bool) {
+	if i := indexOfField(r.Fields, key); i >= 0 {
+		return r.Fields[i].Value, true
+	}
+	return nil, false
+}
+
+// Logger is a types.StructuredLogger which creates a record for every message
+// with high enough level and passes it to its emit function.
+type Logger struct {
+	level  Level
+	fields []types.LogField
+	emit   func(*Record)
+	closer io.Closer
+}
+
+// NewLogger returns a Logger which emits the records up to level. The closer
+// is closed by Close and can be nil.
+func NewLogger(level Level, emit func(*Record), closer io.Closer) *Logger {
+	return &Logger{level: level, emit: emit, closer: closer}
+}
+
+// Close closes the file or the connection the logger writes to. It is shared
+// with the copies returned by With.
+func (l *Logger) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// With returns a copy of the logger which adds the fields to its records.
+func (l *Logger) With(fields ...types.LogField) types.StructuredLogger {
+	var c = *l
+	c.fields = MergeFields(l.fields, fields...)
+	return &c
+}
+
+func (l *Logger) log(level Level, message string) {
+	if l.level >= level {
+		l.emit(NewRecord(level, l.fields, message))
+	}
+}
+
+// Log logs the arguments formatted as with fmt.Sprintln with the info level.
+func (l *Logger) Log(args ...interface{}) {
+	l.log(Info, Sprintln(args...))
+}
+
+// Logf logs the arguments formatted as with fmt.Sprintf with the info level.
+func (l *Logger) Logf(format string, args ...interface{}) {
+	l.log(Info, fmt.Sprintf(format, args...))
+}
+
+// Debug logs the arguments formatted as with fmt.Sprintln with the debug level.
+func (l *Logger) Debug(args ...interface{}) {
+	l.log(Debug, Sprintln(args...))
+}
+
+// Debugf logs the arguments formatted as with fmt.Sprintf with the debug level.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.log(Debug, fmt.Sprintf(format, args...))
+}
+
+// Error logs the arguments formatted as with fmt.Sprintln with the error level.
+func (l *Logger) Error(args ...interface{}) {
+	l.log(Error, Sprintln(args...))
+}
+
+// Errorf logs the arguments formatted as with fmt.Sprintf with the error level.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.log(Error, fmt.Sprintf(format, args...))
+}
+
+// Fatal logs the arguments formatted as with fmt.Sprintln with the fatal level
+// and exits the program.
+func (l *Logger) Fatal(args ...interface{}) {
+	l.log(Fatal, Sprintln(args...))
+	os.Exit(1)
+}
+
+// Fatalf logs the arguments formatted as with fmt.Sprintf with the fatal
+// level and exits the program.
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.log(Fatal, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// Sprintln formats the arguments as fmt.Sprintln without the new line.
+func Sprintln(args ...interface{}) string {
+	var s = fmt.Sprintln(args...)
+	return s[:len(s)-1]
+}
@@ -0,0 +1,99 @@
+package logrecord
+
+import (
+	"testing"
+
+	"github.com/ironsmile/nedomi/types"
+)
+
+func TestNewRecordRequestID(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		message, requestID, result string
+	}{
+		{"[abc123] Cache miss", "abc123", "Cache miss"},
+		{"Cache miss", "", "Cache miss"},
+		{"[not an id] message", "", "[not an id] message"},
+		{"[] message", "", "[] message"},
+		{"[abc123]message", "", "[abc123]message"},
+	}
+	var location = []types.LogField{{Key: types.LogFieldLocation, Value: "loc"}}
+	for _, test := range tests {
+		var r = NewRecord(Info, location, test.message)
+		var reqID, _ = r.Field(types.LogFieldRequestID)
+		if test.requestID == "" && reqID != nil || test.requestID != "" && reqID != test.requestID ||
+			r.Message != test.result {
+			t.Errorf("For %q expected request ID %q and message %q but got %v and %q",
+				test.message, test.requestID, test.result, reqID, r.Message)
+		}
+		if value, _ := r.Field(types.LogFieldLocation); value != "loc" || r.Level != Info {
+			t.Errorf("Unexpected location %v or level %s", value, r.Level)
+		}
+	}
+
+	// a prefix with a different request ID than the field is left in the message
+	var fields = []types.LogField{{Key: types.LogFieldRequestID, Value: types.RequestID("id")}}
+	if r := NewRecord(Info, fields, "[id] message"); r.Message != "message" || len(r.Fields) != 1 {
+		t.Errorf("Unexpected record %+v", r)
+	}
+	if r := NewRecord(Info, fields, "[other] message"); r.Message != "[other] message" {
+		t.Errorf("Unexpected record %+v", r)
+	}
+}
+
+func TestMergeFields(t *testing.T) {
+	t.Parallel()
+	var fields = []types.LogField{{Key: "a", Value: 1}, {Key: "b", Value: 2}}
+	var merged = MergeFields(fields, types.LogField{Key: "c", Value: 3},
+		types.LogField{Key: "a", Value: 4}, types.LogField{Key: "c", Value: 5})
+	if got := string(AppendFields(nil, merged)); got != "b=2 a=4 c=5" {
+		t.Errorf("Unexpected merged fields %s", got)
+	}
+	if got := string(AppendFields(nil, fields)); got != "a=1 b=2" {
+		t.Errorf("The original fields were changed to %s", got)
+	}
+	var quoted = []types.LogField{{Key: "s", Value: `with "quotes"`}, {Key: "e", Value: ""}}
+	if got := string(AppendFields(nil, quoted)); got != `s="with \"quotes\"" e=""` {
+		t.Errorf("Unexpected fields %s", got)
+	}
+}
+
+func TestLoggerLevels(t *testing.T) {
+	t.Parallel()
+	var records []*Record
+	var l = NewLogger(Error, func(r *Record) { records = append(records, r) }, nil)
+	l.Debug("debug")
+	l.Logf("%s", "info")
+	l.Error("error", 1)
+	l.Errorf("[%s] errorf", "id")
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records but got %d", len(records))
+	}
+	if reqID, _ := records[1].Field(types.LogFieldRequestID); records[0].Message != "error 1" ||
+		records[1].Message != "errorf" || reqID != "id" {
+		t.Errorf("Unexpected records %+v and %+v", records[0], records[1])
+	}
+
+	l.With(types.LogField{Key: types.LogFieldLocation, Value: "example.com"}).Error("located")
+	if value, _ := records[2].Field(types.LogFieldLocation); value != "example.com" {
+		t.Errorf("Unexpected location %v", value)
+	}
+	l.Error("not located")
+	if len(records[3].Fields) != 0 {
+		t.Errorf("The original logger got the fields %v", records[3].Fields)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	t.Parallel()
+	for name, expected := range map[string]Level{
+		"": Info, "no_log": NoLog, "fatal": Fatal, "error": Error, "info": Info, "debug": Debug,
+	} {
+		if level, err := ParseLevel(name); err != nil || level != expected {
+			t.Errorf("For %q expected %s but got %s, %v", name, expected, level, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// labelValuesSeparator can not be in valid UTF-8 label values
+const labelValuesSeparator = "\xff"
+
+// CounterVec is a group of counters with the same name and label names which
+// are distinguished by their label values.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mutex  sync.RWMutex
+	values map[string]*counter
+}
+
+type counter struct {
+	labelValues []string
+	value       uint64
+}
+
+// NewCounterVec returns a CounterVec with the supplied name, help and label
+// names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]*counter),
+	}
+}
+
+func (c *CounterVec) get(labelValues []string) *counter {
+	var key = strings.Join(labelValues, labelValuesSeparator)
+	c.mutex.RLock()
+	result, ok := c.values[key]
+	c.mutex.RUnlock()
+	if ok {
+		return result
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if result, ok = c.values[key]; !ok {
+		result = &counter{labelValues: append([]string(nil), labelValues...)}
+		c.values[key] = result
+	}
+	return result
+}
+
+// Add adds value to the counter with the supplied label values.
+func (c *CounterVec) Add(value uint64, labelValues ...string) {
+	atomic.AddUint64(&c.get(labelValues).value, value)
+}
+
+// Inc increments the counter with the supplied label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the current value of the counter with the supplied label
+// values.
+func (c *CounterVec) Value(labelValues ...string) uint64 {
+	return atomic.LoadUint64(&c.get(labelValues).value)
+}
+
+// Collect implements the Collector interface. The counters are written sorted
+// by their label values.
+func (c *CounterVec) Collect(w *Writer) {
+	c.mutex.RLock()
+	var keys = make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	c.mutex.RUnlock()
+	sort.Strings(keys)
+
+	w.Header(c.name, c.help, TypeCounter)
+	for _, key := range keys {
+		c.mutex.RLock()
+		var value = c.values[key]
+		c.mutex.RUnlock()
+		w.Sample(c.name, c.labels, value.labelValues, float64(atomic.LoadUint64(&value.value)))
+	}
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of the histogram buckets in seconds
+// which are suitable for request latencies.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// HistogramVec is a group of histograms with the same name, label names and
+// buckets which are distinguished by their label values.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mutex  sync.Mutex
+	values map[string]*histogram
+}
+
+type histogram struct {
+	labelValues []string
+	counts      []uint64 // the last one is for +Inf
+	sum         float64
+	count       uint64
+}
+
+// NewHistogramVec returns a HistogramVec with the supplied name, help, sorted
+// bucket upper bounds and label names.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		values:  make(map[string]*histogram),
+	}
+}
+
+// Observe adds the value to the histogram with the supplied label values.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	var key = strings.Join(labelValues, labelValuesSeparator)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	result, ok := h.values[key]
+	if !ok {
+		result = &histogram{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)+1),
+		}
+		h.values[key] = result
+	}
+	result.counts[sort.SearchFloat64s(h.buckets, value)]++
+	result.sum += value
+	result.count++
+}
+
+// Collect implements the Collector interface. The histograms are written
+// sorted by their label values.
+func (h *HistogramVec) Collect(w *Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var keys = make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var bucketLabels = append(append([]string(nil), h.labels...), "le")
+	w.Header(h.name, h.help, TypeHistogram)
+	for _, key := range keys {
+		var (
+			value      = h.values[key]
+			cumulative uint64
+			labels     = append(append([]string(nil), value.labelValues...), "")
+		)
+		for i, count := range value.counts {
+			cumulative += count
+			var le = math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			labels[len(labels)-1] = formatFloat(le)
+			w.Sample(h.name+"_bucket", bucketLabels, labels, float64(cumulative))
+		}
+		w.Sample(h.name+"_sum", h.labels, value.labelValues, value.sum)
+		w.Sample(h.name+"_count", h.labels, value.labelValues, float64(value.count))
+	}
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	t.Parallel()
+	var c = NewCounterVec("test_requests_total", "Test requests.", "vhost", "code")
+	c.Inc("example.com", "200")
+	c.Add(2, "example.com", "200")
+	c.Inc("a.example.com", "404")
+	c.Inc(`quo"te`, "500")
+
+	if value := c.Value("example.com", "200"); value != 3 {
+		t.Errorf("Expected the counter to be 3 but it was %d", value)
+	}
+
+	var expected = `# HELP test_requests_total Test requests.
+# TYPE test_requests_total counter
+test_requests_total{vhost="a.example.com",code="404"} 1
+test_requests_total{vhost="example.com",code="200"} 3
+test_requests_total{vhost="quo\"te",code="500"} 1
+`
+	var buf bytes.Buffer
+	var r = NewRegistry()
+	r.Register(c)
+	if err := r.Write(&buf); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	t.Parallel()
+	var h = NewHistogramVec("test_duration_seconds", "Test durations.", []float64{0.1, 1}, "address")
+	h.Observe(0.05, "127.0.0.1:80")
+	h.Observe(0.1, "127.0.0.1:80")
+	h.Observe(0.5, "127.0.0.1:80")
+	h.Observe(2, "127.0.0.1:80")
+
+	var expected = `# HELP test_duration_seconds Test durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{address="127.0.0.1:80",le="0.1"} 2
+test_duration_seconds_bucket{address="127.0.0.1:80",le="1"} 3
+test_duration_seconds_bucket{address="127.0.0.1:80",le="+Inf"} 4
+test_duration_seconds_sum{address="127.0.0.1:80"} 2.65
+test_duration_seconds_count{address="127.0.0.1:80"} 4
+`
+	var buf bytes.Buffer
+	var w = NewWriter(&buf)
+	h.Collect(w)
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"io"
+	"sync"
+)
+
+// Collector is a metric or a group of metrics which can be written.
+type Collector interface {
+	Collect(w *Writer)
+}
+
+// CollectorFunc is a function which implements the Collector interface.
+type CollectorFunc func(w *Writer)
+
+// Collect implements the Collector interface
+func (f CollectorFunc) Collect(w *Writer) {
+	f(w)
+}
+
+// Registry holds collectors which are written together.
+type Registry struct {
+	mutex      sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds the collector in the registry.
+func (r *Registry) Register(c Collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Collect writes all of the registered collectors in the order of their
+// registration.
+func (r *Registry) Collect(w *Writer) {
+	r.mutex.Lock()
+	var collectors = make([]Collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mutex.Unlock()
+
+	for _, c := range collectors {
+		c.Collect(w)
+	}
+}
+
+// Write writes all of the registered collectors to out.
+func (r *Registry) Write(out io.Writer) error {
+	var w = NewWriter(out)
+	r.Collect(w)
+	return w.Flush()
+}
+
+// DefaultRegistry is used by the packages which expose their metrics globally.
+var DefaultRegistry = NewRegistry()
@@ -0,0 +1,94 @@
+// Package metrics contains counters and histograms which can be exposed in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Metric types in the exposition format
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Writer writes metrics in the Prometheus text exposition format. The first
+// write error is remembered and returned by Flush.
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewWriter returns a Writer which writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Header writes the HELP and TYPE lines of a metric. It must be called once
+// before the samples of every metric.
+func (w *Writer) Header(name, help, typ string) {
+	w.writeString("# HELP " + name + " " + help + "\n")
+	w.writeString("# TYPE " + name + " " + typ + "\n")
+}
+
+// Sample writes a single sample of a metric. The label names and values are
+// paired by their indexes.
+func (w *Writer) Sample(name string, labelNames, labelValues []string, value float64) {
+	var buf = make([]byte, 0, 64)
+	buf = append(buf, name...)
+	if len(labelNames) > 0 {
+		buf = append(buf, '{')
+		for i := range labelNames {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, labelNames[i]...)
+			buf = append(buf, `="`...)
+			buf = append(buf, labelValueReplacer.Replace(labelValues[i])...)
+			buf = append(buf, '"')
+		}
+		buf = append(buf, '}')
+	}
+	buf = append(buf, ' ')
+	buf = append(buf, formatFloat(value)...)
+	buf = append(buf, '\n')
+	w.write(buf)
+}
+
+// Flush writes any buffered data and returns the first error which occurred
+// while writing.
+func (w *Writer) Flush() error {
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	return w.err
+}
+
+func (w *Writer) write(b []byte) {
+	if w.err == nil {
+		_, w.err = w.w.Write(b)
+	}
+}
+
+func (w *Writer) writeString(s string) {
+	if w.err == nil {
+		_, w.err = w.w.WriteString(s)
+	}
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	if math.IsInf(v, -1) {
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,58 @@
+package netutils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IPNets is a list of networks.
+type IPNets []*net.IPNet
+
+// ParseIPNets parses networks in CIDR notation like 10.0.0.0/8. Addresses
+// without a prefix length are networks with only them.
+func ParseIPNets(cidrs []string) (IPNets, error) {
+	var nets = make(IPNets, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			var ip = net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address `%s`", cidr)
+			}
+			var bits = 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// Contains returns whether ip is in any of the networks.
+func (nets IPNets) Contains(ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsAddr returns whether the IP of the address is in any of the
+// networks. Addresses other than TCP and UDP ones are not.
+func (nets IPNets) ContainsAddr(addr net.Addr) bool {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return nets.Contains(a.IP)
+	case *net.UDPAddr:
+		return nets.Contains(a.IP)
+	}
+	return false
+}
@@ -0,0 +1,278 @@
+package netutils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	proxyV1Prefix    = "PROXY "
+	proxyV1MaxLength = 107 // including the CRLF
+	proxyV2HeaderLen = 16
+
+	proxyV2CmdLocal = 0x0
+	proxyV2CmdProxy = 0x1
+	proxyV2TCP4     = 0x11
+	proxyV2TCP6     = 0x21
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var errInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+
+// proxyListener reads the PROXY protocol headers of the accepted connections
+// in their own goroutines so that slow clients do not block the others.
+type proxyListener struct {
+	net.Listener
+	trusted IPNets
+	timeout time.Duration
+
+	conns chan net.Conn
+	errs  chan error
+	done  chan struct{}
+	start sync.Once
+	stop  sync.Once
+}
+
+// NewProxyProtocolListener returns a listener whose connections from the
+// trusted networks start with a PROXY protocol v1 or v2 header. Their
+// remote and local addresses are the ones from the header. All connections
+// are trusted if the networks are empty. The connections from other addresses
+// are accepted as they are. The header must be read in timeout.
+func NewProxyProtocolListener(l net.Listener, trusted IPNets, timeout time.Duration) net.Listener {
+	return &proxyListener{
+		Listener: l,
+		trusted:  trusted,
+		timeout:  timeout,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		done:     make(chan struct{}),
+	}
+}
+
+// Accept returns the next connection whose header was read.
+func (p *proxyListener) Accept() (net.Conn, error) {
+	p.start.Do(func() { go p.acceptLoop() })
+	select {
+	case conn := <-p.conns:
+		return conn, nil
+	case err := <-p.errs:
+		return nil, err
+	case <-p.done:
+		return nil, errors.New("use of closed PROXY protocol listener")
+	}
+}
+
+// Close closes the underlying listener.
+func (p *proxyListener) Close() error {
+	p.stop.Do(func() { close(p.done) })
+	return p.Listener.Close()
+}
+
+func (p *proxyListener) acceptLoop() {
+	for {
+		conn, err := p.Listener.Accept()
+		if err != nil {
+			select {
+			case p.errs <- err:
+			case <-p.done:
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		go p.handshake(conn)
+	}
+}
+
+func (p *proxyListener) handshake(conn net.Conn) {
+	if len(p.trusted) == 0 || p.trusted.ContainsAddr(conn.RemoteAddr()) {
+		var err error
+		if conn, err = p.readHeader(conn); err != nil {
+			return
+		}
+	}
+	select {
+	case p.conns <- conn:
+	case <-p.done:
+		_ = conn.Close()
+	}
+}
+
+func (p *proxyListener) readHeader(conn net.Conn) (net.Conn, error) {
+	if p.timeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(p.timeout)); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	var proxy = &proxyConn{Conn: conn, r: bufio.NewReader(conn)}
+	var err = proxy.readHeader()
+	if err == nil && p.timeout > 0 {
+		err = conn.SetReadDeadline(time.Time{})
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return proxy, nil
+}
+
+// proxyConn is a connection with the addresses from its PROXY protocol
+// header.
+type proxyConn struct {
+	net.Conn
+	r                     *bufio.Reader // nil after the buffered data is read
+	remoteAddr, localAddr net.Addr
+}
+
+func (c *proxyConn) readHeader() error {
+	// the shortest header is longer than the v2 signature
+	signature, err := c.r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(signature, proxyV2Signature) {
+		err = c.readV2Header()
+	} else {
+		err = c.readV1Header()
+	}
+	if err != nil {
+		return err
+	}
+	if c.r.Buffered() == 0 {
+		c.r = nil
+	}
+	return nil
+}
+
+func (c *proxyConn) readV1Header() error {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if line = append(line, b); len(line) > proxyV1MaxLength {
+			return errInvalidProxyHeader
+		}
+	}
+	var fields = strings.Split(string(line[:len(line)-2]), " ")
+	if fields[0]+" " != proxyV1Prefix || len(fields) < 2 {
+		return errInvalidProxyHeader
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil
+	case "TCP4", "TCP6":
+	default:
+		return errInvalidProxyHeader
+	}
+	if len(fields) != 6 {
+		return errInvalidProxyHeader
+	}
+	var err error
+	if c.remoteAddr, err = parseV1Addr(fields[2], fields[4]); err != nil {
+		return err
+	}
+	c.localAddr, err = parseV1Addr(fields[3], fields[5])
+	return err
+}
+
+func parseV1Addr(host, port string) (*net.TCPAddr, error) {
+	var ip = net.ParseIP(host)
+	p, err := strconv.ParseUint(port, 10, 16)
+	if ip == nil || err != nil {
+		return nil, errInvalidProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+func (c *proxyConn) readV2Header() error {
+	var header [proxyV2HeaderLen]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return err
+	}
+	var (
+		version = header[12] >> 4
+		command = header[12] & 0xF
+		family  = header[13]
+		length  = int(binary.BigEndian.Uint16(header[14:]))
+	)
+	if version != 2 || (command != proxyV2CmdLocal && command != proxyV2CmdProxy) {
+		return errInvalidProxyHeader
+	}
+	var addresses = make([]byte, length)
+	if _, err := io.ReadFull(c.r, addresses); err != nil {
+		return err
+	}
+	if command == proxyV2CmdLocal { // health checks from the proxy itself
+		return nil
+	}
+	switch family {
+	case proxyV2TCP4:
+		if length < 12 {
+			return errInvalidProxyHeader
+		}
+		c.remoteAddr = &net.TCPAddr{IP: net.IP(addresses[0:4]),
+			Port: int(binary.BigEndian.Uint16(addresses[8:]))}
+		c.localAddr = &net.TCPAddr{IP: net.IP(addresses[4:8]),
+			Port: int(binary.BigEndian.Uint16(addresses[10:]))}
+	case proxyV2TCP6:
+		if length < 36 {
+			return errInvalidProxyHeader
+		}
+		c.remoteAddr = &net.TCPAddr{IP: net.IP(addresses[0:16]),
+			Port: int(binary.BigEndian.Uint16(addresses[32:]))}
+		c.localAddr = &net.TCPAddr{IP: net.IP(addresses[16:32]),
+			Port: int(binary.BigEndian.Uint16(addresses[34:]))}
+	}
+	// other families are not supported and the real addresses are used
+	return nil
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	if c.r == nil {
+		return c.Conn.Read(b)
+	}
+	n, err := c.r.Read(b)
+	if c.r.Buffered() == 0 {
+		c.r = nil
+	}
+	return n, err
+}
+
+// ReadFrom uses the ReadFrom of the underlying connection if it has one so
+// that sendfile can be used.
+func (c *proxyConn) ReadFrom(r io.Reader) (int64, error) {
+	if rf, ok := c.Conn.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(c.Conn, r)
+}
+
+// RemoteAddr returns the client address from the header.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address from the header.
+func (c *proxyConn) LocalAddr() net.Addr {
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
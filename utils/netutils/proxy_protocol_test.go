@@ -0,0 +1,199 @@
+package netutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func proxyV2Header(command, family byte, addresses []byte) []byte {
+	var header = append([]byte(nil), proxyV2Signature...)
+	header = append(header, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(len(addresses)))
+	return append(header, addresses...)
+}
+
+func TestProxyProtocol(t *testing.T) {
+	t.Parallel()
+	var v2TCP4 = []byte{192, 168, 0, 1, 10, 0, 0, 1, 0x30, 0x39, 0, 80}
+	var tests = []struct {
+		name       string
+		header     []byte
+		remoteAddr string // empty for the real address
+		localAddr  string
+		invalid    bool
+	}{
+		{
+			name:       "v1 TCP4",
+			header:     []byte("PROXY TCP4 192.168.0.1 10.0.0.1 12345 80\r\n"),
+			remoteAddr: "192.168.0.1:12345",
+			localAddr:  "10.0.0.1:80",
+		},
+		{
+			name:       "v1 TCP6",
+			header:     []byte("PROXY TCP6 2001:db8::1 2001:db8::2 12345 443\r\n"),
+			remoteAddr: "[2001:db8::1]:12345",
+			localAddr:  "[2001:db8::2]:443",
+		},
+		{
+			name:   "v1 UNKNOWN",
+			header: []byte("PROXY UNKNOWN\r\n"),
+		},
+		{
+			name:       "v2 TCP4",
+			header:     proxyV2Header(proxyV2CmdProxy, proxyV2TCP4, v2TCP4),
+			remoteAddr: "192.168.0.1:12345",
+			localAddr:  "10.0.0.1:80",
+		},
+		{
+			name:       "v2 TCP4 with TLVs",
+			header:     proxyV2Header(proxyV2CmdProxy, proxyV2TCP4, append(v2TCP4, 0x04, 0, 1, 'x')),
+			remoteAddr: "192.168.0.1:12345",
+			localAddr:  "10.0.0.1:80",
+		},
+		{
+			name:   "v2 LOCAL",
+			header: proxyV2Header(proxyV2CmdLocal, 0, nil),
+		},
+		{
+			name:    "no header",
+			header:  []byte("GET / HTTP/1.1\r\n"),
+			invalid: true,
+		},
+		{
+			name:    "v1 bad port",
+			header:  []byte("PROXY TCP4 192.168.0.1 10.0.0.1 123456 80\r\n"),
+			invalid: true,
+		},
+		{
+			name:    "v2 bad version",
+			header:  append(append([]byte(nil), proxyV2Signature...), 0x11, 0x11, 0, 0),
+			invalid: true,
+		},
+	}
+
+	for _, test := range tests {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pl = NewProxyProtocolListener(l, nil, time.Second)
+		client, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = client.Write(append(test.header, "payload"...)); err != nil {
+			t.Fatal(err)
+		}
+		if test.invalid {
+			go func() { _, _ = pl.Accept() }() // starts reading the headers
+			_ = client.(*net.TCPConn).CloseWrite()
+			var buf = make([]byte, 1)
+			if _, err := client.Read(buf); err == nil {
+				t.Errorf("%s: expected the connection to be closed", test.name)
+			}
+			_ = client.Close()
+			_ = pl.Close()
+			continue
+		}
+		conn, err := pl.Accept()
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		var expectedRemote, expectedLocal = test.remoteAddr, test.localAddr
+		if expectedRemote == "" {
+			expectedRemote, expectedLocal = client.LocalAddr().String(), client.RemoteAddr().String()
+		}
+		if got := conn.RemoteAddr().String(); got != expectedRemote {
+			t.Errorf("%s: expected remote address %s got %s", test.name, expectedRemote, got)
+		}
+		if got := conn.LocalAddr().String(); got != expectedLocal {
+			t.Errorf("%s: expected local address %s got %s", test.name, expectedLocal, got)
+		}
+		_ = client.Close()
+		if data, err := ioutil.ReadAll(conn); err != nil || string(data) != "payload" {
+			t.Errorf("%s: expected the payload after the header got %q, %v", test.name, data, err)
+		}
+		_ = conn.Close()
+		_ = pl.Close()
+	}
+}
+
+func TestProxyProtocolUntrusted(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, err := ParseIPNets([]string{"10.0.0.0/8", "192.168.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pl = NewProxyProtocolListener(l, trusted, time.Second)
+	defer pl.Close()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header = []byte("PROXY TCP4 192.168.0.1 10.0.0.1 12345 80\r\n")
+	if _, err = client.Write(header); err != nil {
+		t.Fatal(err)
+	}
+	_ = client.Close()
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got := conn.RemoteAddr().String(); got != client.LocalAddr().String() {
+		t.Errorf("expected the real address of the untrusted client got %s", got)
+	}
+	if data, _ := ioutil.ReadAll(conn); !bytes.Equal(data, header) {
+		t.Errorf("expected the header of the untrusted client to be data got %q", data)
+	}
+}
+
+func TestProxyProtocolClose(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pl = NewProxyProtocolListener(l, nil, time.Second)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = pl.Close()
+	}()
+	for i := 0; i < 2; i++ {
+		if _, err := pl.Accept(); err == nil {
+			t.Error("expected an error from a closed listener")
+		}
+	}
+}
+
+func TestParseIPNets(t *testing.T) {
+	t.Parallel()
+	nets, err := ParseIPNets([]string{"10.0.0.0/8", "192.168.0.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, expected := range map[string]bool{
+		"10.1.2.3":    true,
+		"192.168.0.1": true,
+		"192.168.0.2": false,
+		"2001:db8::5": true,
+		"2001:db9::5": false,
+	} {
+		if got := nets.Contains(net.ParseIP(ip)); got != expected {
+			t.Errorf("expected %t for %s got %t", expected, ip, got)
+		}
+	}
+	for _, invalid := range []string{"10.0.0.0/33", "not-an-ip"} {
+		if _, err := ParseIPNets([]string{invalid}); err == nil {
+			t.Errorf("expected an error for %s", invalid)
+		}
+	}
+}
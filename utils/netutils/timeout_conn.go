@@ -3,6 +3,7 @@ package netutils
 import (
 	"io"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/ironsmile/nedomi/types"
@@ -14,12 +15,16 @@ import (
 // the difference to which the deadline was set. That timeout is then use to
 // Timeout each read|write on the connection
 type timeoutConn struct {
+	// The timeouts are time.Durations accessed atomically as the deadlines
+	// may be set while another goroutine reads or writes. They are first
+	// for the 64-bit alignment on 32-bit platforms.
+	readTimeout, writeTimeout int64
+
 	net.Conn
-	id                        string
-	wr                        io.Writer
-	maxSizeOfTransfer         int64
-	minSizeOfTransfer         int64
-	readTimeout, writeTimeout time.Duration
+	id                string
+	wr                io.Writer
+	maxSizeOfTransfer int64
+	minSizeOfTransfer int64
 }
 
 // newTimeoutConn returns a timeout conn wrapping around the provided one
@@ -52,8 +57,9 @@ func (tc *timeoutConn) Write(data []byte) (int, error) {
 // SetDeadline sets both the read and write timeouts to the difference
 // from now to the time provied and calls the underlying SetDeadline
 func (tc *timeoutConn) SetDeadline(t time.Time) error {
-	tc.readTimeout = t.Sub(time.Now())
-	tc.writeTimeout = tc.readTimeout
+	var timeout = int64(timeoutTo(t))
+	atomic.StoreInt64(&tc.readTimeout, timeout)
+	atomic.StoreInt64(&tc.writeTimeout, timeout)
 	return tc.Conn.SetDeadline(t)
 }
 
@@ -61,7 +67,7 @@ func (tc *timeoutConn) SetDeadline(t time.Time) error {
 // and the time provided as well as calls the underlying SetReadDeadline
 // and returns what it returns
 func (tc *timeoutConn) SetReadDeadline(t time.Time) error {
-	tc.readTimeout = t.Sub(time.Now())
+	atomic.StoreInt64(&tc.readTimeout, int64(timeoutTo(t)))
 	return tc.Conn.SetReadDeadline(t)
 }
 
@@ -69,7 +75,7 @@ func (tc *timeoutConn) SetReadDeadline(t time.Time) error {
 // and the time provided as well as calls the underlying SetWriteDeadline
 // and returns what it returns
 func (tc *timeoutConn) SetWriteDeadline(t time.Time) error {
-	tc.writeTimeout = t.Sub(time.Now())
+	atomic.StoreInt64(&tc.writeTimeout, int64(timeoutTo(t)))
 	return tc.Conn.SetWriteDeadline(t)
 }
 
@@ -86,11 +92,29 @@ func (tc *timeoutConn) ReadFrom(r io.Reader) (n int64, err error) {
 }
 
 func (tc *timeoutConn) writeDeadline() time.Time {
-	return time.Now().Add(tc.writeTimeout)
+	return deadlineAfter(time.Duration(atomic.LoadInt64(&tc.writeTimeout)))
 }
 
 func (tc *timeoutConn) readDeadline() time.Time {
-	return time.Now().Add(tc.readTimeout)
+	return deadlineAfter(time.Duration(atomic.LoadInt64(&tc.readTimeout)))
+}
+
+// timeoutTo returns the timeout until the deadline. The zero deadline, which
+// the HTTP/2 server uses to clear the deadlines, means no timeout.
+func timeoutTo(t time.Time) time.Duration {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Sub(time.Now())
+}
+
+// deadlineAfter returns the deadline for the timeout or the zero time if
+// there is no timeout.
+func deadlineAfter(timeout time.Duration) time.Time {
+	if timeout == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
 }
 
 func (tc *timeoutConn) SetThrottle(speed types.BytesSize) {
@@ -0,0 +1,51 @@
+package netutils
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestTimeoutConnConcurrentDeadlines sets the deadlines while another
+// goroutine reads and writes as the HTTP/2 server does. Run it with -race.
+func TestTimeoutConnConcurrentDeadlines(t *testing.T) {
+	t.Parallel()
+	server, client := net.Pipe()
+	defer client.Close()
+	var conn = newTimeoutConn(server, 1024, 512)
+	defer conn.Close()
+
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		var buf = make([]byte, 1)
+		for i := 0; i < 100; i++ {
+			if _, err := conn.Read(buf); err != nil {
+				t.Errorf("Unexpected read error: %s", err)
+				return
+			}
+			if _, err := conn.Write(buf); err != nil {
+				t.Errorf("Unexpected write error: %s", err)
+				return
+			}
+		}
+	}()
+
+	var buf = make([]byte, 1)
+	for i := 0; i < 100; i++ {
+		var deadline = time.Now().Add(time.Minute)
+		if i%2 == 0 {
+			deadline = time.Time{}
+		}
+		_ = conn.SetReadDeadline(deadline)
+		_ = conn.SetWriteDeadline(deadline)
+		_ = conn.SetDeadline(deadline)
+		if _, err := client.Write(buf); err != nil {
+			t.Fatalf("Unexpected write error: %s", err)
+		}
+		if _, err := client.Read(buf); err != nil {
+			t.Fatalf("Unexpected read error: %s", err)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,83 @@
+package netutils
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+
+	"github.com/ironsmile/nedomi/types"
+)
+
+// The incoming connections wrapped in the TLS connections which are still
+// open. net/http needs to get the *tls.Conn itself in order to know that a
+// connection is secure so the TLS connections can not embed the incoming.
+var tlsConns = struct {
+	sync.Mutex
+	m map[*tls.Conn]types.IncomingConn
+}{m: make(map[*tls.Conn]types.IncomingConn)}
+
+type tlsListener struct {
+	net.Listener
+	config *tls.Config
+}
+
+// NewTLSListener returns a listener which wraps the connections accepted by
+// l in TLS server connections with the config. The connections accepted by l
+// should be types.IncomingConn. They can be found from the TLS ones with
+// IncomingConn.
+func NewTLSListener(l net.Listener, config *tls.Config) net.Listener {
+	return &tlsListener{Listener: l, config: config}
+}
+
+// Accept calls the underlying accept and wraps the connection in a TLS one.
+func (t *tlsListener) Accept() (net.Conn, error) {
+	conn, err := t.Listener.Accept()
+	if err != nil {
+		return conn, err
+	}
+	var tlsConn = tls.Server(conn, t.config)
+	if incoming, ok := conn.(types.IncomingConn); ok {
+		tlsConns.Lock()
+		tlsConns.m[tlsConn] = incoming
+		tlsConns.Unlock()
+	}
+	return tlsConn, nil
+}
+
+// IncomingConn returns conn if it is a types.IncomingConn or the incoming
+// connection wrapped in it if it is a TLS connection accepted by a listener
+// from NewTLSListener.
+func IncomingConn(conn net.Conn) (types.IncomingConn, bool) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		tlsConns.Lock()
+		defer tlsConns.Unlock()
+		incoming, ok := tlsConns.m[tlsConn]
+		return incoming, ok
+	}
+	incoming, ok := conn.(types.IncomingConn)
+	return incoming, ok
+}
+
+// ForgetConn should be called when a connection is closed so that it is not
+// kept by IncomingConn.
+func ForgetConn(conn net.Conn) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		tlsConns.Lock()
+		delete(tlsConns.m, tlsConn)
+		tlsConns.Unlock()
+	}
+}
+
+// ListensOn returns whether the listener listens on the TCP address. An
+// address without a host or with an unspecified IP matches all IPs.
+func ListensOn(l net.Listener, address string) bool {
+	addr, ok := l.Addr().(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	expected, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil || expected.Port != addr.Port {
+		return false
+	}
+	return expected.IP == nil || expected.IP.IsUnspecified() || expected.IP.Equal(addr.IP)
+}